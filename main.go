@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go-router/router"
+)
+
+func main() {
+	settings, err := router.ParseSettings(os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		os.Exit(2)
+	}
+	if settings.Validate {
+		if !router.CheckConfig(settings.ConfigFile, settings.StrictConfig, os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := router.Run(ctx, settings); err != nil {
+		slog.Error("router stopped", "error", err)
+		stop()
+		os.Exit(1)
+	}
+}
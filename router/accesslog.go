@@ -0,0 +1,106 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// LogRotation bounds the log files the router writes. A file is rotated
+// once it reaches MaxMB, renamed with the time of rotation, and rotated
+// files beyond MaxBackups or older than MaxAgeDays are removed; 0 keeps
+// them all or forever.
+type LogRotation struct {
+	MaxMB      int
+	MaxBackups int
+	MaxAgeDays int
+}
+
+// file returns a writer to filename rotated by lr. It serializes writes,
+// so it can be shared by concurrent loggers.
+func (lr LogRotation) file(filename string) *lumberjack.Logger {
+	return &lumberjack.Logger{
+		Filename:   filename,
+		MaxSize:    lr.MaxMB,
+		MaxBackups: lr.MaxBackups,
+		MaxAge:     lr.MaxAgeDays,
+	}
+}
+
+// serviceLogs writes the access logs of each service to a file of its own
+// in dir, named after the service and rotated by rotation. Files are opened
+// when a service first logs.
+type serviceLogs struct {
+	dir      string
+	rotation LogRotation
+
+	mu      sync.Mutex
+	files   []*lumberjack.Logger
+	loggers map[string]*slog.Logger
+}
+
+// newServiceLogs returns the service logs of dir, creating it if needed
+func newServiceLogs(dir string, rotation LogRotation) (*serviceLogs, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &serviceLogs{dir: dir, rotation: rotation, loggers: make(map[string]*slog.Logger)}, nil
+}
+
+// logFileName returns the file service logs to, with anything but letters,
+// digits, '-', '_' and inner dots replaced so that it stays inside the dir.
+// A replaced name ends with a hash of the service, so that services such as
+// a/b and a:b keep files of their own.
+func logFileName(service string) string {
+	name := strings.Map(func(c rune) rune {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '_', c == '.':
+			return c
+		}
+		return '_'
+	}, service)
+	if strings.HasPrefix(name, ".") {
+		name = "_" + name[1:]
+	}
+	if name != service {
+		h := fnv.New32a()
+		h.Write([]byte(service))
+		name = fmt.Sprintf("%s-%08x", name, h.Sum32())
+	}
+	return name + ".log"
+}
+
+// logger returns the logger of service's access log
+func (s *serviceLogs) logger(service string) *slog.Logger {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if logger, ok := s.loggers[service]; ok {
+		return logger
+	}
+	file := s.rotation.file(filepath.Join(s.dir, logFileName(service)))
+	s.files = append(s.files, file)
+	logger := slog.New(slog.NewJSONHandler(file, nil))
+	s.loggers[service] = logger
+	return logger
+}
+
+// Close closes the open log files
+func (s *serviceLogs) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, file := range s.files {
+		if err := file.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("closing %s: %w", file.Filename, err))
+		}
+	}
+	s.files, s.loggers = nil, make(map[string]*slog.Logger)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,199 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLogRotation(t *testing.T) {
+	dir := t.TempDir()
+	file := LogRotation{MaxMB: 1, MaxBackups: 2}.file(filepath.Join(dir, "router.log"))
+	defer file.Close()
+
+	// 8 writers of 160 lines of 1KB go past the 1MB threshold at least once.
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 160; j++ {
+				if _, err := file.Write(line); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	rotated, err := filepath.Glob(filepath.Join(dir, "router-*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) == 0 {
+		t.Fatal("no rotated file after exceeding MaxMB")
+	}
+	for _, name := range append(rotated, filepath.Join(dir, "router.log")) {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 1<<20 || len(data)%len(line) != 0 {
+			t.Errorf("%s holds %d bytes; writes were split or the file outgrew MaxMB", name, len(data))
+		}
+	}
+}
+
+func TestLogFileName(t *testing.T) {
+	// Names that are safe as they are stay readable.
+	for _, service := range []string{"api", "api.v2", "billing_v2", "web-eu"} {
+		if got := logFileName(service); got != service+".log" {
+			t.Errorf("logFileName(%q) = %q, want %q", service, got, service+".log")
+		}
+	}
+	// Others are made safe, and services that read the same once made safe
+	// still get files of their own.
+	tests := map[string]string{
+		"../etc":      "_._etc-",
+		"a/b":         "a_b-",
+		"a:b":         "a_b-",
+		"a_b?":        "a_b_-",
+		"(default)":   "_default_-",
+		"host|/path":  "host__path-",
+		".hidden-svc": "_hidden-svc-",
+	}
+	seen := make(map[string]string)
+	for service, prefix := range tests {
+		got := logFileName(service)
+		if !strings.HasPrefix(got, prefix) || !strings.HasSuffix(got, ".log") || strings.ContainsAny(got, "/\\:") {
+			t.Errorf("logFileName(%q) = %q, want %s<hash>.log", service, got, prefix)
+		}
+		if other, ok := seen[got]; ok {
+			t.Errorf("%q and %q both log to %s", service, other, got)
+		}
+		seen[got] = service
+	}
+	if logFileName("a/b") != logFileName("a/b") {
+		t.Error("logFileName is not stable")
+	}
+}
+
+func TestServiceLogsCollidingNames(t *testing.T) {
+	dir := t.TempDir()
+	logs, err := newServiceLogs(dir, LogRotation{MaxMB: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs.logger("a/b").Info("request", "service", "a/b")
+	logs.logger("a:b").Info("request", "service", "a:b")
+	logs.logger("a:b").Info("request", "service", "a:b")
+	if err := logs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for service, want := range map[string]int{"a/b": 1, "a:b": 2} {
+		records := logLines(t, filepath.Join(dir, logFileName(service)))
+		if len(records) != want {
+			t.Errorf("%s's file holds %d records, want %d", service, len(records), want)
+		}
+		for _, record := range records {
+			if record["service"] != service {
+				t.Errorf("%s's file holds a record of %v", service, record["service"])
+			}
+		}
+	}
+}
+
+// logLines returns the JSON records of the log file at name, or nil if it
+// was never created
+func logLines(t *testing.T, name string) []map[string]any {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("%s: %v in %q", name, err, line)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestServiceAccessLogs(t *testing.T) {
+	api, web := newBackend(t, "api"), newBackend(t, "web")
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	dir := t.TempDir()
+	logs, err := newServiceLogs(dir, LogRotation{MaxMB: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var defaultLog bytes.Buffer
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Service: "api", Destination: api.URL},
+		{Service: "web", Destination: web.URL},
+		{Service: "billing", Destination: down.URL},
+		{Host: "static.example.com", Destination: web.URL},
+	}}, WithLogger(slog.New(slog.NewJSONHandler(&defaultLog, nil))))
+	router.AccessLoggers = logs.logger
+
+	serve(router, serviceRequest("api", ""))
+	serve(router, serviceRequest("api", ""))
+	serve(router, serviceRequest("web", ""))
+	serve(router, serviceRequest("billing", ""))
+	serve(router, serviceRequest("missing", ""))
+	serve(router, httptest.NewRequest(http.MethodGet, "http://static.example.com/logo.png", nil))
+	if err := logs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file     string
+		services []string
+	}{
+		{"api.log", []string{"api", "api"}},
+		{"web.log", []string{"web"}},
+		// Errors of a service go to its own log too.
+		{"billing.log", []string{"billing"}},
+		{"missing.log", nil},
+	}
+	for _, tt := range tests {
+		var services []string
+		for _, record := range logLines(t, filepath.Join(dir, tt.file)) {
+			services = append(services, record["service"].(string))
+		}
+		if !slices.Equal(services, tt.services) {
+			t.Errorf("%s holds records of %q, want %q", tt.file, services, tt.services)
+		}
+	}
+
+	// Unmatched requests and rules without a service use the default log.
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(defaultLog.String()), "\n") {
+		var record map[string]any
+		json.Unmarshal([]byte(line), &record)
+		if record["msg"] == "request" || record["msg"] == "no route" {
+			messages = append(messages, fmt.Sprintf("%s %s", record["msg"], record["path"]))
+		}
+	}
+	if want := []string{"no route /", "request /logo.png"}; !slices.Equal(messages, want) {
+		t.Errorf("default log access records = %q, want %q", messages, want)
+	}
+}
@@ -0,0 +1,65 @@
+package router
+
+import (
+	"net/netip"
+)
+
+// accessList is a parsed pair of Allow and Deny lists
+type accessList struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// parseAccessList parses allow and deny, reporting the first malformed entry
+func parseAccessList(allow, deny []string) (accessList, error) {
+	var list accessList
+	var err error
+	if list.allow, err = parsePrefixes("allow", allow); err != nil {
+		return accessList{}, err
+	}
+	if list.deny, err = parsePrefixes("deny", deny); err != nil {
+		return accessList{}, err
+	}
+	return list, nil
+}
+
+// longestMatch returns the length of the longest of prefixes containing
+// addr, or -1 if none does
+func longestMatch(prefixes []netip.Prefix, addr netip.Addr) int {
+	longest := -1
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) && prefix.Bits() > longest {
+			longest = prefix.Bits()
+		}
+	}
+	return longest
+}
+
+// permits reports whether the list lets ip through. The most specific
+// matching entry decides, so an allowed host inside a denied network gets
+// through and a denied host inside an allowed network does not; a deny
+// wins over an allow of the same prefix. An address no entry matches is
+// only permitted while the allow list is empty.
+func (list accessList) permits(ip string) bool {
+	if len(list.allow) == 0 && len(list.deny) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return len(list.allow) == 0
+	}
+	addr = addr.Unmap()
+	allowed, denied := longestMatch(list.allow, addr), longestMatch(list.deny, addr)
+	if allowed < 0 && denied < 0 {
+		return len(list.allow) == 0
+	}
+	return allowed > denied
+}
+
+// permitClient applies the global access list to the client at ip
+func (r *Router) permitClient(ip string) bool {
+	r.mu.RLock()
+	access := r.access
+	r.mu.RUnlock()
+	return access.permits(ip)
+}
@@ -0,0 +1,89 @@
+package router
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAccessListPermits(t *testing.T) {
+	tests := []struct {
+		name        string
+		allow, deny []string
+		ip          string
+		want        bool
+	}{
+		{name: "empty lists", ip: "192.0.2.1", want: true},
+		{name: "allowed", allow: []string{"192.0.2.0/24"}, ip: "192.0.2.1", want: true},
+		{name: "outside allow list", allow: []string{"192.0.2.0/24"}, ip: "198.51.100.1", want: false},
+		{name: "denied", deny: []string{"192.0.2.0/24"}, ip: "192.0.2.1", want: false},
+		{name: "outside deny list", deny: []string{"192.0.2.0/24"}, ip: "198.51.100.1", want: true},
+		{name: "allowed host in denied network", allow: []string{"192.0.2.7"}, deny: []string{"192.0.2.0/24"}, ip: "192.0.2.7", want: true},
+		{name: "denied host in allowed network", allow: []string{"192.0.2.0/24"}, deny: []string{"192.0.2.7/32"}, ip: "192.0.2.7", want: false},
+		{name: "deny wins on equal prefix", allow: []string{"192.0.2.0/24"}, deny: []string{"192.0.2.0/24"}, ip: "192.0.2.1", want: false},
+		{name: "ipv4-mapped ipv6", allow: []string{"192.0.2.0/24"}, ip: "::ffff:192.0.2.1", want: true},
+		{name: "ipv6", allow: []string{"2001:db8::/32"}, ip: "2001:db8::1", want: true},
+		{name: "unparsable address with allow list", allow: []string{"192.0.2.0/24"}, ip: "unknown", want: false},
+		{name: "unparsable address with deny list", deny: []string{"192.0.2.0/24"}, ip: "unknown", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := parseAccessList(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := list.permits(tt.ip); got != tt.want {
+				t.Errorf("permits(%q) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessListRouting(t *testing.T) {
+	backend := newBackend(t, "api")
+	router := newTestRouter(t, &RouterConfig{
+		Deny: []string{"198.51.100.0/24"},
+		Rules: []Rule{
+			{Service: "internal", Destination: backend.URL, Allow: []string{"10.0.0.0/8"}},
+			{Service: "public", Destination: backend.URL},
+		},
+	})
+	tests := []struct {
+		service, remoteAddr string
+		status              int
+	}{
+		{"internal", "10.1.2.3:1234", http.StatusOK},
+		{"internal", "192.0.2.1:1234", http.StatusForbidden},
+		{"public", "192.0.2.1:1234", http.StatusOK},
+		{"public", "198.51.100.1:1234", http.StatusForbidden},
+		{"unknown", "198.51.100.1:1234", http.StatusForbidden}, // the global list applies before routing
+	}
+	for _, tt := range tests {
+		if rec, _ := serve(router, serviceRequest(tt.service, tt.remoteAddr)); rec.Code != tt.status {
+			t.Errorf("%s from %s = %d, want %d", tt.service, tt.remoteAddr, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestAccessListMalformed(t *testing.T) {
+	tests := []struct {
+		name, config, err string
+	}{
+		{"global allow", `{"allow": ["10.0.0.0/33"], "rules": []}`, `allow "10.0.0.0/33"`},
+		{"global deny", `{"deny": ["not-an-ip"], "rules": []}`, `deny "not-an-ip"`},
+		{"rule allow", `{"rules": [{"service": "api", "destination": "http://api:1", "allow": ["10.0.0/8"]}]}`, `allow "10.0.0/8"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(file, []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadConfig(file, false); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("loadConfig err = %v, want one mentioning %s", err, tt.err)
+			}
+		})
+	}
+}
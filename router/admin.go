@@ -0,0 +1,380 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// errRuleExists is returned when adding a rule for a service that already has one
+	errRuleExists = errors.New("rule already exists")
+	// errRuleNotFound is returned when no rule exists for a service
+	errRuleNotFound = errors.New("rule not found")
+	// errInterpolatedConfig is returned when saving a config loaded with
+	// ${VAR} references, which would be replaced with their values
+	errInterpolatedConfig = errors.New("config has ${VAR} references and cannot be saved")
+)
+
+// ListRules returns a copy of the router's current rules
+func (r *Router) ListRules() []Rule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Rule(nil), r.Rules...)
+}
+
+// AddRule appends a rule, failing if an equivalent rule already exists. A
+// timeoutMS on the rule is taken as its totalTimeoutMS.
+func (r *Router) AddRule(rule Rule) error {
+	_, err := r.addRule(rule)
+	return err
+}
+
+// addRule is AddRule, also returning a function that undoes the addition
+func (r *Router) addRule(rule Rule) (undo func(), err error) {
+	rule = upgradeRule(rule)
+	return r.editRules(func(rules []Rule) ([]Rule, error) {
+		for _, existing := range rules {
+			if existing.key() == rule.key() {
+				return nil, errRuleExists
+			}
+		}
+		return append(rules, rule), nil
+	})
+}
+
+// DeleteRule removes the rule whose key is id, or, if there is none, every
+// rule whose Service is id. Keys tell apart the rules of one service that
+// differ by host, path, methods or schedule, and name the rules without a
+// Service.
+func (r *Router) DeleteRule(id string) error {
+	_, err := r.deleteRule(id)
+	return err
+}
+
+// deleteRule is DeleteRule, also returning a function that undoes the deletion
+func (r *Router) deleteRule(id string) (undo func(), err error) {
+	return r.editRules(func(rules []Rule) ([]Rule, error) {
+		match := func(rule Rule) bool { return rule.key() == id }
+		if !slices.ContainsFunc(rules, match) {
+			match = func(rule Rule) bool { return rule.Service == id }
+		}
+		n := len(rules)
+		if rules = slices.DeleteFunc(rules, match); len(rules) == n {
+			return nil, errRuleNotFound
+		}
+		return rules, nil
+	})
+}
+
+// editRules replaces the rules with those edit makes of a copy of them. The
+// returned undo puts back the rules from before the edit, unless something
+// else, such as a reload, has replaced the edited rules in the meantime.
+func (r *Router) editRules(edit func(rules []Rule) ([]Rule, error)) (undo func(), err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	before := r.Rules
+	after, err := edit(slices.Clone(before))
+	if err != nil {
+		return nil, err
+	}
+	r.Rules = after
+	r.rulesVersion++
+	r.compile()
+	version := r.rulesVersion
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.rulesVersion == version {
+			r.Rules = before
+			r.rulesVersion++
+			r.compile()
+		}
+	}, nil
+}
+
+// SaveConfig writes the router's current configuration to filename. It
+// returns errInterpolatedConfig if the config was loaded with ${VAR}
+// references, as only their values would be written back.
+func (r *Router) SaveConfig(filename string) error {
+	r.mu.RLock()
+	if r.interpolated {
+		r.mu.RUnlock()
+		return errInterpolatedConfig
+	}
+	data, err := marshalConfig(filename, &r.RouterConfig)
+	r.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, data, 0644)
+}
+
+// configInterpolated reports whether the config was loaded with ${VAR} references
+func (r *Router) configInterpolated() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.interpolated
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Page sizes of GET /sessions
+const (
+	defaultSessionPageSize = 100
+	maxSessionPageSize     = 1000
+)
+
+// sessionPage is the response of GET /sessions
+type sessionPage struct {
+	Sessions []*Session `json:"sessions"`
+	Total    int        `json:"total"`
+	Offset   int        `json:"offset"`
+	Limit    int        `json:"limit"`
+}
+
+// queryInt parses the query parameter name of req as a non-negative integer
+func queryInt(req *http.Request, name string, defaultValue int) (int, error) {
+	value := req.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return n, nil
+}
+
+// keyPair is the body of POST /tls: a PEM certificate chain and its key
+type keyPair struct {
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
+// certificateInfo describes the certificate installed by POST /tls
+type certificateInfo struct {
+	Subject  string    `json:"subject"`
+	DNSNames []string  `json:"dnsNames,omitempty"`
+	NotAfter time.Time `json:"notAfter"`
+}
+
+// maxRuleBytes bounds the body of POST /rules
+const maxRuleBytes = 64 << 10
+
+// maxKeyPairBytes bounds the body of POST /tls
+const maxKeyPairBytes = 1 << 20
+
+// adminMux returns the admin API for managing the router's rules and
+// inspecting its sessions at runtime. When configFile is not empty, every
+// rule change is persisted back to it, and rule changes are refused with
+// 409 if the config uses ${VAR} references. A change that cannot be saved
+// is undone and answered with 500. certs, if not nil, is the served TLS
+// certificate, which POST /tls replaces.
+func adminMux(router *Router, sessions *SessionManager, configFile string, certs *certReloader) *http.ServeMux {
+	// edits serializes rule changes with their saving, so a change is only
+	// undone before another is made
+	var edits sync.Mutex
+	persist := func(w http.ResponseWriter, undo func()) bool {
+		if configFile == "" {
+			return true
+		}
+		if err := router.SaveConfig(configFile); err != nil {
+			undo()
+			writeJSONError(w, http.StatusInternalServerError, "save_failed", map[string]string{"detail": err.Error()})
+			return false
+		}
+		return true
+	}
+	// editable refuses rule changes that persist could not save, before
+	// they are made.
+	editable := func(w http.ResponseWriter) bool {
+		if configFile == "" || !router.configInterpolated() {
+			return true
+		}
+		writeJSONError(w, http.StatusConflict, "config_interpolated", map[string]string{"detail": errInterpolatedConfig.Error()})
+		return false
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", metricsHandler())
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, req *http.Request) {
+		if err := router.Ready(); err != nil {
+			writeJSONError(w, http.StatusServiceUnavailable, "config_not_ready", map[string]string{"detail": err.Error()})
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+	// /explain takes the X-Service-Type header of the request itself and the
+	// host, path and query string of the request to explain as query
+	// parameters.
+	mux.HandleFunc("GET /explain", func(w http.ResponseWriter, req *http.Request) {
+		probe := req.Clone(req.Context())
+		probe.URL.Path = "/"
+		probe.URL.RawQuery = req.URL.Query().Get("query")
+		if path := req.URL.Query().Get("path"); path != "" {
+			probe.URL.Path = path
+		}
+		if host := req.URL.Query().Get("host"); host != "" {
+			probe.Host = host
+		}
+		writeJSON(w, http.StatusOK, router.Explain(probe))
+	})
+	mux.HandleFunc("GET /rules", func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, http.StatusOK, router.ListRules())
+	})
+	mux.HandleFunc("POST /rules", func(w http.ResponseWriter, req *http.Request) {
+		if !editable(w) {
+			return
+		}
+		var rule Rule
+		if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxRuleBytes)).Decode(&rule); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, "payload_too_large", map[string]string{"limit": strconv.FormatInt(tooLarge.Limit, 10)})
+				return
+			}
+			writeJSONError(w, http.StatusBadRequest, "invalid_rule", map[string]string{"detail": err.Error()})
+			return
+		}
+		rule = upgradeRule(rule)
+		if err := validateRule(rule); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_rule", map[string]string{"detail": err.Error()})
+			return
+		}
+		edits.Lock()
+		defer edits.Unlock()
+		undo, err := router.addRule(rule)
+		if err != nil {
+			writeJSONError(w, http.StatusConflict, "rule_exists", map[string]string{"service": rule.key()})
+			return
+		}
+		if persist(w, undo) {
+			writeJSON(w, http.StatusCreated, rule)
+		}
+	})
+	// DELETE /rules/{id} takes a rule key, which may contain slashes, or a
+	// service; see DeleteRule.
+	mux.HandleFunc("DELETE /rules/{id...}", func(w http.ResponseWriter, req *http.Request) {
+		if !editable(w) {
+			return
+		}
+		id := req.PathValue("id")
+		edits.Lock()
+		defer edits.Unlock()
+		undo, err := router.deleteRule(id)
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, "rule_not_found", map[string]string{"id": id})
+			return
+		}
+		if persist(w, undo) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	mux.HandleFunc("POST /rules/{service}/switch", func(w http.ResponseWriter, req *http.Request) {
+		if !editable(w) {
+			return
+		}
+		service := req.PathValue("service")
+		edits.Lock()
+		defer edits.Unlock()
+		rule, undo, err := router.switchColor(service)
+		if errors.Is(err, errNotBlueGreen) {
+			writeJSONError(w, http.StatusConflict, "not_blue_green", map[string]string{"service": service})
+			return
+		}
+		if errors.Is(err, errNoColorDestination) {
+			writeJSONError(w, http.StatusConflict, "no_color_destination", map[string]string{"service": service, "active": rule.activeColor()})
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusNotFound, "service_not_found", map[string]string{"service": service})
+			return
+		}
+		if persist(w, undo) {
+			writeJSON(w, http.StatusOK, rule)
+		}
+	})
+	// POST /tls rotates the TLS certificate without touching the cert files;
+	// new connections are served the new pair as soon as it is accepted.
+	mux.HandleFunc("POST /tls", func(w http.ResponseWriter, req *http.Request) {
+		if certs == nil {
+			writeJSONError(w, http.StatusConflict, "tls_disabled", nil)
+			return
+		}
+		var pair keyPair
+		if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxKeyPairBytes)).Decode(&pair); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_key_pair", map[string]string{"detail": err.Error()})
+			return
+		}
+		leaf, err := certs.setKeyPair([]byte(pair.Cert), []byte(pair.Key))
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_key_pair", map[string]string{"detail": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, certificateInfo{Subject: leaf.Subject.String(), DNSNames: leaf.DNSNames, NotAfter: leaf.NotAfter})
+	})
+	mux.HandleFunc("GET /stats", statsHandler(router, sessions))
+	mux.HandleFunc("GET /conntrack", func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, http.StatusOK, sessions.ExportConntrack())
+	})
+	mux.HandleFunc("GET /sessions", func(w http.ResponseWriter, req *http.Request) {
+		offset, err := queryInt(req, "offset", 0)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_query", map[string]string{"detail": err.Error()})
+			return
+		}
+		limit, err := queryInt(req, "limit", defaultSessionPageSize)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid_query", map[string]string{"detail": err.Error()})
+			return
+		}
+		limit = min(limit, maxSessionPageSize)
+		page, total, err := sessions.ListSessions(offset, limit)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "session_store", map[string]string{"detail": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, sessionPage{Sessions: page, Total: total, Offset: offset, Limit: limit})
+	})
+	mux.HandleFunc("GET /sessions/{key}", func(w http.ResponseWriter, req *http.Request) {
+		key := req.PathValue("key")
+		session, ok, err := sessions.LookupSession(key)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "session_store", map[string]string{"detail": err.Error()})
+			return
+		}
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "session_not_found", map[string]string{"key": key})
+			return
+		}
+		writeJSON(w, http.StatusOK, session)
+	})
+	mux.HandleFunc("DELETE /sessions/{key}", func(w http.ResponseWriter, req *http.Request) {
+		key := req.PathValue("key")
+		ok, err := sessions.EvictSession(key)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "session_store", map[string]string{"detail": err.Error()})
+			return
+		}
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "session_not_found", map[string]string{"key": key})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
@@ -0,0 +1,216 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeleteRule(t *testing.T) {
+	rules := []Rule{
+		{Service: "api", Methods: []string{"GET"}, Destination: "http://replica:1"},
+		{Service: "api", Methods: []string{"POST"}, Destination: "http://primary:1"},
+		{Service: "web", Destination: "http://web:1"},
+		{Host: "example.com", PathPrefix: "/static", Destination: "http://static:1"},
+	}
+	tests := []struct {
+		id     string
+		status int
+		left   []string
+	}{
+		{id: "api@GET", status: http.StatusNoContent, left: []string{"api@POST", "web", "|example.com/static"}},
+		{id: "api", status: http.StatusNoContent, left: []string{"web", "|example.com/static"}},
+		{id: "|example.com/static", status: http.StatusNoContent, left: []string{"api@GET", "api@POST", "web"}},
+		{id: "missing", status: http.StatusNotFound, left: []string{"api@GET", "api@POST", "web", "|example.com/static"}},
+		{id: "api@PUT", status: http.StatusNotFound, left: []string{"api@GET", "api@POST", "web", "|example.com/static"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			router := newTestRouter(t, &RouterConfig{Rules: rules})
+			mux := adminMux(router, NewSessionManager(nil), "", nil)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/rules/"+tt.id, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("DELETE /rules/%s = %d %s, want %d", tt.id, rec.Code, rec.Body, tt.status)
+			}
+			var left []string
+			for _, rule := range router.ListRules() {
+				left = append(left, rule.key())
+			}
+			if !slices.Equal(left, tt.left) {
+				t.Errorf("rules left = %q, want %q", left, tt.left)
+			}
+		})
+	}
+}
+
+func TestReadyzFollowsReloads(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "router.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"rules":[{"service":"api","destination":"http://a:1"}]}`)
+	router, err := NewRouter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { router.Close() })
+	mux := adminMux(router, NewSessionManager(nil), file, nil)
+	probe := func(path string) int {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		readyz int
+	}{
+		{"loaded", "", http.StatusOK},
+		{"invalid JSON", `{"rules":[`, http.StatusServiceUnavailable},
+		{"fails validation", `{"rules":[{"service":"api"}]}`, http.StatusServiceUnavailable},
+		{"fixed", `{"rules":[{"service":"api","destination":"http://b:1"}]}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if tt.config != "" {
+			write(tt.config)
+			router.reload(file)
+		}
+		if got := probe("/readyz"); got != tt.readyz {
+			t.Errorf("%s: GET /readyz = %d, want %d", tt.name, got, tt.readyz)
+		}
+		if got := probe("/healthz"); got != http.StatusOK {
+			t.Errorf("%s: GET /healthz = %d, want 200", tt.name, got)
+		}
+	}
+	if got, _ := router.RouteRequest(serviceRequest("api", "")); got != "http://b:1" {
+		t.Errorf("routed to %q after the fix, want http://b:1", got)
+	}
+}
+
+func TestSessionsAPI(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: "http://a:1"}}})
+	sessions := NewSessionManager(nil, WithTTL(time.Hour))
+	for i := 1; i <= 5; i++ {
+		sessions.AddOrUpdateSession(&Session{DateTimeStamp: time.Now(), SourceIP: "192.0.2." + strconv.Itoa(i), SourcePort: "1000", Destination: "http://a:1"})
+	}
+	mux := adminMux(router, sessions, "", nil)
+	do := func(method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec
+	}
+
+	pages := []struct {
+		query  string
+		status int
+		keys   []string
+		limit  int
+	}{
+		{query: "", status: http.StatusOK, keys: []string{"192.0.2.1:1000", "192.0.2.2:1000", "192.0.2.3:1000", "192.0.2.4:1000", "192.0.2.5:1000"}, limit: defaultSessionPageSize},
+		{query: "?limit=2", status: http.StatusOK, keys: []string{"192.0.2.1:1000", "192.0.2.2:1000"}, limit: 2},
+		{query: "?limit=2&offset=4", status: http.StatusOK, keys: []string{"192.0.2.5:1000"}, limit: 2},
+		{query: "?offset=10", status: http.StatusOK, limit: defaultSessionPageSize},
+		{query: "?limit=5000", status: http.StatusOK, keys: []string{"192.0.2.1:1000", "192.0.2.2:1000", "192.0.2.3:1000", "192.0.2.4:1000", "192.0.2.5:1000"}, limit: maxSessionPageSize},
+		{query: "?limit=-1", status: http.StatusBadRequest},
+		{query: "?offset=x", status: http.StatusBadRequest},
+	}
+	for _, tt := range pages {
+		rec := do(http.MethodGet, "/sessions"+tt.query)
+		if rec.Code != tt.status {
+			t.Errorf("GET /sessions%s = %d %s, want %d", tt.query, rec.Code, rec.Body, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var page sessionPage
+		if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, s := range page.Sessions {
+			keys = append(keys, s.Key())
+		}
+		if !slices.Equal(keys, tt.keys) || page.Total != 5 || page.Limit != tt.limit {
+			t.Errorf("GET /sessions%s = keys %q, total %d, limit %d, want %q, 5, %d", tt.query, keys, page.Total, page.Limit, tt.keys, tt.limit)
+		}
+	}
+
+	rec := do(http.MethodGet, "/sessions/192.0.2.3:1000")
+	var session Session
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&session) != nil || session.SourceIP != "192.0.2.3" {
+		t.Errorf("GET /sessions/192.0.2.3:1000 = %d %+v", rec.Code, session)
+	}
+	if rec := do(http.MethodGet, "/sessions/192.0.2.9:1000"); rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "session_not_found") {
+		t.Errorf("GET of a missing session = %d %s, want 404", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodDelete, "/sessions/192.0.2.3:1000"); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE /sessions/192.0.2.3:1000 = %d %s, want 204", rec.Code, rec.Body)
+	}
+	if _, ok := sessions.GetSession("192.0.2.3:1000"); ok || sessions.Count() != 4 {
+		t.Errorf("after eviction the session is still stored; %d sessions", sessions.Count())
+	}
+	if rec := do(http.MethodDelete, "/sessions/192.0.2.3:1000"); rec.Code != http.StatusNotFound {
+		t.Errorf("second DELETE = %d, want 404", rec.Code)
+	}
+}
+
+func TestAdminUndoesUnsavedChanges(t *testing.T) {
+	rules := []Rule{
+		{Service: "api", Destination: "http://api:1"},
+		{Service: "web", Blue: "http://blue:1", Green: "http://green:1"},
+	}
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{name: "add", method: http.MethodPost, path: "/rules", body: `{"service":"new","destination":"http://new:1"}`},
+		{name: "delete", method: http.MethodDelete, path: "/rules/api"},
+		{name: "switch", method: http.MethodPost, path: "/rules/web/switch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, &RouterConfig{Rules: rules})
+			before := router.ListRules()
+			configFile := filepath.Join(t.TempDir(), "missing", "router.json")
+			mux := adminMux(router, NewSessionManager(nil), configFile, nil)
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+			if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), "save_failed") {
+				t.Fatalf("%s %s = %d %s, want 500 save_failed", tt.method, tt.path, rec.Code, rec.Body)
+			}
+			if after := router.ListRules(); !reflect.DeepEqual(after, before) {
+				t.Errorf("rules after failed save = %+v, want %+v", after, before)
+			}
+		})
+	}
+}
+
+func TestAdminRuleBodyLimit(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{})
+	mux := adminMux(router, NewSessionManager(nil), "", nil)
+	body := `{"service":"api","destination":"http://api:1","host":"` + strings.Repeat("a", maxRuleBytes) + `"}`
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rules", strings.NewReader(body)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("POST /rules with a %d byte body = %d %s, want 413", len(body), rec.Code, rec.Body)
+	}
+	if rules := router.ListRules(); len(rules) != 0 {
+		t.Errorf("rules = %+v, want none", rules)
+	}
+}
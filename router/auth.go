@@ -0,0 +1,76 @@
+package router
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// TokenValidator reports whether a bearer token may use the router
+type TokenValidator func(token string) bool
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header
+func bearerToken(req *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// tokenAllowed compares token against each entry of tokens in constant time
+func tokenAllowed(tokens []string, token string) bool {
+	allowed := false
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+// RequireToken only passes requests on to next if they carry one of tokens
+// as a bearer token, answering 401 Unauthorized otherwise
+func RequireToken(next http.Handler, tokens []string) http.Handler {
+	tokens = append([]string(nil), tokens...)
+	return RequireTokenFunc(next, func(token string) bool {
+		return tokenAllowed(tokens, token)
+	})
+}
+
+// RequireTokenFunc is like RequireToken but asks valid whether a token is accepted
+func RequireTokenFunc(next http.Handler, valid TokenValidator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if token, ok := bearerToken(req); !ok || !valid(token) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="go-router"`)
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized", nil)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// validToken reports whether token is one of the configured AuthTokens
+func (r *Router) validToken(token string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return tokenAllowed(r.AuthTokens, token)
+}
+
+// authenticate requires a bearer token from AuthTokens on requests to next.
+// The tokens are read on every request so config reloads take effect
+// immediately, and no token is required while AuthTokens is empty.
+func (r *Router) authenticate(next http.Handler) http.Handler {
+	protected := RequireTokenFunc(next, r.validToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.RLock()
+		enabled := len(r.AuthTokens) > 0
+		r.mu.RUnlock()
+		if !enabled {
+			next.ServeHTTP(w, req)
+			return
+		}
+		protected.ServeHTTP(w, req)
+	})
+}
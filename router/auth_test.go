@@ -0,0 +1,92 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRequireToken(t *testing.T) {
+	handler := RequireToken(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("ok"))
+	}), []string{"secret", "other"})
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong scheme", "Basic c2VjcmV0", http.StatusUnauthorized},
+		{"no token", "Bearer ", http.StatusUnauthorized},
+		{"no separator", "Bearersecret", http.StatusUnauthorized},
+		{"unknown token", "Bearer guess", http.StatusUnauthorized},
+		{"token prefix", "Bearer secre", http.StatusUnauthorized},
+		{"valid", "Bearer secret", http.StatusOK},
+		{"second token", "Bearer other", http.StatusOK},
+		{"scheme case", "bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec, _ := serve(handler, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestAuthTokensReload(t *testing.T) {
+	backend := newBackend(t, "a")
+	file := filepath.Join(t.TempDir(), "router.json")
+	load := func(tokens string) {
+		t.Helper()
+		config := `{"authTokens":` + tokens + `,"rules":[{"service":"api","destination":"` + backend.URL + `"}]}`
+		if err := os.WriteFile(file, []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	load(`[]`)
+	router, err := NewRouter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { router.Close() })
+	withToken := func(token string) int {
+		req := serviceRequest("api", "")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec, _ := serve(router, req)
+		return rec.Code
+	}
+
+	tests := []struct {
+		tokens string
+		token  string
+		status int
+	}{
+		{`[]`, "", http.StatusOK},
+		{`["first"]`, "", http.StatusUnauthorized},
+		{`["first"]`, "first", http.StatusOK},
+		{`["second"]`, "first", http.StatusUnauthorized},
+		{`["second"]`, "second", http.StatusOK},
+	}
+	for _, tt := range tests {
+		load(tt.tokens)
+		if err := router.reload(file); err != nil {
+			t.Fatal(err)
+		}
+		if code := withToken(tt.token); code != tt.status {
+			t.Errorf("tokens %s, request with %q = %d, want %d", tt.tokens, tt.token, code, tt.status)
+		}
+	}
+}
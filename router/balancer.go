@@ -0,0 +1,146 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// WeightedDestination is a destination address with a relative traffic weight
+type WeightedDestination struct {
+	Address string `json:"address" yaml:"address"`
+	Weight  int    `json:"weight" yaml:"weight"`
+}
+
+// strategy returns the rule's Strategy, defaulting to weighted selection
+// when the rule has weights and round-robin otherwise
+func (rule Rule) strategy() string {
+	switch {
+	case rule.Strategy != "":
+		return rule.Strategy
+	case len(rule.Weights) > 0:
+		return StrategyWeighted
+	}
+	return StrategyRoundRobin
+}
+
+// balancer returns the LoadBalancer of rule, creating it with the router's
+// factory on first use. It returns nil if the factory fails.
+func (r *Router) balancer(rule Rule) LoadBalancer {
+	if rule.Strategy == "" && len(rule.Weights) == 0 {
+		rule.Strategy = r.defaultStrategy
+	}
+	key := rule.key() + "|" + rule.strategy() + "|" + rule.HashHeader
+	if balancer, ok := r.balancers.Load(key); ok {
+		return balancer.(LoadBalancer)
+	}
+	factory := r.Balancers
+	if factory == nil {
+		factory = NewLoadBalancer
+	}
+	balancer, err := factory(rule)
+	if err != nil {
+		r.logger().Error("creating load balancer", "service", rule.key(), "error", err)
+		return nil
+	}
+	actual, _ := r.balancers.LoadOrStore(key, balancer)
+	return actual.(LoadBalancer)
+}
+
+// candidates returns the destinations of the rule that can take traffic:
+// the active color of a blue/green rule, the destinations with a positive
+// weight when the rule has weights, or else every destination weighing 1.
+// If every weight is zero the rule's addresses are all weighed evenly.
+// When none of those can take traffic the rule's Backup destinations are
+// offered instead.
+func (r *Router) candidates(rule Rule) []Destination {
+	var destinations []Destination
+	add := func(address string, weight int) {
+		if r.ready(address) {
+			destinations = append(destinations, Destination{Address: address, Weight: weight, Active: r.activeCount(address).Load()})
+		}
+	}
+	switch {
+	case rule.blueGreen():
+		add(rule.activeDestination(), 1)
+	case len(rule.Weights) > 0:
+		positive := slices.ContainsFunc(rule.Weights, func(wd WeightedDestination) bool { return wd.Weight > 0 })
+		for _, wd := range rule.Weights {
+			switch {
+			case !positive:
+				add(wd.Address, 1)
+			case wd.Weight > 0:
+				add(wd.Address, wd.Weight)
+			}
+		}
+	default:
+		for _, destination := range rule.pool() {
+			add(destination, 1)
+		}
+	}
+	if len(destinations) == 0 {
+		for _, destination := range rule.Backup {
+			add(destination, 1)
+		}
+	}
+	return destinations
+}
+
+// pickDestination returns the destination of the rule chosen for req by
+// the LoadBalancer of its strategy. Destinations that are unhealthy or whose
+// circuit is open are not offered; it returns "" if none is available.
+func (r *Router) pickDestination(rule Rule, req *http.Request) string {
+	destinations := r.candidates(rule)
+	if len(destinations) == 0 {
+		return ""
+	}
+	balancer := r.balancer(rule)
+	if balancer == nil {
+		return ""
+	}
+	for len(destinations) > 0 {
+		picked, err := balancer.Pick(destinations, req)
+		if err != nil {
+			return ""
+		}
+		if r.breaker.Allow(picked.Address) {
+			return picked.Address
+		}
+		// Another request took the half-open circuit's trial; pick again.
+		destinations = slices.DeleteFunc(destinations, func(d Destination) bool { return d.Address == picked.Address })
+	}
+	return ""
+}
+
+// ready reports whether destination is healthy and its circuit would allow a request
+func (r *Router) ready(destination string) bool {
+	return r.health.Load().Healthy(destination) && r.breaker.Ready(destination)
+}
+
+// activeCount returns the in-flight request counter of destination
+func (r *Router) activeCount(destination string) *atomic.Int64 {
+	counter, _ := r.active.LoadOrStore(destination, new(atomic.Int64))
+	return counter.(*atomic.Int64)
+}
+
+// trackActive counts a request to destination as in flight until the
+// returned function is called
+func (r *Router) trackActive(destination string) (done func()) {
+	counter := r.activeCount(destination)
+	counter.Add(1)
+	var once sync.Once
+	return func() { once.Do(func() { counter.Add(-1) }) }
+}
+
+// activeBody ends the in-flight count of a response once its body is closed
+type activeBody struct {
+	io.ReadCloser
+	done func()
+}
+
+func (b *activeBody) Close() error {
+	defer b.done()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,75 @@
+package router
+
+import (
+	"errors"
+	"slices"
+)
+
+// Colors of a blue/green rule
+const (
+	colorBlue  = "blue"
+	colorGreen = "green"
+)
+
+var (
+	// errNotBlueGreen is returned when switching a rule without Blue and Green destinations
+	errNotBlueGreen = errors.New("rule has no blue and green destinations")
+	// errNoColorDestination is returned when switching to a color without a destination
+	errNoColorDestination = errors.New("color has no destination")
+)
+
+// blueGreen reports whether the rule routes to one of Blue and Green
+func (rule Rule) blueGreen() bool {
+	return rule.Blue != "" || rule.Green != ""
+}
+
+// activeColor returns the color currently receiving traffic, blue by default
+func (rule Rule) activeColor() string {
+	if rule.Active == colorGreen {
+		return colorGreen
+	}
+	return colorBlue
+}
+
+// activeDestination returns the destination of the active color
+func (rule Rule) activeDestination() string {
+	if rule.activeColor() == colorGreen {
+		return rule.Green
+	}
+	return rule.Blue
+}
+
+// SwitchColor flips the active color of the blue/green rule for service and
+// returns the updated rule. It leaves the rule as it is, returning
+// errNoColorDestination, if the other color has no destination. Requests already being forwarded finish against
+// the old color; every request routed after the switch uses the new one.
+func (r *Router) SwitchColor(service string) (Rule, error) {
+	rule, _, err := r.switchColor(service)
+	return rule, err
+}
+
+// switchColor is SwitchColor, also returning a function that undoes the switch
+func (r *Router) switchColor(service string) (switched Rule, undo func(), err error) {
+	undo, err = r.editRules(func(rules []Rule) ([]Rule, error) {
+		i := slices.IndexFunc(rules, func(rule Rule) bool { return rule.Service == service })
+		if i < 0 {
+			return nil, errRuleNotFound
+		}
+		switched = rules[i]
+		if !switched.blueGreen() {
+			switched = Rule{}
+			return nil, errNotBlueGreen
+		}
+		switched.Active = colorGreen
+		if rules[i].activeColor() == colorGreen {
+			switched.Active = colorBlue
+		}
+		if switched.activeDestination() == "" {
+			switched = rules[i]
+			return nil, errNoColorDestination
+		}
+		rules[i] = switched
+		return rules, nil
+	})
+	return switched, undo, err
+}
@@ -0,0 +1,82 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSwitchColorMidTraffic(t *testing.T) {
+	blue, green := newBackend(t, "blue"), newBackend(t, "green")
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Blue: blue.URL, Green: green.URL}}})
+	mux := adminMux(router, NewSessionManager(nil), "", nil)
+
+	if _, got := serve(router, serviceRequest("api", "")); got != "blue" {
+		t.Fatalf("before the switch got %q, want blue", got)
+	}
+
+	var wg sync.WaitGroup
+	failures := make(chan int, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rec, got := serve(router, serviceRequest("api", "")); rec.Code != http.StatusOK || (got != "blue" && got != "green") {
+				failures <- rec.Code
+			}
+		}()
+		if i == 50 {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rules/api/switch", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("switch = %d %s", rec.Code, rec.Body)
+			}
+		}
+	}
+	wg.Wait()
+	close(failures)
+	for code := range failures {
+		t.Errorf("request during the switch failed with %d", code)
+	}
+	if _, got := serve(router, serviceRequest("api", "")); got != "green" {
+		t.Errorf("after the switch got %q, want green", got)
+	}
+
+	if _, err := router.SwitchColor("api"); err != nil {
+		t.Fatal(err)
+	}
+	if _, got := serve(router, serviceRequest("api", "")); got != "blue" {
+		t.Errorf("after switching back got %q, want blue", got)
+	}
+}
+
+func TestSwitchColorErrors(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Service: "blue-only", Blue: "http://blue:1"},
+		{Service: "plain", Destination: "http://plain:1"},
+	}})
+	mux := adminMux(router, NewSessionManager(nil), "", nil)
+	tests := []struct {
+		service string
+		status  int
+		code    string
+	}{
+		{"blue-only", http.StatusConflict, "no_color_destination"},
+		{"plain", http.StatusConflict, "not_blue_green"},
+		{"missing", http.StatusNotFound, "service_not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.service, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rules/"+tt.service+"/switch", nil))
+			if rec.Code != tt.status || !strings.Contains(rec.Body.String(), tt.code) {
+				t.Errorf("switch = %d %s, want %d %s", rec.Code, rec.Body, tt.status, tt.code)
+			}
+		})
+	}
+	if rule := router.ListRules()[0]; rule.activeColor() != colorBlue || rule.Active != "" {
+		t.Errorf("failed switch changed Active to %q", rule.Active)
+	}
+}
@@ -0,0 +1,58 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMaxBodyBytes(t *testing.T) {
+	var hits atomic.Int32
+	backend := newCountingBackend(t, "ok", http.StatusOK, &hits)
+	router := newTestRouter(t, &RouterConfig{
+		MaxBodyBytes: 10,
+		Rules: []Rule{
+			{Service: "api", Destination: backend.URL},
+			{Service: "upload", Destination: backend.URL, MaxBodyBytes: 100},
+		},
+	})
+	tests := []struct {
+		name    string
+		service string
+		size    int
+		chunked bool
+		status  int
+		reached bool
+	}{
+		{name: "under the limit", service: "api", size: 10, status: http.StatusOK, reached: true},
+		{name: "declared over the limit", service: "api", size: 11, status: http.StatusRequestEntityTooLarge},
+		{name: "streamed over the limit", service: "api", size: 11, chunked: true, status: http.StatusRequestEntityTooLarge},
+		{name: "rule override", service: "upload", size: 100, status: http.StatusOK, reached: true},
+		{name: "over the rule override", service: "upload", size: 101, chunked: true, status: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			var body io.Reader = strings.NewReader(strings.Repeat("a", tt.size))
+			if tt.chunked {
+				// Hiding the length leaves ContentLength unknown.
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/", body)
+			req.Header.Set("X-Service-Type", tt.service)
+			rec, _ := serve(router, req)
+			if rec.Code != tt.status {
+				t.Errorf("status = %d %s, want %d", rec.Code, rec.Body, tt.status)
+			}
+			if tt.status == http.StatusRequestEntityTooLarge && !strings.Contains(rec.Body.String(), "payload_too_large") {
+				t.Errorf("body = %s, want payload_too_large", rec.Body)
+			}
+			if !tt.chunked && (hits.Load() > 0) != tt.reached {
+				t.Errorf("backend reached = %v, want %v", hits.Load() > 0, tt.reached)
+			}
+		})
+	}
+}
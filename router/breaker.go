@@ -0,0 +1,146 @@
+package router
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreakerConfig sets when a destination's circuit opens and for how long
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the circuit
+	FailureThreshold int `json:"failureThreshold" yaml:"failureThreshold"`
+	// CooldownMS is how long an open circuit rejects traffic before a probe is allowed
+	CooldownMS int `json:"cooldownMS" yaml:"cooldownMS"`
+}
+
+// breakerState is the state of a single destination's circuit
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// destinationCircuit tracks the failures of one destination
+type destinationCircuit struct {
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// CircuitBreaker tracks consecutive failures per destination address. A
+// destination whose circuit is open is skipped until the cooldown elapses,
+// after which a single probe request is let through (half-open): success
+// closes the circuit, failure opens it again. A nil CircuitBreaker, or one
+// with a zero threshold, allows everything.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	config   CircuitBreakerConfig
+	circuits map[string]*destinationCircuit
+}
+
+// NewCircuitBreaker creates a CircuitBreaker with the given thresholds
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{
+		config:   config,
+		circuits: make(map[string]*destinationCircuit),
+	}
+}
+
+// Configure replaces the breaker's thresholds, keeping current circuit states
+func (cb *CircuitBreaker) Configure(config CircuitBreakerConfig) {
+	if cb == nil {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.config = config
+}
+
+// enabled reports whether the breaker is tracking failures. The caller must hold cb.mu.
+func (cb *CircuitBreaker) enabled() bool {
+	return cb.config.FailureThreshold > 0
+}
+
+// cooldown returns how long an open circuit stays open. The caller must hold cb.mu.
+func (cb *CircuitBreaker) cooldown() time.Duration {
+	return time.Duration(cb.config.CooldownMS) * time.Millisecond
+}
+
+// Ready reports whether a request to address would be allowed, without
+// claiming the half-open probe
+func (cb *CircuitBreaker) Ready(address string) bool {
+	if cb == nil {
+		return true
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c, ok := cb.circuits[address]
+	if !cb.enabled() || !ok {
+		return true
+	}
+	if c.state == breakerClosed {
+		return true
+	}
+	return time.Since(c.openedAt) >= cb.cooldown()
+}
+
+// Allow reports whether a request may be sent to address. Once an open
+// circuit's cooldown has elapsed, the first caller is allowed through as the
+// half-open probe and later callers are rejected until it reports back.
+func (cb *CircuitBreaker) Allow(address string) bool {
+	if cb == nil {
+		return true
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	c, ok := cb.circuits[address]
+	if !cb.enabled() || !ok {
+		return true
+	}
+	if c.state == breakerClosed {
+		return true
+	}
+	if time.Since(c.openedAt) < cb.cooldown() {
+		return false
+	}
+	// Restarting the clock means a probe that never reports back only
+	// blocks the destination for another cooldown.
+	c.state = breakerHalfOpen
+	c.openedAt = time.Now()
+	return true
+}
+
+// Success records a successful request to address, closing its circuit
+func (cb *CircuitBreaker) Success(address string) {
+	if cb == nil {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	delete(cb.circuits, address)
+}
+
+// Failure records a failed request to address, opening its circuit once the
+// threshold is reached or if the failure was the half-open probe
+func (cb *CircuitBreaker) Failure(address string) {
+	if cb == nil {
+		return
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if !cb.enabled() {
+		return
+	}
+	c, ok := cb.circuits[address]
+	if !ok {
+		c = &destinationCircuit{}
+		cb.circuits[address] = c
+	}
+	c.failures++
+	if c.state == breakerHalfOpen || c.failures >= cb.config.FailureThreshold {
+		c.state = breakerOpen
+		c.openedAt = time.Now()
+	}
+}
@@ -0,0 +1,114 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerStates(t *testing.T) {
+	const addr = "http://a:1"
+	cb := NewCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 3, CooldownMS: 20})
+	for i := 0; i < 2; i++ {
+		cb.Failure(addr)
+		if !cb.Allow(addr) {
+			t.Fatalf("circuit open after %d failures, want 3", i+1)
+		}
+	}
+	cb.Failure(addr)
+	if cb.Allow(addr) || cb.Ready(addr) {
+		t.Fatal("circuit still closed after 3 failures")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !cb.Ready(addr) || !cb.Ready(addr) {
+		t.Fatal("circuit not ready once the cooldown elapsed")
+	}
+	if !cb.Allow(addr) {
+		t.Fatal("half-open probe not allowed")
+	}
+	if cb.Allow(addr) {
+		t.Fatal("a second request was allowed while the probe is in flight")
+	}
+	cb.Failure(addr)
+	if cb.Allow(addr) {
+		t.Fatal("failed probe did not reopen the circuit")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if !cb.Allow(addr) {
+		t.Fatal("second probe not allowed")
+	}
+	cb.Success(addr)
+	for i := 0; i < 3; i++ {
+		if !cb.Allow(addr) {
+			t.Fatal("successful probe did not close the circuit")
+		}
+	}
+	cb.Failure(addr)
+	if !cb.Allow(addr) {
+		t.Error("a closed circuit opened on its first failure after recovering")
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	var nilBreaker *CircuitBreaker
+	for name, cb := range map[string]*CircuitBreaker{
+		"nil":            nilBreaker,
+		"zero threshold": NewCircuitBreaker(CircuitBreakerConfig{}),
+	} {
+		for i := 0; i < 5; i++ {
+			cb.Failure("http://a:1")
+		}
+		if !cb.Allow("http://a:1") {
+			t.Errorf("%s breaker rejected a request", name)
+		}
+	}
+}
+
+// TestCircuitBreakerRouting trips a backend's circuit through routed
+// requests and checks it receives traffic again after a successful probe
+func TestCircuitBreakerRouting(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var hits atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hits.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("flaky"))
+	}))
+	t.Cleanup(flaky.Close)
+	steady := newBackend(t, "steady")
+	router := newTestRouter(t, &RouterConfig{
+		CircuitBreaker: &CircuitBreakerConfig{FailureThreshold: 2, CooldownMS: 50},
+		Rules:          []Rule{{Service: "api", Destinations: []string{flaky.URL, steady.URL}}},
+	})
+
+	for i := 0; i < 4; i++ {
+		serve(router, serviceRequest("api", ""))
+	}
+	if hits.Load() != 2 {
+		t.Fatalf("flaky backend got %d requests before tripping, want 2", hits.Load())
+	}
+	for i := 0; i < 4; i++ {
+		if rec, got := serve(router, serviceRequest("api", "")); rec.Code != http.StatusOK || got != "steady" {
+			t.Fatalf("request with the circuit open = %d %q, want 200 from steady", rec.Code, got)
+		}
+	}
+
+	failing.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		_, got := serve(router, serviceRequest("api", ""))
+		seen[got] = true
+	}
+	if !seen["flaky"] || !seen["steady"] {
+		t.Errorf("after a successful probe got %v, want both backends", seen)
+	}
+}
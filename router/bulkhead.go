@@ -0,0 +1,204 @@
+package router
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// inFlightCounts tracks the requests currently being handled, in total and per rule
+type inFlightCounts struct {
+	total     atomic.Int64
+	byService sync.Map // rule key -> *atomic.Int64
+}
+
+// enter counts one more request on counter unless that exceeds limit,
+// reporting whether it did. A limit of zero or less means no limit.
+func enter(counter *atomic.Int64, limit int) bool {
+	if counter.Add(1) > int64(limit) && limit > 0 {
+		counter.Add(-1)
+		return false
+	}
+	return true
+}
+
+// acquire claims a slot for a request under rule within both the global
+// MaxConcurrent and the rule's own. The returned release must be called once
+// the request completes; ok is false, and release nil, if either is full.
+func (r *Router) acquire(rule Rule) (release func(), ok bool) {
+	r.mu.RLock()
+	limit := r.MaxConcurrent
+	r.mu.RUnlock()
+	if !enter(&r.inFlight.total, limit) {
+		return nil, false
+	}
+	v, _ := r.inFlight.byService.LoadOrStore(rule.key(), new(atomic.Int64))
+	counter := v.(*atomic.Int64)
+	if !enter(counter, rule.MaxConcurrent) {
+		r.inFlight.total.Add(-1)
+		return nil, false
+	}
+	return func() {
+		counter.Add(-1)
+		r.inFlight.total.Add(-1)
+		r.wakeQueued(rule.key())
+	}, true
+}
+
+// defaultQueueTimeout is how long a queued request waits for a slot when
+// its rule sets a QueueSize but no QueueTimeoutMS
+const defaultQueueTimeout = time.Second
+
+// requestQueue holds the requests of a rule waiting for a slot, in order of
+// arrival. Each waiter's channel is closed to wake it when a slot frees up.
+type requestQueue struct {
+	mu      sync.Mutex
+	waiters []chan struct{}
+}
+
+// join adds a waiter at the back of the queue, or at the front for one
+// that was woken but lost the slot, unless the queue already holds limit
+func (q *requestQueue) join(front bool, limit int) (chan struct{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !front && len(q.waiters) >= limit {
+		return nil, false
+	}
+	ch := make(chan struct{})
+	if front {
+		q.waiters = slices.Insert(q.waiters, 0, ch)
+	} else {
+		q.waiters = append(q.waiters, ch)
+	}
+	return ch, true
+}
+
+// leave removes a waiter that gave up, reporting false if it had already
+// been woken
+func (q *requestQueue) leave(ch chan struct{}) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	i := slices.Index(q.waiters, ch)
+	if i < 0 {
+		return false
+	}
+	q.waiters = slices.Delete(q.waiters, i, i+1)
+	return true
+}
+
+// wake wakes the waiter at the front of the queue, reporting whether there was one
+func (q *requestQueue) wake() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.waiters) == 0 {
+		return false
+	}
+	close(q.waiters[0])
+	q.waiters = q.waiters[1:]
+	return true
+}
+
+// len returns how many requests are waiting
+func (q *requestQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiters)
+}
+
+// requestQueue returns the queue of the rule identified by key
+func (r *Router) requestQueue(key string) *requestQueue {
+	q, _ := r.queues.LoadOrStore(key, new(requestQueue))
+	return q.(*requestQueue)
+}
+
+// wakeQueued hands the slot just released under the rule identified by key
+// to the first request queued for that rule or, with none, for any other
+// rule, which may have been waiting on the global limit
+func (r *Router) wakeQueued(key string) {
+	if q, ok := r.queues.Load(key); ok && q.(*requestQueue).wake() {
+		return
+	}
+	r.queues.Range(func(_, q any) bool {
+		return !q.(*requestQueue).wake()
+	})
+}
+
+// acquireQueued is acquire for a rule with a QueueSize: when no slot is
+// free, the request waits its turn in the rule's queue for up to the rule's
+// QueueTimeoutMS, or until ctx ends. ok is false if the queue is full or the
+// wait ends without a slot.
+func (r *Router) acquireQueued(ctx context.Context, rule Rule) (release func(), ok bool) {
+	if rule.QueueSize <= 0 {
+		return r.acquire(rule)
+	}
+	q := r.requestQueue(rule.key())
+	if q.len() == 0 {
+		if release, ok := r.acquire(rule); ok {
+			return release, true
+		}
+	}
+	timeout := msOrDefault(rule.QueueTimeoutMS, defaultQueueTimeout)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ch, ok := q.join(false, rule.QueueSize)
+	if !ok {
+		return nil, false
+	}
+	// A slot may have freed up before we joined, with no one left to wake us.
+	if release, ok := r.acquire(rule); ok {
+		q.leave(ch)
+		return release, true
+	}
+	for {
+		select {
+		case <-ch:
+			if release, ok := r.acquire(rule); ok {
+				return release, true
+			}
+			// Another request took the slot; wait at the front for the next.
+			ch, _ = q.join(true, rule.QueueSize)
+		case <-timer.C:
+			return r.giveUp(q, ch, rule)
+		case <-ctx.Done():
+			return r.giveUp(q, ch, rule)
+		}
+	}
+}
+
+// giveUp leaves the queue at the end of a wait. A waiter woken as it gave up
+// still tries for the slot so that the wake is not lost.
+func (r *Router) giveUp(q *requestQueue, ch chan struct{}, rule Rule) (func(), bool) {
+	if q.leave(ch) {
+		return nil, false
+	}
+	if release, ok := r.acquire(rule); ok {
+		release()
+	}
+	return nil, false
+}
+
+// queuedByService returns how many requests are queued for each rule with any
+func (r *Router) queuedByService() map[string]int64 {
+	out := make(map[string]int64)
+	r.queues.Range(func(key, q any) bool {
+		if n := q.(*requestQueue).len(); n > 0 {
+			out[key.(string)] = int64(n)
+		}
+		return true
+	})
+	return out
+}
+
+// inFlightByService copies the nonzero per-rule in-flight counts
+func (r *Router) inFlightByService() map[string]int64 {
+	out := make(map[string]int64)
+	r.inFlight.byService.Range(func(key, counter any) bool {
+		if n := counter.(*atomic.Int64).Load(); n > 0 {
+			out[key.(string)] = n
+		}
+		return true
+	})
+	return out
+}
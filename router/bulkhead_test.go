@@ -0,0 +1,224 @@
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newBlockingBackend returns a backend that answers name once unblock is
+// closed, signalling each request it receives on the returned channel
+func newBlockingBackend(t *testing.T, name string, unblock <-chan struct{}) (*httptest.Server, <-chan struct{}) {
+	t.Helper()
+	entered := make(chan struct{}, 100)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		entered <- struct{}{}
+		<-unblock
+		io.WriteString(w, name)
+	}))
+	t.Cleanup(backend.Close)
+	return backend, entered
+}
+
+// saturate starts n requests from newReq through router and waits until the
+// backend holds all of them; wait blocks until they complete
+func saturate(t *testing.T, router http.Handler, entered <-chan struct{}, n int, newReq func() *http.Request) (wait func() []int) {
+	t.Helper()
+	var wg sync.WaitGroup
+	codes := make([]int, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec, _ := serve(router, newReq())
+			codes[i] = rec.Code
+		}()
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case <-entered:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of %d requests reached the backend", i, n)
+		}
+	}
+	return func() []int {
+		wg.Wait()
+		return codes
+	}
+}
+
+func TestMaxConcurrentPerRule(t *testing.T) {
+	unblock := make(chan struct{})
+	backend, entered := newBlockingBackend(t, "api", unblock)
+	other := newBackend(t, "other")
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Service: "api", Destination: backend.URL, MaxConcurrent: 2},
+		{Service: "other", Destination: other.URL},
+	}})
+
+	wait := saturate(t, router, entered, 2, func() *http.Request { return serviceRequest("api", "") })
+	if rec, _ := serve(router, serviceRequest("api", "")); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("request over the limit = %d, want 503", rec.Code)
+	}
+	if rec, got := serve(router, serviceRequest("other", "")); rec.Code != http.StatusOK || got != "other" {
+		t.Errorf("request to another service = %d %q, want 200 from other", rec.Code, got)
+	}
+	stats := router.Stats(nil)
+	if stats.InFlight != 2 || stats.InFlightByService["api"] != 2 {
+		t.Errorf("in flight = %d, by service %v, want 2 for api", stats.InFlight, stats.InFlightByService)
+	}
+
+	close(unblock)
+	for i, code := range wait() {
+		if code != http.StatusOK {
+			t.Errorf("held request %d = %d, want 200", i+1, code)
+		}
+	}
+	if rec, _ := serve(router, serviceRequest("api", "")); rec.Code != http.StatusOK {
+		t.Errorf("request after the others completed = %d, want 200", rec.Code)
+	}
+	if stats := router.Stats(nil); stats.InFlight != 0 || len(stats.InFlightByService) != 0 {
+		t.Errorf("in flight after completion = %d, by service %v", stats.InFlight, stats.InFlightByService)
+	}
+}
+
+func TestMaxConcurrentGlobal(t *testing.T) {
+	unblock := make(chan struct{})
+	backend, entered := newBlockingBackend(t, "api", unblock)
+	other := newBackend(t, "other")
+	router := newTestRouter(t, &RouterConfig{MaxConcurrent: 1, Rules: []Rule{
+		{Service: "api", Destination: backend.URL},
+		{Service: "other", Destination: other.URL},
+	}})
+
+	wait := saturate(t, router, entered, 1, func() *http.Request { return serviceRequest("api", "") })
+	if rec, _ := serve(router, serviceRequest("other", "")); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("request to another service over the global limit = %d, want 503", rec.Code)
+	}
+	close(unblock)
+	wait()
+	if rec, got := serve(router, serviceRequest("other", "")); rec.Code != http.StatusOK || got != "other" {
+		t.Errorf("request after recovery = %d %q, want 200 from other", rec.Code, got)
+	}
+}
+
+func TestMaxConcurrentQueue(t *testing.T) {
+	unblock := make(chan struct{})
+	backend, entered := newBlockingBackend(t, "api", unblock)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Service: "api", Destination: backend.URL, MaxConcurrent: 1, QueueSize: 1, QueueTimeoutMS: 5000},
+	}})
+
+	wait := saturate(t, router, entered, 1, func() *http.Request { return serviceRequest("api", "") })
+	queued := make(chan int)
+	go func() {
+		rec, _ := serve(router, serviceRequest("api", ""))
+		queued <- rec.Code
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for router.Stats(nil).QueuedByService["api"] != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("the second request was never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// The queue is full, so a third request fails at once.
+	if rec, _ := serve(router, serviceRequest("api", "")); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("request over the queue = %d, want 503", rec.Code)
+	}
+
+	close(unblock)
+	wait()
+	if code := <-queued; code != http.StatusOK {
+		t.Errorf("queued request = %d, want 200", code)
+	}
+}
+
+func TestMaxConcurrentQueueTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	backend, entered := newBlockingBackend(t, "api", unblock)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Service: "api", Destination: backend.URL, MaxConcurrent: 1, QueueSize: 1, QueueTimeoutMS: 20},
+	}})
+
+	saturate(t, router, entered, 1, func() *http.Request { return serviceRequest("api", "") })
+	start := time.Now()
+	if rec, _ := serve(router, serviceRequest("api", "")); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("queued request = %d, want 503 after the timeout", rec.Code)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Errorf("queued request failed after %s, before the timeout", waited)
+	}
+	if n := router.Stats(nil).QueuedByService["api"]; n != 0 {
+		t.Errorf("%d requests still queued after the timeout", n)
+	}
+}
+
+func TestRequestQueueOrder(t *testing.T) {
+	unblock := make(chan struct{})
+	entered := make(chan struct{}, 1)
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/first" {
+			entered <- struct{}{}
+			<-unblock
+			return
+		}
+		mu.Lock()
+		order = append(order, req.URL.Path)
+		mu.Unlock()
+	}))
+	t.Cleanup(backend.Close)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Service: "api", Destination: backend.URL, MaxConcurrent: 1, QueueSize: 3, QueueTimeoutMS: 5000},
+	}})
+	request := func(path string) *http.Request {
+		req := serviceRequest("api", "")
+		req.URL.Path = path
+		return req
+	}
+
+	wait := saturate(t, router, entered, 1, func() *http.Request { return request("/first") })
+	var wg sync.WaitGroup
+	for i, path := range []string{"/a", "/b", "/c"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rec, _ := serve(router, request(path)); rec.Code != http.StatusOK {
+				t.Errorf("%s = %d, want 200 once its turn came", path, rec.Code)
+			}
+		}()
+		// Queue them one by one so that their order is known.
+		deadline := time.Now().Add(5 * time.Second)
+		for router.Stats(nil).QueuedByService["api"] != int64(i+1) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s was never queued", path)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// The depth of the queue is reported by /stats.
+	rec := httptest.NewRecorder()
+	adminMux(router, NewSessionManager(nil), "", nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stats?format=json", nil))
+	var stats Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil || stats.QueuedByService["api"] != 3 {
+		t.Errorf("/stats queuedByService = %v, %v, want api: 3", stats.QueuedByService, err)
+	}
+
+	close(unblock)
+	wait()
+	wg.Wait()
+	if want := []string{"/a", "/b", "/c"}; !slices.Equal(order, want) {
+		t.Errorf("queued requests ran in the order %q, want %q", order, want)
+	}
+}
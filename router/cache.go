@@ -0,0 +1,223 @@
+package router
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCacheEntries is the cache capacity when CacheEntries is unset
+	defaultCacheEntries = 1024
+	// maxCachedBody is the largest response body that is cached
+	maxCachedBody = 1 << 20
+)
+
+// cachedResponse is a stored upstream response
+type cachedResponse struct {
+	key     string
+	base    string // key without the vary header values
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// responseCache is an LRU cache of GET responses for rules with a CacheTTLMS.
+// Responses that set Vary are stored per value of the headers they vary on.
+type responseCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List               // of *cachedResponse, most recently used first
+	entries  map[string]*list.Element // full key -> element of order
+	vary     map[string]*varyEntry    // base key -> vary headers of its responses
+}
+
+// varyEntry holds the header names the responses for a base key vary on,
+// with how many of them are cached, so that it goes once the last one does
+type varyEntry struct {
+	names   []string
+	entries int
+}
+
+// newResponseCache returns a cache holding up to capacity responses
+func newResponseCache(capacity int) *responseCache {
+	if capacity <= 0 {
+		capacity = defaultCacheEntries
+	}
+	return &responseCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		vary:     make(map[string]*varyEntry),
+	}
+}
+
+// cacheable reports whether the response to req may be stored in the cache
+// of rule. Requests carrying credentials are never shared between clients.
+func cacheable(rule Rule, req *http.Request) bool {
+	return rule.CacheTTLMS > 0 && req.Method == http.MethodGet && req.Header.Get("Authorization") == "" && !isUpgrade(req)
+}
+
+// servable reports whether req may be answered from the cache of rule:
+// cacheable GET requests, and HEAD requests, which get the headers of the
+// cached GET response
+func servable(rule Rule, req *http.Request) bool {
+	if req.Method != http.MethodHead {
+		return cacheable(rule, req)
+	}
+	get := *req
+	get.Method = http.MethodGet
+	return cacheable(rule, &get)
+}
+
+// baseKey identifies the resource req asks for under rule. Only GET
+// responses are stored, so HEAD requests share the key of GET.
+func baseKey(rule Rule, req *http.Request) string {
+	return rule.key() + " " + http.MethodGet + " " + normalizeHost(req.Host) + req.URL.RequestURI()
+}
+
+// fullKey extends base with the request's values of the vary headers
+func fullKey(base string, vary []string, req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(base)
+	for _, name := range vary {
+		b.WriteString("\n" + name + ": " + strings.Join(req.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// varyNames returns the header names listed in the Vary header of h
+func varyNames(h http.Header) []string {
+	var names []string
+	for _, field := range h.Values("Vary") {
+		for _, name := range strings.Split(field, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// storable reports whether an upstream response may be cached
+func storable(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Set-Cookie") != "" || isEventStream(resp.Header) {
+		return false
+	}
+	cacheControl := strings.ToLower(strings.Join(resp.Header.Values("Cache-Control"), ","))
+	if strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private") {
+		return false
+	}
+	return !strings.Contains(strings.Join(varyNames(resp.Header), ","), "*")
+}
+
+// serve writes the cached response for req to w, reporting whether there
+// was one. HEAD requests get its headers, with the Content-Length of its
+// body, and no body.
+func (c *responseCache) serve(w http.ResponseWriter, rule Rule, req *http.Request) bool {
+	if c == nil || !servable(rule, req) {
+		return false
+	}
+	base := baseKey(rule, req)
+	c.mu.Lock()
+	var vary []string
+	if entry, ok := c.vary[base]; ok {
+		vary = entry.names
+	}
+	key := fullKey(base, vary, req)
+	element, ok := c.entries[key]
+	if ok && time.Now().After(element.Value.(*cachedResponse).expires) {
+		c.remove(element)
+		ok = false
+	}
+	if !ok {
+		c.mu.Unlock()
+		return false
+	}
+	c.order.MoveToFront(element)
+	cached := element.Value.(*cachedResponse)
+	c.mu.Unlock()
+
+	for name, values := range cached.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.Header().Set("X-Cache", "HIT")
+	if req.Method == http.MethodHead {
+		w.Header().Set("Content-Length", strconv.Itoa(len(cached.body)))
+		w.WriteHeader(cached.status)
+		return true
+	}
+	w.WriteHeader(cached.status)
+	w.Write(cached.body)
+	return true
+}
+
+// fill stores resp for req if both allow it, and returns a response
+// equivalent to resp marked as a cache miss
+func (c *responseCache) fill(rule Rule, req *http.Request, resp *http.Response) *http.Response {
+	if c == nil || !cacheable(rule, req) {
+		return resp
+	}
+	resp.Header.Set("X-Cache", "MISS")
+	if !storable(resp) || resp.ContentLength > maxCachedBody {
+		return resp
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCachedBody+1))
+	rest := resp.Body
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), rest), rest}
+	if err != nil || len(body) > maxCachedBody {
+		return resp
+	}
+
+	header := resp.Header.Clone()
+	removeHopHeaders(header)
+	header.Del("X-Cache")
+	vary := varyNames(resp.Header)
+	base := baseKey(rule, req)
+	cached := &cachedResponse{
+		key:     fullKey(base, vary, req),
+		base:    base,
+		status:  resp.StatusCode,
+		header:  header,
+		body:    body,
+		expires: time.Now().Add(time.Duration(rule.CacheTTLMS) * time.Millisecond),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[cached.key]; ok {
+		c.remove(element)
+	}
+	entry, ok := c.vary[base]
+	if !ok {
+		entry = &varyEntry{}
+		c.vary[base] = entry
+	}
+	entry.names = vary
+	entry.entries++
+	c.entries[cached.key] = c.order.PushFront(cached)
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+	}
+	return resp
+}
+
+// remove drops element from the cache; the caller must hold c.mu
+func (c *responseCache) remove(element *list.Element) {
+	cached := element.Value.(*cachedResponse)
+	c.order.Remove(element)
+	delete(c.entries, cached.key)
+	if entry, ok := c.vary[cached.base]; ok {
+		if entry.entries--; entry.entries <= 0 {
+			delete(c.vary, cached.base)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	var hits atomic.Int32
+	backend := newCountingBackend(t, "api", http.StatusOK, &hits)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL, CacheTTLMS: 50}}})
+
+	check := func(step, wantCache string, wantHits int32) {
+		t.Helper()
+		rec, got := serve(router, serviceRequest("api", ""))
+		if rec.Code != http.StatusOK || got != "api:" {
+			t.Fatalf("%s: got %d %q, want 200 from api", step, rec.Code, got)
+		}
+		if cache := rec.Header().Get("X-Cache"); cache != wantCache {
+			t.Errorf("%s: X-Cache = %q, want %q", step, cache, wantCache)
+		}
+		if n := hits.Load(); n != wantHits {
+			t.Errorf("%s: backend hit %d times, want %d", step, n, wantHits)
+		}
+	}
+	check("first request", "MISS", 1)
+	check("second request", "HIT", 1)
+
+	req := serviceRequest("api", "")
+	req.Method = http.MethodHead
+	if rec, _ := serve(router, req); rec.Header().Get("X-Cache") != "HIT" || rec.Header().Get("Content-Length") != "4" {
+		t.Errorf("HEAD: X-Cache, Content-Length = %q, %q, want HIT, 4", rec.Header().Get("X-Cache"), rec.Header().Get("Content-Length"))
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	check("after expiry", "MISS", 2)
+	check("after refill", "HIT", 2)
+}
+
+func TestResponseCacheBypass(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  http.Header // set by the backend
+		request func(*http.Request)
+	}{
+		{name: "no-store", header: http.Header{"Cache-Control": {"no-store"}}},
+		{name: "private", header: http.Header{"Cache-Control": {"private, max-age=60"}}},
+		{name: "set-cookie", header: http.Header{"Set-Cookie": {"session=1"}}},
+		{name: "vary star", header: http.Header{"Vary": {"*"}}},
+		{name: "authorization", request: func(req *http.Request) { req.Header.Set("Authorization", "Bearer token") }},
+		{name: "post", request: func(req *http.Request) { req.Method = http.MethodPost }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				hits.Add(1)
+				for name, values := range tt.header {
+					w.Header()[name] = values
+				}
+				io.WriteString(w, "api")
+			}))
+			t.Cleanup(backend.Close)
+			router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL, CacheTTLMS: 60000}}})
+
+			for i := 0; i < 2; i++ {
+				req := serviceRequest("api", "")
+				if tt.request != nil {
+					tt.request(req)
+				}
+				if rec, _ := serve(router, req); rec.Header().Get("X-Cache") == "HIT" {
+					t.Errorf("request %d was served from the cache", i+1)
+				}
+			}
+			if n := hits.Load(); n != 2 {
+				t.Errorf("backend hit %d times, want 2", n)
+			}
+		})
+	}
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	var hits atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Vary", "Accept-Language")
+		io.WriteString(w, req.Header.Get("Accept-Language"))
+	}))
+	t.Cleanup(backend.Close)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL, CacheTTLMS: 60000}}})
+
+	get := func(language string) (string, string) {
+		req := serviceRequest("api", "")
+		req.Header.Set("Accept-Language", language)
+		rec, body := serve(router, req)
+		return rec.Header().Get("X-Cache"), body
+	}
+	for _, tt := range []struct{ language, cache string }{{"en", "MISS"}, {"fr", "MISS"}, {"en", "HIT"}, {"fr", "HIT"}} {
+		if cache, body := get(tt.language); cache != tt.cache || body != tt.language {
+			t.Errorf("Accept-Language %s: X-Cache, body = %q, %q, want %q, %q", tt.language, cache, body, tt.cache, tt.language)
+		}
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("backend hit %d times, want 2", n)
+	}
+}
+
+func TestResponseCacheEviction(t *testing.T) {
+	var hits atomic.Int32
+	backend := newCountingBackend(t, "api", http.StatusOK, &hits)
+	router := newTestRouter(t, &RouterConfig{
+		CacheEntries: 1,
+		Rules:        []Rule{{Service: "api", Destination: backend.URL, CacheTTLMS: 60000}},
+	})
+
+	get := func(path string) string {
+		req := serviceRequest("api", "")
+		req.URL.Path = path
+		rec, _ := serve(router, req)
+		return rec.Header().Get("X-Cache")
+	}
+	for _, tt := range []struct{ path, cache string }{{"/a", "MISS"}, {"/a", "HIT"}, {"/b", "MISS"}, {"/a", "MISS"}} {
+		if cache := get(tt.path); cache != tt.cache {
+			t.Errorf("GET %s: X-Cache = %q, want %q", tt.path, cache, tt.cache)
+		}
+	}
+}
+
+func TestResponseCacheVaryBounded(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Vary", "Accept-Language")
+		io.WriteString(w, req.Header.Get("Accept-Language"))
+	}))
+	t.Cleanup(backend.Close)
+	router := newTestRouter(t, &RouterConfig{
+		CacheEntries: 2,
+		Rules:        []Rule{{Service: "api", Destination: backend.URL, CacheTTLMS: 60000}},
+	})
+	get := func(query, language string) {
+		req := serviceRequest("api", "")
+		req.URL.RawQuery = query
+		req.Header.Set("Accept-Language", language)
+		serve(router, req)
+	}
+
+	// Every distinct query is a base key of its own, evicted in turn.
+	for i := 0; i < 50; i++ {
+		get("page="+strconv.Itoa(i), "en")
+	}
+	if n := len(router.cache.vary); n != 2 {
+		t.Errorf("%d base keys remembered for 2 cached responses, want 2", n)
+	}
+	// Variants of one base key share its entry until the last one goes.
+	get("page=x", "en")
+	get("page=x", "de")
+	if n := len(router.cache.vary); n != 1 {
+		t.Errorf("%d base keys remembered for two variants of one, want 1", n)
+	}
+	get("page=y", "en")
+	get("page=z", "en")
+	evicted := serviceRequest("api", "")
+	evicted.URL.RawQuery = "page=x"
+	if _, ok := router.cache.vary[baseKey(router.Rules[0], evicted)]; ok || len(router.cache.vary) != 2 {
+		t.Errorf("%d base keys remembered after evicting both variants of page=x (still there: %v), want 2", len(router.cache.vary), ok)
+	}
+}
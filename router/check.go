@@ -0,0 +1,113 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ruleLines returns the line each rule starts on in a config file, as far
+// as it can be determined. JSON is parsed as YAML for this, which it is
+// compatible with for config files.
+func ruleLines(data []byte) []int {
+	var doc yaml.Node
+	if yaml.Unmarshal(data, &doc) != nil || len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "rules" {
+			var lines []int
+			for _, rule := range root.Content[i+1].Content {
+				lines = append(lines, rule.Line)
+			}
+			return lines
+		}
+	}
+	return nil
+}
+
+// lineCol converts a byte offset in data to a 1-based line and column
+func lineCol(data []byte, offset int64) (line, col int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = strings.Count(string(before), "\n") + 1
+	col = int(offset) - strings.LastIndex(string(before), "\n")
+	return line, col
+}
+
+// CheckConfig loads and validates the config at filename, strictly if
+// strict is set, writing every problem found to w with the line of the
+// offending rule where known. It reports whether the config is valid.
+func CheckConfig(filename string, strict bool, w io.Writer) bool {
+	info, err := os.Stat(filename)
+	if err == nil && info.IsDir() {
+		config, err := loadConfigDir(filename, strict)
+		if err != nil {
+			fmt.Fprintln(w, err)
+			return false
+		}
+		for _, warning := range config.warnings {
+			fmt.Fprintf(w, "warning: %s\n", warning)
+		}
+		fmt.Fprintf(w, "%s: ok\n", filename)
+		return true
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(w, err)
+		return false
+	}
+	config := &RouterConfig{}
+	if err := unmarshalConfig(filename, data, config, strict); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			line, col := lineCol(data, syntaxErr.Offset)
+			fmt.Fprintf(w, "%s:%d:%d: %v\n", filename, line, col, err)
+		case errors.As(err, &typeErr):
+			line, col := lineCol(data, typeErr.Offset)
+			fmt.Fprintf(w, "%s:%d:%d: %v\n", filename, line, col, err)
+		default:
+			// YAML errors already name the line.
+			fmt.Fprintf(w, "%s: %v\n", filename, err)
+		}
+		return false
+	}
+	for _, warning := range config.warnings {
+		fmt.Fprintf(w, "warning: %s\n", warning)
+	}
+	err = config.Validate()
+	if err == nil {
+		fmt.Fprintf(w, "%s: ok\n", filename)
+		return true
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		fmt.Fprintf(w, "%s: %v\n", filename, err)
+		return false
+	}
+	if !isYAML(filename) {
+		// Stripping comments keeps every rule on its line.
+		if stripped, err := preprocessJSON(data, func(string) (string, bool) { return "", true }); err == nil {
+			data = stripped
+		}
+	}
+	lines := ruleLines(data)
+	for i, problem := range verr.Problems {
+		if rule := verr.Rules[i]; rule >= 0 && rule < len(lines) {
+			fmt.Fprintf(w, "%s:%d: %s\n", filename, lines[rule], problem)
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s\n", filename, problem)
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package router
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		data  string
+		ok    bool
+		lines []string
+	}{
+		{
+			name:  "valid",
+			file:  "router.json",
+			data:  `{"rules":[{"service":"api","destination":"http://a:1"}]}`,
+			ok:    true,
+			lines: []string{"router.json: ok"},
+		},
+		{
+			name:  "bad rules in JSON",
+			file:  "router.json",
+			data:  "{\n  // comments are allowed\n  \"rules\": [\n    {\"service\": \"api\", \"destination\": \"http://a:1\"},\n    {\"service\": \"web\"},\n    {\"service\": \"api\", \"destination\": \"http://b:1\"}\n  ]\n}\n",
+			lines: []string{"router.json:5: ", "router.json:6: "},
+		},
+		{
+			name:  "bad rule in YAML",
+			file:  "router.yaml",
+			data:  "rules:\n  - service: api\n    destination: http://a:1\n  - service: web\n    destination: \"::not a url\"\n",
+			lines: []string{"router.yaml:4: "},
+		},
+		{
+			name:  "JSON syntax error",
+			file:  "router.json",
+			data:  "{\n  \"rules\": [\n    {\"service\": \"api\",}\n  ]\n}\n",
+			lines: []string{"router.json:3:"},
+		},
+		{
+			name:  "JSON type error",
+			file:  "router.json",
+			data:  "{\n  \"rules\": \"api\"\n}\n",
+			lines: []string{"router.json:2:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(filename, []byte(tt.data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if ok := CheckConfig(filename, false, &out); ok != tt.ok {
+				t.Errorf("CheckConfig = %v, want %v\n%s", ok, tt.ok, out.String())
+			}
+			report := strings.ReplaceAll(out.String(), dir+string(filepath.Separator), "")
+			got := strings.Split(strings.TrimSpace(report), "\n")
+			if len(got) != len(tt.lines) {
+				t.Fatalf("report:\n%s\nwant %d lines", report, len(tt.lines))
+			}
+			for i, prefix := range tt.lines {
+				if !strings.HasPrefix(got[i], prefix) {
+					t.Errorf("line %d = %q, want prefix %q", i+1, got[i], prefix)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckConfigMissingFile(t *testing.T) {
+	var out bytes.Buffer
+	if CheckConfig(filepath.Join(t.TempDir(), "missing.json"), false, &out) || out.Len() == 0 {
+		t.Errorf("CheckConfig of a missing file passed or said nothing: %q", out.String())
+	}
+}
+
+// TestValidateFlag follows main's -validate path: parse the flag, then check
+// the config it names
+func TestValidateFlag(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "router.json")
+	if err := os.WriteFile(filename, []byte(`{"rules":[{"service":"api"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := parse([]string{"-validate", "-config", filename}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if !settings.Validate || CheckConfig(settings.ConfigFile, settings.StrictConfig, &out) {
+		t.Errorf("validate = %v, report %q, want the bad config rejected", settings.Validate, out.String())
+	}
+}
@@ -0,0 +1,110 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parsePrefixes parses CIDRs or bare IPs, such as trusted proxy hops or
+// access lists; kind names the entries in errors
+func parsePrefixes(kind string, entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("%s %q: %w", kind, entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: %w", kind, entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// containsAddr reports whether addr falls in any of prefixes
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedClient returns the client address recorded in X-Forwarded-For:
+// walking from the nearest hop outwards, the first hop that is not a trusted
+// proxy is the client. Only the peer that connected to the router is trusted
+// implicitly, so with no TrustedProxies the rightmost hop is used.
+func forwardedClient(header http.Header, trusted []netip.Prefix) (netip.Addr, bool) {
+	var hops []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			break
+		}
+		client = addr
+		if !containsAddr(trusted, addr) {
+			break
+		}
+	}
+	return client, client.IsValid()
+}
+
+// clientIPKey is the context key of the client IP resolved by clientAddr
+type clientIPKey struct{}
+
+// withClientIP returns req with ip recorded as the IP of its client
+func withClientIP(req *http.Request, ip string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), clientIPKey{}, ip))
+}
+
+// clientIP returns the client IP recorded by withClientIP, or else the IP
+// the request came from
+func clientIP(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	if ip, ok := req.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	ip, _ := splitRemoteAddr(req.RemoteAddr)
+	return ip
+}
+
+// clientAddr returns the IP and port identifying the client of req. When
+// TrustProxy is enabled the IP comes from X-Forwarded-For or X-Real-IP;
+// otherwise those headers are ignored so clients cannot spoof their address.
+func (r *Router) clientAddr(req *http.Request) (ip, port string) {
+	ip, port = splitRemoteAddr(req.RemoteAddr)
+	r.mu.RLock()
+	trust, trusted := r.TrustProxy, r.trustedProxies
+	r.mu.RUnlock()
+	if !trust {
+		return ip, port
+	}
+	if addr, ok := forwardedClient(req.Header, trusted); ok {
+		return addr.Unmap().String(), port
+	}
+	if addr, err := netip.ParseAddr(strings.TrimSpace(req.Header.Get("X-Real-IP"))); err == nil {
+		return addr.Unmap().String(), port
+	}
+	return ip, port
+}
@@ -0,0 +1,66 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientAddr(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustProxy     bool
+		trustedProxies []string
+		xff, realIP    string
+		want           string
+	}{
+		{name: "forged header ignored", xff: "203.0.113.9", realIP: "203.0.113.8", want: "10.0.0.1"},
+		{name: "no headers", trustProxy: true, want: "10.0.0.1"},
+		{name: "single hop", trustProxy: true, xff: "198.51.100.7", want: "198.51.100.7"},
+		{name: "rightmost hop without trusted proxies", trustProxy: true, xff: "203.0.113.9, 198.51.100.7", want: "198.51.100.7"},
+		{name: "trusted chain", trustProxy: true, trustedProxies: []string{"10.0.0.0/8"}, xff: "203.0.113.9, 198.51.100.7, 10.0.0.2", want: "198.51.100.7"},
+		{name: "forged leftmost hop", trustProxy: true, trustedProxies: []string{"10.0.0.0/8", "198.51.100.7"}, xff: "203.0.113.9, 198.51.100.7", want: "203.0.113.9"},
+		{name: "X-Real-IP", trustProxy: true, realIP: "198.51.100.7", want: "198.51.100.7"},
+		{name: "invalid X-Real-IP", trustProxy: true, realIP: "not an ip", want: "10.0.0.1"},
+		{name: "mapped IPv4", trustProxy: true, xff: "::ffff:198.51.100.7", want: "198.51.100.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, &RouterConfig{
+				TrustProxy:     tt.trustProxy,
+				TrustedProxies: tt.trustedProxies,
+				Rules:          []Rule{{Service: "api", Destination: "http://a:1"}},
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "10.0.0.1:5555"
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if ip, port := router.clientAddr(req); ip != tt.want || port != "5555" {
+				t.Errorf("clientAddr = %q, %q, want %q, 5555", ip, port, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionSourceIPBehindProxy(t *testing.T) {
+	backend := newBackend(t, "a")
+	for _, trust := range []bool{false, true} {
+		sessions := NewSessionManager(nil)
+		router := newTestRouter(t, &RouterConfig{TrustProxy: trust, Rules: []Rule{{Service: "api", Destination: backend.URL}}}, WithSessions(sessions))
+		req := serviceRequest("api", "10.0.0.1:5555")
+		req.Header.Set("X-Forwarded-For", "198.51.100.7")
+		serve(router, req)
+
+		want := "10.0.0.1"
+		if trust {
+			want = "198.51.100.7"
+		}
+		if _, ok := sessions.GetSession(sessionKey(want, "5555")); !ok {
+			t.Errorf("TrustProxy %v: no session for %s; sessions = %v", trust, want, sessions.Snapshot())
+		}
+	}
+}
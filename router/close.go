@@ -0,0 +1,60 @@
+package router
+
+import (
+	"context"
+	"errors"
+)
+
+// lifetime returns a context canceled with ctx or when the router is closed
+func (r *Router) lifetime(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(r.closing, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// goBackground runs f in a goroutine that Close waits for. f must return
+// once ctx is done; ctx is also canceled by Close.
+func (r *Router) goBackground(ctx context.Context, f func(context.Context)) {
+	ctx, cancel := r.lifetime(ctx)
+	r.background.Add(1)
+	go func() {
+		defer r.background.Done()
+		defer cancel()
+		f(ctx)
+	}()
+}
+
+// OnClose registers f to be called by Close, after the router's own
+// goroutines have stopped. Functions run in reverse order of registration,
+// so a resource registered after the ones it depends on is released first.
+func (r *Router) OnClose(f func() error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closers = append(r.closers, f)
+}
+
+// Close stops the router's background work: health checks, limiter
+// cleanup, config watching and signal reloads. It then runs the functions
+// registered with OnClose, such as the final session flush of Run, and
+// closes idle connections to destinations. Calling Close again does nothing
+// and returns the first call's error.
+func (r *Router) Close() error {
+	r.closeOnce.Do(func() {
+		r.closeRouter()
+		r.background.Wait()
+		r.mu.Lock()
+		closers := r.closers
+		r.closers = nil
+		r.mu.Unlock()
+		var errs []error
+		for i := len(closers) - 1; i >= 0; i-- {
+			errs = append(errs, closers[i]())
+		}
+		r.httpClient().CloseIdleConnections()
+		r.closeErr = errors.Join(errs...)
+	})
+	return r.closeErr
+}
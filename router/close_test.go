@@ -0,0 +1,80 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+func TestCloseStopsGoroutines(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	backend := newBackend(t, "api")
+	dir := t.TempDir()
+	file := filepath.Join(dir, "router.json")
+	config := `{"healthCheck":{"intervalMS":10},"rules":[{"service":"api","destination":"` + backend.URL + `","rateLimit":100}]}`
+	if err := os.WriteFile(file, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sessions := NewSessionManager(nil)
+	router, err := New(WithConfigFile(file), WithSessions(sessions), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	router.StartHealthChecks(ctx)
+	router.StartDNSRefresh(ctx)
+	router.StartLimiterCleanup(ctx, 10*time.Millisecond)
+	router.ReloadOnSignal(ctx, file, syscall.SIGHUP)
+	if err := router.Watch(file); err != nil {
+		t.Fatal(err)
+	}
+	sessionsFile := filepath.Join(dir, "sessions.json")
+	stop := sessions.StartAutoSave(sessionsFile, 10*time.Millisecond)
+	router.OnClose(func() error {
+		stop()
+		return sessions.FlushSessions(sessionsFile)
+	})
+	for i := 0; i < 10; i++ {
+		serve(router, serviceRequest("api", ""))
+	}
+
+	if err := router.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(sessionsFile); err != nil {
+		t.Errorf("sessions not flushed on Close: %v", err)
+	}
+	backend.Close()
+}
+
+func TestCloseIdempotent(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{})
+	var order []int
+	router.OnClose(func() error { order = append(order, 1); return nil })
+	router.OnClose(func() error { order = append(order, 2); return errors.New("closing 2") })
+	router.OnClose(func() error { order = append(order, 3); return nil })
+
+	first := router.Close()
+	if first == nil || first.Error() != "closing 2" {
+		t.Errorf("Close() = %v, want closing 2", first)
+	}
+	if !slices.Equal(order, []int{3, 2, 1}) {
+		t.Errorf("OnClose functions ran in order %v, want 3 2 1", order)
+	}
+	if again := router.Close(); again != first {
+		t.Errorf("second Close() = %v, want the first call's %v", again, first)
+	}
+	if len(order) != 3 {
+		t.Errorf("OnClose functions ran %d times in all, want once each", len(order))
+	}
+}
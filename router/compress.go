@@ -0,0 +1,207 @@
+package router
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// minCompressSize is the smallest response body worth compressing
+const minCompressSize = 1024
+
+// compressibleTypes are the media types, besides text/*, that compress well.
+// Everything else, such as images, archives and gRPC, is passed through.
+var compressibleTypes = map[string]bool{
+	"application/json":       true,
+	"application/javascript": true,
+	"application/xml":        true,
+	"application/xhtml+xml":  true,
+	"image/svg+xml":          true,
+}
+
+// compressible reports whether a body of contentType compresses well
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || compressibleTypes[mediaType] ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+// acceptedEncoding returns the compression the client accepts, preferring
+// gzip over deflate, or "" if it accepts neither
+func acceptedEncoding(req *http.Request) string {
+	accepted := make(map[string]bool)
+	for _, field := range req.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(field, ",") {
+			coding, params, _ := strings.Cut(part, ";")
+			q := 1.0
+			if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				q, _ = strconv.ParseFloat(value, 64)
+			}
+			accepted[strings.ToLower(strings.TrimSpace(coding))] = q > 0
+		}
+	}
+	for _, coding := range []string{"gzip", "deflate"} {
+		if accepted[coding] {
+			return coding
+		}
+	}
+	return ""
+}
+
+// compressWriter compresses the response body with encoding if the
+// response turns out to be worth it once its header is written. A body of
+// unknown length is held back until minCompressSize bytes of it arrive: if
+// the handler finishes or flushes before then, it is sent uncompressed, as
+// small bodies and streams of small chunks gain little from compression.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	head        bool
+	wroteHeader bool
+	held        bool   // the header and buf are held back
+	status      int    // the held back status
+	buf         []byte // the held back start of the body
+	enc         interface {
+		io.WriteCloser
+		Flush() error
+	}
+}
+
+// shouldCompress reports whether a response with status and header is compressed
+func (cw *compressWriter) shouldCompress(status int, header http.Header) bool {
+	if cw.head || status < 200 || status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusPartialContent {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" || !compressible(header.Get("Content-Type")) || isEventStream(header) {
+		return false
+	}
+	if length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && length < minCompressSize {
+		return false
+	}
+	return true
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	if status >= 200 {
+		cw.wroteHeader = true
+	}
+	if !cw.wroteHeader || !cw.shouldCompress(status, cw.Header()) {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if cw.Header().Get("Content-Length") == "" {
+		cw.held, cw.status = true, status
+		return
+	}
+	cw.startCompression(status)
+}
+
+// startCompression sends the header for a compressed body with status
+func (cw *compressWriter) startCompression(status int) {
+	header := cw.Header()
+	header.Del("Content-Length")
+	header.Set("Content-Encoding", cw.encoding)
+	header.Add("Vary", "Accept-Encoding")
+	if cw.encoding == "gzip" {
+		cw.enc = gzip.NewWriter(cw.ResponseWriter)
+	} else {
+		cw.enc, _ = flate.NewWriter(cw.ResponseWriter, flate.DefaultCompression)
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// release sends the held back header and start of the body, compressed or not
+func (cw *compressWriter) release(compress bool) error {
+	cw.held = false
+	buf := cw.buf
+	cw.buf = nil
+	if !compress {
+		cw.ResponseWriter.WriteHeader(cw.status)
+		_, err := cw.ResponseWriter.Write(buf)
+		return err
+	}
+	cw.startCompression(cw.status)
+	_, err := cw.enc.Write(buf)
+	return err
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.held {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < minCompressSize {
+			return len(p), nil
+		}
+		if err := cw.release(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.enc != nil {
+		return cw.enc.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// FlushError flushes buffered compressed data before flushing the response,
+// so streamed responses still reach the client as they arrive
+func (cw *compressWriter) FlushError() error {
+	if cw.held {
+		if err := cw.release(false); err != nil {
+			return err
+		}
+	}
+	if cw.enc != nil {
+		if err := cw.enc.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close sends a body still held back uncompressed, or finishes the
+// compressed body
+func (cw *compressWriter) close() error {
+	if cw.held {
+		return cw.release(false)
+	}
+	if cw.enc == nil {
+		return nil
+	}
+	return cw.enc.Close()
+}
+
+// compress compresses routed responses for clients accepting gzip or
+// deflate while Compression is enabled, picking up config reloads
+func (r *Router) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.RLock()
+		enabled := r.Compression
+		r.mu.RUnlock()
+		encoding := acceptedEncoding(req)
+		if !enabled || encoding == "" || isUpgrade(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, head: req.Method == http.MethodHead}
+		defer cw.close()
+		next.ServeHTTP(cw, req)
+	})
+}
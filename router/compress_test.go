@@ -0,0 +1,106 @@
+package router
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("compress me ", 200)
+	small := "tiny"
+	tests := []struct {
+		name          string
+		accept        string
+		contentType   string
+		body          string
+		contentLength bool
+		encoded       bool // the handler sets Content-Encoding: br itself
+		flushFirst    int  // flush after writing this many bytes, 0 for never
+		encoding      string
+	}{
+		{name: "large text", accept: "gzip", contentType: "text/plain", body: large, contentLength: true, encoding: "gzip"},
+		{name: "large json without length", accept: "gzip, deflate", contentType: "application/json", body: large, encoding: "gzip"},
+		{name: "deflate", accept: "deflate", contentType: "text/html; charset=utf-8", body: large, encoding: "deflate"},
+		{name: "gzip refused", accept: "gzip;q=0, deflate", contentType: "text/plain", body: large, encoding: "deflate"},
+		{name: "not accepted", accept: "br", contentType: "text/plain", body: large},
+		{name: "small with length", accept: "gzip", contentType: "text/plain", body: small, contentLength: true},
+		{name: "small without length", accept: "gzip", contentType: "text/plain", body: small},
+		{name: "binary", accept: "gzip", contentType: "image/png", body: large, contentLength: true},
+		{name: "already encoded", accept: "gzip", contentType: "text/plain", body: large, encoded: true, encoding: "br"},
+		{name: "flushed before the threshold", accept: "gzip", contentType: "text/plain", body: large, flushFirst: 10},
+		{name: "flushed after the threshold", accept: "gzip", contentType: "text/plain", body: large, flushFirst: minCompressSize, encoding: "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, &RouterConfig{Compression: true})
+			handler := router.compress(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.contentLength {
+					w.Header().Set("Content-Length", strconv.Itoa(len(tt.body)))
+				}
+				if tt.encoded {
+					w.Header().Set("Content-Encoding", "br")
+				}
+				body := tt.body
+				if tt.flushFirst > 0 {
+					io.WriteString(w, body[:tt.flushFirst])
+					http.NewResponseController(w).Flush()
+					body = body[tt.flushFirst:]
+				}
+				io.WriteString(w, body)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", tt.accept)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			resp := rec.Result()
+			encoding := resp.Header.Get("Content-Encoding")
+			if encoding != tt.encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", encoding, tt.encoding)
+			}
+			var body io.Reader = resp.Body
+			switch encoding {
+			case "gzip":
+				gz, err := gzip.NewReader(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = gz
+			case "deflate":
+				body = flate.NewReader(resp.Body)
+			}
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.body {
+				t.Errorf("body = %d bytes, want the %d written", len(got), len(tt.body))
+			}
+			if tt.encoding != "" && !tt.encoded && (resp.Header.Get("Content-Length") != "" || resp.Header.Get("Vary") != "Accept-Encoding") {
+				t.Errorf("compressed response headers = %v", resp.Header)
+			}
+		})
+	}
+}
+
+func TestCompressDisabled(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{})
+	handler := router.compress(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, strings.Repeat("a", 2*minCompressSize))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if encoding := rec.Header().Get("Content-Encoding"); encoding != "" {
+		t.Errorf("Content-Encoding = %q with compression disabled", encoding)
+	}
+}
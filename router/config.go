@@ -0,0 +1,178 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// isYAML reports whether filename has a YAML extension
+func isYAML(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// unmarshalConfig decodes data as YAML or JSON depending on filename's
+// extension, after expanding ${VAR} environment references in its values,
+// and migrates it to the current version. JSON configs may contain // and
+// /* */ comments. When strict, fields RouterConfig does not have are errors
+// rather than ignored, catching misspelled keys.
+func unmarshalConfig(filename string, data []byte, config *RouterConfig, strict bool) error {
+	if err := decodeConfig(filename, data, config, strict); err != nil {
+		return err
+	}
+	warnings, err := migrateConfig(config)
+	for _, warning := range warnings {
+		config.warnings = append(config.warnings, filename+": "+warning)
+	}
+	return err
+}
+
+// decodeConfig decodes data into config as unmarshalConfig describes,
+// noting in config whether any environment reference was expanded
+func decodeConfig(filename string, data []byte, config *RouterConfig, strict bool) error {
+	lookup := func(name string) (string, bool) {
+		config.interpolated = true
+		return os.LookupEnv(name)
+	}
+	if isYAML(filename) {
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		if doc.Kind == 0 {
+			return nil
+		}
+		if err := expandYAML(&doc, lookup); err != nil {
+			return err
+		}
+		if !strict {
+			return doc.Decode(config)
+		}
+		// Only a Decoder checks for unknown fields, so re-encode the
+		// expanded document for one.
+		expanded, err := yaml.Marshal(&doc)
+		if err != nil {
+			return err
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(expanded))
+		decoder.KnownFields(true)
+		return decoder.Decode(config)
+	}
+	data, err := preprocessJSON(data, lookup)
+	if err != nil {
+		return err
+	}
+	if !strict {
+		return json.Unmarshal(data, config)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return errors.New("unexpected data after the config object")
+	}
+	return nil
+}
+
+// marshalConfig encodes config as YAML or JSON depending on filename's extension
+func marshalConfig(filename string, config *RouterConfig) ([]byte, error) {
+	if isYAML(filename) {
+		return yaml.Marshal(config)
+	}
+	return json.MarshalIndent(config, "", "\t")
+}
+
+// isConfigFile reports whether name has a JSON or YAML extension
+func isConfigFile(name string) bool {
+	return isYAML(name) || strings.ToLower(filepath.Ext(name)) == ".json"
+}
+
+// configFiles returns the JSON and YAML files in dir in lexical order
+func configFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isConfigFile(entry.Name()) {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// loadConfigDir merges every config file in dir, in lexical order, into one
+// config. Rules are concatenated and a rule defined in two files is an
+// error; for other settings, later files override earlier ones. strict is
+// as for unmarshalConfig.
+func loadConfigDir(dir string, strict bool) (*RouterConfig, error) {
+	files, err := configFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no .json or .yaml config files", dir)
+	}
+	config := &RouterConfig{}
+	definedIn := make(map[string]string)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		rules := config.Rules
+		config.Rules, config.Version = nil, 0
+		if err := unmarshalConfig(file, data, config, strict); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, rule := range config.Rules {
+			if first, ok := definedIn[rule.key()]; ok {
+				return nil, fmt.Errorf("%s: rule %q already defined in %s", file, rule.key(), first)
+			}
+			definedIn[rule.key()] = file
+		}
+		config.Rules = append(rules, config.Rules...)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	config.compile()
+	return config, nil
+}
+
+// configModTime returns the modification time of a config file, or the
+// latest of the config files in a config directory
+func configModTime(filename string) (time.Time, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !info.IsDir() {
+		return info.ModTime(), nil
+	}
+	latest := info.ModTime() // changes when files are added or removed
+	files, err := configFiles(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,116 @@
+package router
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeConfigDir writes files, by name, into a new temporary directory
+func writeConfigDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadRouterFromDir(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		rules []string
+		def   string
+		err   string
+	}{
+		{
+			name: "clean merge",
+			files: map[string]string{
+				"20-web.yaml": "default: http://later:1\nrules:\n  - service: web\n    destination: http://web:1\n",
+				"10-api.json": `{"default":"http://first:1","rules":[{"service":"api","destination":"http://api:1"}]}`,
+				"30-jobs.yml": "rules:\n  - service: jobs\n    destination: http://jobs:1\n",
+				"README.md":   "not a config file",
+				"notes.json~": "{",
+			},
+			rules: []string{"api", "web", "jobs"},
+			def:   "http://later:1",
+		},
+		{
+			name: "conflicting service",
+			files: map[string]string{
+				"a.json": `{"rules":[{"service":"api","destination":"http://a:1"}]}`,
+				"b.yaml": "rules:\n  - service: api\n    destination: http://b:1\n",
+			},
+			err: `b.yaml: rule "api" already defined in`,
+		},
+		{
+			name:  "invalid file",
+			files: map[string]string{"a.json": `{"rules":[`},
+			err:   "a.json",
+		},
+		{
+			name:  "no config files",
+			files: map[string]string{"README.md": "rules live here"},
+			err:   "no .json or .yaml config files",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, err := LoadRouterFromDir(writeConfigDir(t, tt.files))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { router.Close() })
+			var services []string
+			for _, rule := range router.ListRules() {
+				services = append(services, rule.Service)
+			}
+			if !slices.Equal(services, tt.rules) || router.Default != tt.def {
+				t.Errorf("rules, default = %q, %q, want %q, %q", services, router.Default, tt.rules, tt.def)
+			}
+			checkRoutes(t, router, []routeCase{{service: "jobs", want: "http://jobs:1"}, {service: "other", want: tt.def}})
+		})
+	}
+}
+
+func TestStrictConfig(t *testing.T) {
+	files := map[string]string{
+		"router.json": `{"rules": [{"service": "api", "desination": "http://api:8080"}]}`,
+		"router.yaml": "rules:\n  - service: api\n    desination: http://api:8080\n",
+	}
+	dir := writeConfigDir(t, files)
+	for name := range files {
+		file := filepath.Join(dir, name)
+		var config RouterConfig
+		data, _ := os.ReadFile(file)
+		if err := unmarshalConfig(file, data, &config, false); err != nil || len(config.Rules) != 1 {
+			t.Errorf("%s: lenient decode = %+v, %v, want the misspelled field ignored", name, config.Rules, err)
+		}
+		if err := unmarshalConfig(file, data, &RouterConfig{}, true); err == nil || !strings.Contains(err.Error(), "desination") {
+			t.Errorf("%s: strict decode err = %v, want one naming desination", name, err)
+		}
+		if _, err := New(WithConfigFile(file), WithStrictConfig()); err == nil || !strings.Contains(err.Error(), "desination") {
+			t.Errorf("%s: New with WithStrictConfig err = %v, want one naming desination", name, err)
+		}
+	}
+	if _, err := loadConfigDir(writeConfigDir(t, map[string]string{"api.yaml": files["router.yaml"]}), true); err == nil || !strings.Contains(err.Error(), "desination") {
+		t.Errorf("strict directory load err = %v, want one naming desination", err)
+	}
+
+	// Known fields load as before.
+	valid := writeConfigDir(t, map[string]string{"router.json": `{"rules": [{"service": "api", "destination": "http://api:8080"}]}`})
+	if _, err := loadConfig(filepath.Join(valid, "router.json"), true); err != nil {
+		t.Errorf("strict load of a valid config: %v", err)
+	}
+}
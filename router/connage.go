@@ -0,0 +1,33 @@
+package router
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// connStartKey is the context key of the time a client connection was accepted
+type connStartKey struct{}
+
+// connContext records when each client connection was accepted, for
+// http.Server.ConnContext
+func connContext(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, connStartKey{}, time.Now())
+}
+
+// drainOldConnections answers requests on HTTP/1 connections older than
+// MaxConnectionAgeMS with Connection: close, so that keep-alive clients
+// reconnect, and re-resolve the router, at a request boundary instead of
+// having their connection reset. It picks up config reloads.
+func (r *Router) drainOldConnections(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.RLock()
+		maxAge := time.Duration(r.MaxConnectionAgeMS) * time.Millisecond
+		r.mu.RUnlock()
+		if start, ok := req.Context().Value(connStartKey{}).(time.Time); ok && maxAge > 0 && req.ProtoMajor == 1 && time.Since(start) >= maxAge {
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, req)
+	})
+}
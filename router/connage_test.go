@@ -0,0 +1,56 @@
+package router
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMaxConnectionAge(t *testing.T) {
+	backend := newBackend(t, "api")
+	router := newTestRouter(t, &RouterConfig{
+		MaxConnectionAgeMS: 100,
+		Rules:              []Rule{{Service: "api", Destination: backend.URL}},
+	})
+	server := httptest.NewUnstartedServer(router)
+	server.Config.ConnContext = connContext
+	server.Start()
+	t.Cleanup(server.Close)
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	responses := bufio.NewReader(conn)
+	send := func() *http.Response {
+		t.Helper()
+		io.WriteString(conn, "GET / HTTP/1.1\r\nHost: router\r\nX-Service-Type: api\r\n\r\n")
+		resp, err := http.ReadResponse(responses, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := send(); resp.StatusCode != http.StatusOK || resp.Close {
+		t.Fatalf("young connection = %d, close %v, want 200 kept alive", resp.StatusCode, resp.Close)
+	}
+	time.Sleep(150 * time.Millisecond)
+	resp := send()
+	// ReadResponse consumes Connection: close into resp.Close.
+	if resp.StatusCode != http.StatusOK || !resp.Close {
+		t.Errorf("connection past its age = %d, close %v, want 200 with Connection: close", resp.StatusCode, resp.Close)
+	}
+	// The server then closes the connection rather than waiting for more.
+	if _, err := responses.ReadByte(); err != io.EOF {
+		t.Errorf("read after the last response err = %v, want EOF", err)
+	}
+}
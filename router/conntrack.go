@@ -0,0 +1,90 @@
+package router
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ConntrackEntry describes a session the way conntrack describes a tracked
+// connection, for tooling that consumes connection tables
+type ConntrackEntry struct {
+	Protocol       string `json:"protocol"`
+	Src            string `json:"src"`
+	Sport          string `json:"sport"`
+	Dst            string `json:"dst"`
+	Dport          string `json:"dport"`
+	State          string `json:"state"`
+	AgeSeconds     int64  `json:"age"`
+	TimeoutSeconds int64  `json:"timeout"`
+	Service        string `json:"service"`
+}
+
+// Conntrack states of exported sessions: ESTABLISHED while the session is
+// within its TTL, TIME_WAIT once it expired and awaits the next sweep
+const (
+	conntrackEstablished = "ESTABLISHED"
+	conntrackTimeWait    = "TIME_WAIT"
+)
+
+// sessionProtocol returns the transport protocol of sessions recorded for
+// service: udp for UDPRoute keys, tcp for routed HTTP requests
+func sessionProtocol(service string) string {
+	if service == "udp" || strings.HasPrefix(service, "udp~") || strings.HasPrefix(service, "udp:") {
+		return "udp"
+	}
+	return "tcp"
+}
+
+// sessionDestination returns the destination address and port of session.
+// Sessions saved before the resolved address was recorded store the whole
+// destination in DestinationIP, so its port takes precedence over
+// DestinationPort.
+func sessionDestination(session *Session) (addr, port string) {
+	addr, port = session.DestinationIP, session.DestinationPort
+	u, err := parseDestination(addr)
+	if err != nil || u.Hostname() == "" {
+		return addr, port
+	}
+	switch {
+	case u.Port() != "":
+		port = u.Port()
+	case u.Scheme == "https":
+		port = "443"
+	}
+	return u.Hostname(), port
+}
+
+// conntrackEntry maps session to a conntrack entry as of now
+func (sm *SessionManager) conntrackEntry(session *Session, now time.Time) ConntrackEntry {
+	age := now.Sub(session.DateTimeStamp)
+	dst, dport := sessionDestination(session)
+	entry := ConntrackEntry{
+		Protocol:       sessionProtocol(session.RequestService),
+		Src:            session.SourceIP,
+		Sport:          session.SourcePort,
+		Dst:            dst,
+		Dport:          dport,
+		State:          conntrackEstablished,
+		AgeSeconds:     int64(age / time.Second),
+		TimeoutSeconds: int64((sm.TTL - age) / time.Second),
+		Service:        session.RequestService,
+	}
+	if entry.TimeoutSeconds <= 0 {
+		entry.State, entry.TimeoutSeconds = conntrackTimeWait, 0
+	}
+	return entry
+}
+
+// ExportConntrack returns the sessions as conntrack entries, ordered by
+// source address and port
+func (sm *SessionManager) ExportConntrack() []ConntrackEntry {
+	sessions := sm.Snapshot()
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Key() < sessions[j].Key() })
+	now := time.Now()
+	entries := make([]ConntrackEntry, 0, len(sessions))
+	for _, session := range sessions {
+		entries = append(entries, sm.conntrackEntry(session, now))
+	}
+	return entries
+}
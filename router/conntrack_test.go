@@ -0,0 +1,76 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestConntrackEntry(t *testing.T) {
+	sm := NewSessionManager(nil, WithTTL(time.Minute))
+	now := time.Now()
+	tests := []struct {
+		name    string
+		session Session
+		want    ConntrackEntry
+	}{
+		{
+			name: "http",
+			session: Session{DateTimeStamp: now.Add(-10 * time.Second), SourceIP: "192.0.2.2", SourcePort: "5000", RequestService: "api",
+				Destination: "http://api.internal:8080", DestinationIP: "10.0.0.1", DestinationPort: "8080"},
+			want: ConntrackEntry{Protocol: "tcp", Src: "192.0.2.2", Sport: "5000", Dst: "10.0.0.1", Dport: "8080", State: "ESTABLISHED", AgeSeconds: 10, TimeoutSeconds: 50, Service: "api"},
+		},
+		{
+			name: "expired, saved before the resolved address was recorded",
+			session: Session{DateTimeStamp: now.Add(-2 * time.Minute), SourceIP: "192.0.2.1", SourcePort: "4000", RequestService: "web",
+				DestinationIP: "https://web.internal"},
+			want: ConntrackEntry{Protocol: "tcp", Src: "192.0.2.1", Sport: "4000", Dst: "web.internal", Dport: "443", State: "TIME_WAIT", AgeSeconds: 120, Service: "web"},
+		},
+		{
+			name: "udp",
+			session: Session{DateTimeStamp: now, SourceIP: "192.0.2.3", SourcePort: "53", RequestService: `udp~"Q"`,
+				Destination: "10.0.0.53:53", DestinationIP: "10.0.0.53", DestinationPort: "53"},
+			want: ConntrackEntry{Protocol: "udp", Src: "192.0.2.3", Sport: "53", Dst: "10.0.0.53", Dport: "53", State: "ESTABLISHED", TimeoutSeconds: 60, Service: `udp~"Q"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sm.conntrackEntry(&tt.session, now); got != tt.want {
+				t.Errorf("conntrackEntry = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportConntrackOrder(t *testing.T) {
+	sm := NewSessionManager(nil)
+	for _, addr := range [][2]string{{"192.0.2.2", "80"}, {"192.0.2.1", "90"}, {"192.0.2.1", "100"}} {
+		sm.AddOrUpdateSession(&Session{DateTimeStamp: time.Now(), SourceIP: addr[0], SourcePort: addr[1]})
+	}
+	var got []string
+	for _, entry := range sm.ExportConntrack() {
+		got = append(got, entry.Src+":"+entry.Sport)
+	}
+	want := []string{"192.0.2.1:100", "192.0.2.1:90", "192.0.2.2:80"}
+	if !slices.Equal(got, want) {
+		t.Errorf("ExportConntrack order = %q, want %q", got, want)
+	}
+}
+
+func TestConntrackEndpoint(t *testing.T) {
+	sessions := NewSessionManager(nil)
+	sessions.AddOrUpdateSession(&Session{DateTimeStamp: time.Now(), SourceIP: "2001:db8::1", SourcePort: "443", RequestService: "api", DestinationIP: "10.0.0.1", DestinationPort: "80"})
+	mux := adminMux(newTestRouter(t, &RouterConfig{}), sessions, "", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/conntrack", nil))
+	var entries []ConntrackEntry
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK || len(entries) != 1 || entries[0].Src != "2001:db8::1" || entries[0].Dport != "80" {
+		t.Errorf("GET /conntrack = %d %+v", rec.Code, entries)
+	}
+}
@@ -0,0 +1,195 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig lets browser apps on other origins call the routed APIs. The
+// router answers preflight requests itself and owns the CORS headers of
+// responses, replacing any a destination sets.
+type CORSConfig struct {
+	// AllowedOrigins lists the origins, such as https://app.example.com,
+	// allowed to call; * allows any and https://*.example.com any
+	// subdomain
+	AllowedOrigins []string `json:"allowedOrigins,omitempty" yaml:"allowedOrigins,omitempty"`
+	// AllowedMethods defaults to GET, HEAD and POST
+	AllowedMethods []string `json:"allowedMethods,omitempty" yaml:"allowedMethods,omitempty"`
+	// AllowedHeaders lists the request headers callers may send beyond
+	// the CORS-safelisted ones; * allows any
+	AllowedHeaders []string `json:"allowedHeaders,omitempty" yaml:"allowedHeaders,omitempty"`
+	// ExposedHeaders lists the response headers scripts may read
+	ExposedHeaders []string `json:"exposedHeaders,omitempty" yaml:"exposedHeaders,omitempty"`
+	// AllowCredentials lets callers send cookies and HTTP auth
+	AllowCredentials bool `json:"allowCredentials,omitempty" yaml:"allowCredentials,omitempty"`
+	// MaxAgeSeconds is how long browsers may cache a preflight answer
+	MaxAgeSeconds int `json:"maxAgeSeconds,omitempty" yaml:"maxAgeSeconds,omitempty"`
+}
+
+// defaultCORSMethods are allowed when AllowedMethods is empty
+var defaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+
+// problems lists what is wrong with the CORS config
+func (c *CORSConfig) problems() []string {
+	var problems []string
+	for _, origin := range c.AllowedOrigins {
+		switch {
+		case origin == "*":
+			if c.AllowCredentials {
+				problems = append(problems, "origin * cannot be used with allowCredentials")
+			}
+		case !strings.Contains(origin, "://"):
+			problems = append(problems, fmt.Sprintf("origin %q has no scheme", origin))
+		case strings.Count(origin, "*") > 1 || strings.Contains(origin, "*") && !strings.Contains(origin, "://*."):
+			problems = append(problems, fmt.Sprintf("origin %q may only start its host with *.", origin))
+		}
+	}
+	if c.MaxAgeSeconds < 0 {
+		problems = append(problems, "negative maxAgeSeconds")
+	}
+	return problems
+}
+
+// matchOrigin reports whether origin matches pattern, an entry of AllowedOrigins
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+	scheme, suffix, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return strings.EqualFold(pattern, origin)
+	}
+	return len(origin) > len(scheme)+len(suffix) &&
+		strings.EqualFold(origin[:len(scheme)], scheme) &&
+		strings.EqualFold(origin[len(origin)-len(suffix):], suffix)
+}
+
+// allowsOrigin reports whether origin may call
+func (c *CORSConfig) allowsOrigin(origin string) bool {
+	return slices.ContainsFunc(c.AllowedOrigins, func(pattern string) bool { return matchOrigin(pattern, origin) })
+}
+
+// methods returns the allowed methods
+func (c *CORSConfig) methods() []string {
+	if len(c.AllowedMethods) == 0 {
+		return defaultCORSMethods
+	}
+	return c.AllowedMethods
+}
+
+// allowsHeaders reports whether every header of a preflight's
+// Access-Control-Request-Headers list may be sent
+func (c *CORSConfig) allowsHeaders(requested string) bool {
+	if slices.Contains(c.AllowedHeaders, "*") {
+		return true
+	}
+	for _, name := range strings.Split(requested, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !slices.ContainsFunc(c.AllowedHeaders, func(allowed string) bool { return strings.EqualFold(allowed, name) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// setOriginHeaders sets the headers allowing origin on both preflight and
+// actual responses
+func (c *CORSConfig) setOriginHeaders(h http.Header, origin string) {
+	if slices.Contains(c.AllowedOrigins, "*") {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if c.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// corsWriter replaces the CORS headers of a destination's response with
+// the router's as the response is written
+type corsWriter struct {
+	http.ResponseWriter
+	config      *CORSConfig
+	origin      string // empty when the origin is not allowed
+	wroteHeader bool
+}
+
+func (cw *corsWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		h := cw.Header()
+		for key := range h {
+			if strings.HasPrefix(key, "Access-Control-") {
+				delete(h, key)
+			}
+		}
+		if cw.origin != "" {
+			cw.config.setOriginHeaders(h, cw.origin)
+			if len(cw.config.ExposedHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(cw.config.ExposedHeaders, ", "))
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *corsWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (cw *corsWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// cors applies the config's CORS policy to requests carrying an Origin,
+// picking up config reloads. Preflight requests are answered without being
+// routed: 204 when the origin, method and headers asked for are allowed
+// and 403 otherwise. Other requests are routed either way, with the CORS
+// headers only when their origin is allowed.
+func (r *Router) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.RLock()
+		config := r.CORS
+		r.mu.RUnlock()
+		origin := req.Header.Get("Origin")
+		if config == nil || origin == "" {
+			next.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowed := config.allowsOrigin(origin)
+		method := req.Header.Get("Access-Control-Request-Method")
+		if req.Method == http.MethodOptions && method != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			requested := req.Header.Get("Access-Control-Request-Headers")
+			if !allowed || !slices.Contains(config.methods(), method) || !config.allowsHeaders(requested) {
+				r.writeError(w, http.StatusForbidden, "cors_not_allowed", map[string]string{"origin": origin, "method": method})
+				return
+			}
+			h := w.Header()
+			config.setOriginHeaders(h, origin)
+			h.Set("Access-Control-Allow-Methods", strings.Join(config.methods(), ", "))
+			if requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested)
+			}
+			if config.MaxAgeSeconds > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAgeSeconds))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		cw := &corsWriter{ResponseWriter: w, config: config}
+		if allowed {
+			cw.origin = origin
+		}
+		next.ServeHTTP(cw, req)
+	})
+}
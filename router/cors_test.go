@@ -0,0 +1,155 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"*", "https://anything.test", true},
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com", "HTTPS://APP.EXAMPLE.COM", true},
+		{"https://app.example.com", "http://app.example.com", false},
+		{"https://app.example.com", "https://app.example.com:8443", false},
+		{"https://*.example.org", "https://eu.example.org", true},
+		{"https://*.example.org", "https://a.b.example.org", true},
+		{"https://*.example.org", "https://example.org", false},
+		{"https://*.example.org", "https://evil-example.org", false},
+		{"https://*.example.org", "http://eu.example.org", false},
+	}
+	for _, tt := range tests {
+		if got := matchOrigin(tt.pattern, tt.origin); got != tt.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+// corsRequest returns a request for the api service from origin
+func corsRequest(method, origin string) *http.Request {
+	req := serviceRequest("api", "")
+	req.Method = method
+	req.Header.Set("Origin", origin)
+	return req
+}
+
+func TestCORSPreflight(t *testing.T) {
+	var hits atomic.Int32
+	backend := newCountingBackend(t, "api", http.StatusOK, &hits)
+	router := newTestRouter(t, &RouterConfig{
+		CORS: &CORSConfig{
+			AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+			AllowedMethods:   []string{http.MethodGet, http.MethodPut},
+			AllowedHeaders:   []string{"Authorization", "Content-Type"},
+			AllowCredentials: true,
+			MaxAgeSeconds:    600,
+		},
+		Rules: []Rule{{Service: "api", Destination: backend.URL}},
+	})
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		req := corsRequest(http.MethodOptions, origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+		if headers != "" {
+			req.Header.Set("Access-Control-Request-Headers", headers)
+		}
+		rec, _ := serve(router, req)
+		return rec
+	}
+
+	rec := preflight("https://app.example.com", http.MethodPut, "authorization, content-type")
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, PUT",
+		"Access-Control-Allow-Headers":     "authorization, content-type",
+		"Access-Control-Max-Age":           "600",
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("allowed preflight = %d %s, want 204", rec.Code, rec.Body)
+	}
+	for name, value := range want {
+		if got := rec.Header().Get(name); got != value {
+			t.Errorf("preflight %s = %q, want %q", name, got, value)
+		}
+	}
+	if vary := rec.Header().Values("Vary"); !slices.Contains(vary, "Origin") {
+		t.Errorf("preflight Vary = %q, want Origin", vary)
+	}
+	if rec := preflight("https://eu.example.org", http.MethodGet, ""); rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "https://eu.example.org" {
+		t.Errorf("preflight from a wildcard subdomain = %d, origin %q", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	refused := []struct {
+		name, origin, method, headers string
+	}{
+		{"disallowed origin", "https://evil.test", http.MethodGet, ""},
+		{"disallowed method", "https://app.example.com", http.MethodDelete, ""},
+		{"disallowed header", "https://app.example.com", http.MethodGet, "X-Debug"},
+	}
+	for _, tt := range refused {
+		rec := preflight(tt.origin, tt.method, tt.headers)
+		if rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: preflight = %d, origin %q, want 403 without CORS headers", tt.name, rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+		}
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("preflight requests reached the backend %d times, want never", n)
+	}
+}
+
+func TestCORSResponses(t *testing.T) {
+	// The backend sets CORS headers of its own, which the router replaces.
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("X-Total-Count", "3")
+		w.Write([]byte("api"))
+	}))
+	t.Cleanup(backend.Close)
+	router := newTestRouter(t, &RouterConfig{
+		CORS: &CORSConfig{
+			AllowedOrigins:   []string{"https://app.example.com"},
+			ExposedHeaders:   []string{"X-Total-Count"},
+			AllowCredentials: true,
+		},
+		Rules: []Rule{{Service: "api", Destination: backend.URL}},
+	})
+
+	rec, body := serve(router, corsRequest(http.MethodGet, "https://app.example.com"))
+	if rec.Code != http.StatusOK || body != "api" {
+		t.Fatalf("allowed request = %d %q, want 200 from api", rec.Code, body)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want the caller's origin", got)
+	}
+	if got := rec.Header().Get("Access-Control-Expose-Headers"); got != "X-Total-Count" {
+		t.Errorf("Access-Control-Expose-Headers = %q", got)
+	}
+
+	// Requests from other origins are still routed, without CORS headers,
+	// so that the browser withholds the response.
+	rec, body = serve(router, corsRequest(http.MethodGet, "https://evil.test"))
+	if rec.Code != http.StatusOK || body != "api" {
+		t.Errorf("request from a disallowed origin = %d %q, want it routed", rec.Code, body)
+	}
+	for name := range rec.Header() {
+		if strings.HasPrefix(name, "Access-Control-") {
+			t.Errorf("disallowed origin got %s: %q", name, rec.Header().Get(name))
+		}
+	}
+
+	// Any origin is answered with * when allowed.
+	router = newTestRouter(t, &RouterConfig{
+		CORS:  &CORSConfig{AllowedOrigins: []string{"*"}},
+		Rules: []Rule{{Service: "api", Destination: backend.URL}},
+	})
+	if rec, _ := serve(router, corsRequest(http.MethodGet, "https://anything.test")); rec.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("wildcard Access-Control-Allow-Origin = %q, want *", rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
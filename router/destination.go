@@ -0,0 +1,109 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"net/url"
+)
+
+// upstream is a destination parsed into the scheme, host and port requests
+// to it are sent to
+type upstream struct {
+	url    *url.URL
+	Scheme string
+	Host   string // without brackets around IPv6 addresses
+	Port   string // the explicit port, or the scheme's default
+}
+
+// defaultPort returns the port a scheme uses when a destination names none
+func defaultPort(scheme string) string {
+	if scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// parseUpstream parses destination, either a URL such as https://host:8443
+// or a host:port pair, which is sent plain HTTP
+func parseUpstream(destination string) (upstream, error) {
+	u, err := parseDestination(destination)
+	if err != nil {
+		return upstream{}, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return upstream{}, fmt.Errorf("destination %q has unsupported scheme %q", destination, u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return upstream{}, fmt.Errorf("destination %q has no host", destination)
+	}
+	port := u.Port()
+	if port == "" {
+		port = defaultPort(u.Scheme)
+	}
+	return upstream{url: u, Scheme: u.Scheme, Host: u.Hostname(), Port: port}, nil
+}
+
+// traceRemoteAddr returns a context under which the remote address of the
+// connection each request is sent over is stored in addr, so the last
+// attempt of a retried request leaves the address it was answered from
+func traceRemoteAddr(ctx context.Context, addr *string) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			*addr = info.Conn.RemoteAddr().String()
+		},
+	})
+}
+
+// resolvedAddr returns the IP and port destination was reached at: those
+// of connected, the remote address traced for the request, or when it is
+// unknown the host and port the destination names
+func resolvedAddr(rule Rule, destination, connected string) (ip, port string) {
+	if ip, port, err := net.SplitHostPort(connected); err == nil {
+		return ip, port
+	}
+	target, err := rule.upstream(destination)
+	if err != nil {
+		return destination, ""
+	}
+	return target.Host, target.Port
+}
+
+// allDestinations returns every destination the rule can send requests to,
+// including the inactive color, the mirror and the backups
+func (rule Rule) allDestinations() []string {
+	destinations := rule.pool()
+	for _, wd := range rule.Weights {
+		destinations = append(destinations, wd.Address)
+	}
+	for _, destination := range []string{rule.Blue, rule.Green, rule.Mirror} {
+		if destination != "" {
+			destinations = append(destinations, destination)
+		}
+	}
+	for _, destination := range rule.GeoDestinations {
+		destinations = append(destinations, destination)
+	}
+	return append(destinations, rule.Backup...)
+}
+
+// compileUpstreams parses the rule's destinations once, skipping any that
+// Validate reports
+func (rule *Rule) compileUpstreams() {
+	rule.upstreams = make(map[string]upstream)
+	for _, destination := range rule.allDestinations() {
+		if u, err := parseUpstream(destination); err == nil {
+			rule.upstreams[destination] = u
+		}
+	}
+}
+
+// upstream returns destination as parsed when the rule was compiled,
+// parsing it now if it is not one of the rule's own, as for the default rule
+func (rule Rule) upstream(destination string) (upstream, error) {
+	if u, ok := rule.upstreams[destination]; ok {
+		return u, nil
+	}
+	return parseUpstream(destination)
+}
@@ -0,0 +1,111 @@
+package router
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseUpstream(t *testing.T) {
+	tests := []struct {
+		destination        string
+		scheme, host, port string
+		err                string
+	}{
+		{destination: "http://api.internal", scheme: "http", host: "api.internal", port: "80"},
+		{destination: "http://api.internal:8080", scheme: "http", host: "api.internal", port: "8080"},
+		{destination: "https://api.internal", scheme: "https", host: "api.internal", port: "443"},
+		{destination: "https://api.internal:8443", scheme: "https", host: "api.internal", port: "8443"},
+		{destination: "api.internal:8080", scheme: "http", host: "api.internal", port: "8080"},
+		{destination: "10.0.0.1", scheme: "http", host: "10.0.0.1", port: "80"},
+		{destination: "[2001:db8::1]:8443", scheme: "http", host: "2001:db8::1", port: "8443"},
+		{destination: "https://[2001:db8::1]", scheme: "https", host: "2001:db8::1", port: "443"},
+		{destination: "ftp://files.internal", err: "unsupported scheme"},
+		{destination: "http://:8080", err: "no host"},
+	}
+	for _, tt := range tests {
+		u, err := parseUpstream(tt.destination)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseUpstream(%q) err = %v, want %q", tt.destination, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseUpstream(%q): %v", tt.destination, err)
+			continue
+		}
+		if u.Scheme != tt.scheme || u.Host != tt.host || u.Port != tt.port {
+			t.Errorf("parseUpstream(%q) = %s %s %s, want %s %s %s", tt.destination, u.Scheme, u.Host, u.Port, tt.scheme, tt.host, tt.port)
+		}
+	}
+}
+
+func TestForwardDestinationForms(t *testing.T) {
+	plain := newBackend(t, "plain")
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	t.Cleanup(secure.Close)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Service: "url", Destination: plain.URL},
+		{Service: "hostport", Destination: plain.Listener.Addr().String()},
+		{Service: "https", Destination: secure.URL},
+	}}, WithTLS(secure.Client().Transport.(*http.Transport).TLSClientConfig))
+
+	for service, want := range map[string]string{"url": "plain", "hostport": "plain", "https": "secure"} {
+		if rec, got := serve(router, serviceRequest(service, "")); rec.Code != http.StatusOK || got != want {
+			t.Errorf("%s: got %d %q, want 200 from %s", service, rec.Code, got, want)
+		}
+	}
+}
+
+func TestResolvedAddr(t *testing.T) {
+	rule := Rule{Service: "api", Destinations: []string{"https://api.internal:8443", "https://api.internal", "api.internal"}}
+	rule.compile()
+	tests := []struct {
+		destination, connected string
+		ip, port               string
+	}{
+		{"https://api.internal:8443", "", "api.internal", "8443"},
+		{"https://api.internal", "", "api.internal", "443"},
+		{"api.internal", "", "api.internal", "80"},
+		{"https://api.internal:8443", "10.0.0.5:8443", "10.0.0.5", "8443"},
+		{"https://api.internal:8443", "[2001:db8::5]:8443", "2001:db8::5", "8443"},
+		{"http://other.internal:9000", "", "other.internal", "9000"}, // not one of the rule's own
+	}
+	for _, tt := range tests {
+		if ip, port := resolvedAddr(rule, tt.destination, tt.connected); ip != tt.ip || port != tt.port {
+			t.Errorf("resolvedAddr(%q, %q) = %s, %s, want %s, %s", tt.destination, tt.connected, ip, port, tt.ip, tt.port)
+		}
+	}
+}
+
+func TestSessionDestinationPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:8443")
+	if err != nil {
+		t.Skipf("port 8443 unavailable: %v", err)
+	}
+	backend := &httptest.Server{Listener: listener, Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("api"))
+	})}}
+	backend.Start()
+	t.Cleanup(backend.Close)
+	sessions := NewSessionManager(nil)
+	// A DNS name is recorded as the address it resolved to.
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: "localhost:8443"}}}, WithSessions(sessions))
+
+	const client = "192.0.2.1:1234"
+	if rec, got := serve(router, serviceRequest("api", client)); rec.Code != http.StatusOK || got != "api" {
+		t.Fatalf("got %d %q, want 200 from api", rec.Code, got)
+	}
+	session, ok := sessions.GetSession(client)
+	if !ok {
+		t.Fatal("no session recorded")
+	}
+	if session.DestinationIP != "127.0.0.1" || session.DestinationPort != "8443" || session.Destination != "localhost:8443" {
+		t.Errorf("session destination = %s, %s:%s, want localhost:8443 at 127.0.0.1:8443", session.Destination, session.DestinationIP, session.DestinationPort)
+	}
+}
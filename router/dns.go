@@ -0,0 +1,187 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDNSTTL   = 30 * time.Second
+	defaultDNSGrace = 5 * time.Minute
+)
+
+// DNSConfig enables caching the resolution of destination hostnames
+type DNSConfig struct {
+	// TTLMS is how long a resolution is used before it is refreshed
+	TTLMS int `json:"ttlMS,omitempty" yaml:"ttlMS,omitempty"`
+	// GraceMS is how long the last good addresses keep being used while
+	// resolving a host fails
+	GraceMS int `json:"graceMS,omitempty" yaml:"graceMS,omitempty"`
+}
+
+// lookupFunc resolves host to its IP addresses
+type lookupFunc func(ctx context.Context, host string) ([]netip.Addr, error)
+
+// lookupHost resolves host with the system resolver
+func lookupHost(ctx context.Context, host string) ([]netip.Addr, error) {
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+// dnsEntry is the cached resolution of a host
+type dnsEntry struct {
+	addrs    []netip.Addr
+	resolved time.Time // of the last successful lookup
+	used     time.Time // by the last dial
+}
+
+// dnsCache resolves destination hostnames once per TTL instead of on every
+// new connection, refreshing them in the background. A nil dnsCache leaves
+// resolution to the dialer.
+type dnsCache struct {
+	lookup lookupFunc
+	ttl    time.Duration
+	grace  time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+// newDNSCache creates a dnsCache resolving hosts through lookup
+func newDNSCache(config DNSConfig, lookup lookupFunc) *dnsCache {
+	return &dnsCache{
+		lookup:  lookup,
+		ttl:     msOrDefault(config.TTLMS, defaultDNSTTL),
+		grace:   msOrDefault(config.GraceMS, defaultDNSGrace),
+		now:     time.Now,
+		entries: make(map[string]*dnsEntry),
+	}
+}
+
+// errNoAddresses is returned when a host resolves to no addresses
+var errNoAddresses = errors.New("no addresses")
+
+// resolve returns the addresses of host, looking it up only if its cached
+// resolution is older than the TTL. If the lookup fails, addresses resolved
+// within the grace period after the TTL are returned instead.
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+	now := c.now()
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	if ok {
+		entry.used = now
+	}
+	c.mu.Unlock()
+	if ok && now.Sub(entry.resolved) < c.ttl {
+		return entry.addrs, nil
+	}
+	return c.refresh(ctx, host)
+}
+
+// refresh looks host up and caches the result, falling back to the cached
+// addresses while they are within the grace period
+func (c *dnsCache) refresh(ctx context.Context, host string) ([]netip.Addr, error) {
+	addrs, err := c.lookup(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = &net.DNSError{Err: errNoAddresses.Error(), Name: host, IsNotFound: true}
+	}
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[host]
+	if err != nil {
+		if ok && now.Sub(entry.resolved) < c.ttl+c.grace {
+			return entry.addrs, nil
+		}
+		return nil, err
+	}
+	if !ok {
+		entry = &dnsEntry{used: now}
+		c.entries[host] = entry
+	}
+	entry.addrs, entry.resolved = addrs, now
+	return addrs, nil
+}
+
+// refreshAll re-resolves every cached host whose resolution is due to
+// expire before the next round, and forgets hosts that were not dialed
+// during the grace period
+func (c *dnsCache) refreshAll(ctx context.Context) {
+	now := c.now()
+	var due []string
+	c.mu.Lock()
+	for host, entry := range c.entries {
+		switch {
+		case now.Sub(entry.used) > c.grace:
+			delete(c.entries, host)
+		case now.Sub(entry.resolved) >= c.ttl/2:
+			due = append(due, host)
+		}
+	}
+	c.mu.Unlock()
+	for _, host := range due {
+		c.refresh(ctx, host)
+	}
+}
+
+// run refreshes the cache every half TTL until ctx is canceled
+func (c *dnsCache) run(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	ticker := time.NewTicker(c.ttl / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.refreshAll(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// dialer wraps dial so that hostnames are resolved through the cache and
+// each of their addresses is tried in turn
+func (c *dnsCache) dialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if c == nil {
+		return dial
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return dial(ctx, network, addr)
+		}
+		addrs, err := c.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var errs []error
+		for _, ip := range addrs {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, err)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, errors.Join(errs...)
+	}
+}
+
+// StartDNSRefresh refreshes cached destination resolutions in the
+// background if DNS caching is configured
+func (r *Router) StartDNSRefresh(ctx context.Context) {
+	if r.dns != nil {
+		r.goBackground(ctx, r.dns.run)
+	}
+}
@@ -0,0 +1,191 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubResolver answers lookups from a table that tests change as they go,
+// counting the lookups of each host
+type stubResolver struct {
+	mu      sync.Mutex
+	addrs   map[string][]netip.Addr
+	fail    bool
+	lookups map[string]int
+}
+
+func (s *stubResolver) lookup(_ context.Context, host string) ([]netip.Addr, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lookups == nil {
+		s.lookups = make(map[string]int)
+	}
+	s.lookups[host]++
+	if s.fail {
+		return nil, &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+	}
+	return s.addrs[host], nil
+}
+
+func (s *stubResolver) set(host string, addrs ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.addrs == nil {
+		s.addrs = make(map[string][]netip.Addr)
+	}
+	s.addrs[host] = nil
+	for _, addr := range addrs {
+		s.addrs[host] = append(s.addrs[host], netip.MustParseAddr(addr))
+	}
+}
+
+// newStubDNSCache returns a cache resolving through stub, with a clock
+// the test advances
+func newStubDNSCache(stub *stubResolver) (*dnsCache, func(time.Duration)) {
+	cache := newDNSCache(DNSConfig{TTLMS: 1000, GraceMS: 5000}, stub.lookup)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	return cache, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestDNSCacheTTL(t *testing.T) {
+	var stub stubResolver
+	stub.set("api.internal", "10.0.0.1")
+	cache, advance := newStubDNSCache(&stub)
+	resolve := func(step string, want ...string) {
+		t.Helper()
+		addrs, err := cache.resolve(context.Background(), "api.internal")
+		if err != nil {
+			t.Fatalf("%s: %v", step, err)
+		}
+		var got []string
+		for _, addr := range addrs {
+			got = append(got, addr.String())
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: resolved %v, want %v", step, got, want)
+		}
+	}
+
+	resolve("first", "10.0.0.1")
+	stub.set("api.internal", "10.0.0.2")
+	advance(500 * time.Millisecond)
+	resolve("within the TTL", "10.0.0.1")
+	if n := stub.lookups["api.internal"]; n != 1 {
+		t.Errorf("looked up %d times within the TTL, want 1", n)
+	}
+	advance(time.Second)
+	resolve("after the TTL", "10.0.0.2")
+}
+
+func TestDNSCacheGrace(t *testing.T) {
+	var stub stubResolver
+	stub.set("api.internal", "10.0.0.1")
+	cache, advance := newStubDNSCache(&stub)
+	if _, err := cache.resolve(context.Background(), "api.internal"); err != nil {
+		t.Fatal(err)
+	}
+
+	stub.fail = true
+	advance(3 * time.Second)
+	addrs, err := cache.resolve(context.Background(), "api.internal")
+	if err != nil || len(addrs) != 1 || addrs[0].String() != "10.0.0.1" {
+		t.Errorf("failed lookup within the grace period = %v, %v, want the last good 10.0.0.1", addrs, err)
+	}
+	advance(5 * time.Second)
+	var dnsErr *net.DNSError
+	if _, err := cache.resolve(context.Background(), "api.internal"); !errors.As(err, &dnsErr) {
+		t.Errorf("failed lookup after the grace period err = %v, want the DNS error", err)
+	}
+
+	stub.fail = false
+	stub.set("empty.internal")
+	if _, err := cache.resolve(context.Background(), "empty.internal"); !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("host with no addresses err = %v, want not found", err)
+	}
+	if _, err := cache.resolve(context.Background(), "10.0.0.9"); err != nil || stub.lookups["10.0.0.9"] != 0 {
+		t.Errorf("IP literal err = %v after %d lookups, want none", err, stub.lookups["10.0.0.9"])
+	}
+}
+
+func TestDNSCacheRefreshAll(t *testing.T) {
+	var stub stubResolver
+	stub.set("busy.internal", "10.0.0.1")
+	stub.set("idle.internal", "10.0.0.2")
+	cache, advance := newStubDNSCache(&stub)
+	cache.resolve(context.Background(), "busy.internal")
+	cache.resolve(context.Background(), "idle.internal")
+
+	// Past half the TTL both are refreshed ahead of expiring.
+	stub.set("busy.internal", "10.0.0.3")
+	advance(600 * time.Millisecond)
+	cache.refreshAll(context.Background())
+	if got := cache.entries["busy.internal"].addrs[0].String(); got != "10.0.0.3" {
+		t.Errorf("busy.internal refreshed to %s, want 10.0.0.3", got)
+	}
+
+	// A host not dialed for the grace period is forgotten.
+	for i := 0; i < 6; i++ {
+		advance(time.Second)
+		cache.resolve(context.Background(), "busy.internal")
+		cache.refreshAll(context.Background())
+	}
+	if _, ok := cache.entries["idle.internal"]; ok {
+		t.Error("idle.internal still cached after the grace period")
+	}
+	if _, ok := cache.entries["busy.internal"]; !ok {
+		t.Error("busy.internal forgotten while in use")
+	}
+}
+
+func TestDNSCacheDialer(t *testing.T) {
+	var stub stubResolver
+	stub.set("api.internal", "10.0.0.1", "10.0.0.2")
+	cache, _ := newStubDNSCache(&stub)
+	var dialed []string
+	dial := cache.dialer(func(_ context.Context, _, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		if addr == "10.0.0.1:8080" {
+			return nil, errors.New("connection refused")
+		}
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	})
+	conn, err := dial(context.Background(), "tcp", "api.internal:8080")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if !slices.Equal(dialed, []string{"10.0.0.1:8080", "10.0.0.2:8080"}) {
+		t.Errorf("dialed %v, want each address in turn", dialed)
+	}
+}
+
+func TestDNSCacheSessionIP(t *testing.T) {
+	backend := newBackend(t, "api")
+	_, port, _ := net.SplitHostPort(backend.Listener.Addr().String())
+	sessions := NewSessionManager(nil)
+	router := newTestRouter(t, &RouterConfig{
+		DNS:   &DNSConfig{},
+		Rules: []Rule{{Service: "api", Destination: "http://api.internal:" + port}},
+	}, WithSessions(sessions))
+	var stub stubResolver
+	stub.set("api.internal", "127.0.0.1")
+	router.dns.lookup = stub.lookup
+
+	const client = "192.0.2.1:1234"
+	if rec, got := serve(router, serviceRequest("api", client)); rec.Code != http.StatusOK || got != "api" {
+		t.Fatalf("got %d %q, want 200 from api", rec.Code, got)
+	}
+	if session, ok := sessions.GetSession(client); !ok || session.DestinationIP != "127.0.0.1" {
+		t.Errorf("session = %+v, want DestinationIP 127.0.0.1 as resolved", session)
+	}
+}
@@ -0,0 +1,124 @@
+//go:build linux && ebpf
+
+package router
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"golang.org/x/sys/unix"
+)
+
+// maxCountedDestinations caps the entries of the packet count map
+const maxCountedDestinations = 4096
+
+// packetCounter counts the IPv4 packets seen on every interface per
+// destination IP, using a socket filter attached to a raw packet socket
+// that keeps the counts in a BPF hash map
+type packetCounter struct {
+	counts  *ebpf.Map
+	program *ebpf.Program
+	fd      int
+}
+
+// countProgram builds the socket filter: it reads the destination address
+// of the IPv4 packet, increments its count in counts and drops the packet
+// from the socket, which never reads any.
+func countProgram(counts *ebpf.Map) asm.Instructions {
+	return asm.Instructions{
+		asm.Mov.Reg(asm.R6, asm.R1),  // LoadAbs reads the packet from R6
+		asm.LoadAbs(14+16, asm.Word), // Ethernet header, then IPv4 daddr
+		asm.StoreMem(asm.RFP, -4, asm.R0, asm.Word),
+		asm.LoadMapPtr(asm.R1, counts.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -4),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "first"),
+		asm.Mov.Imm(asm.R1, 1),
+		asm.StoreXAdd(asm.R0, asm.R1, asm.DWord),
+		asm.Ja.Label("drop"),
+		asm.StoreImm(asm.RFP, -16, 1, asm.DWord).WithSymbol("first"),
+		asm.LoadMapPtr(asm.R1, counts.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -4),
+		asm.Mov.Reg(asm.R3, asm.RFP),
+		asm.Add.Imm(asm.R3, -16),
+		asm.Mov.Imm(asm.R4, int32(ebpf.UpdateAny)),
+		asm.FnMapUpdateElem.Call(),
+		asm.Mov.Imm(asm.R0, 0).WithSymbol("drop"),
+		asm.Return(),
+	}
+}
+
+// htons converts a port or protocol number to network byte order
+func htons(v uint16) uint16 {
+	return binary.BigEndian.Uint16(binary.NativeEndian.AppendUint16(nil, v))
+}
+
+// newPacketCounter loads the counting program and attaches it. It needs
+// CAP_BPF and CAP_NET_RAW, or root.
+func newPacketCounter() (*packetCounter, error) {
+	counts, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "dest_packets",
+		Type:       ebpf.Hash,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: maxCountedDestinations,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating packet count map: %w", err)
+	}
+	program, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Name:         "count_packets",
+		Type:         ebpf.SocketFilter,
+		License:      "MIT",
+		Instructions: countProgram(counts),
+	})
+	if err != nil {
+		counts.Close()
+		return nil, fmt.Errorf("loading packet count program: %w", err)
+	}
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_CLOEXEC, int(htons(unix.ETH_P_IP)))
+	if err == nil {
+		if err = unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_ATTACH_BPF, program.FD()); err != nil {
+			unix.Close(fd)
+		}
+	}
+	if err != nil {
+		program.Close()
+		counts.Close()
+		return nil, fmt.Errorf("attaching packet count program: %w", err)
+	}
+	return &packetCounter{counts: counts, program: program, fd: fd}, nil
+}
+
+// Counts returns the packets counted so far per destination IP
+func (pc *packetCounter) Counts() (map[string]uint64, error) {
+	if pc == nil {
+		return nil, nil
+	}
+	out := make(map[string]uint64)
+	var key uint32
+	var count uint64
+	entries := pc.counts.Iterate()
+	for entries.Next(&key, &count) {
+		// LoadAbs converted the address to host byte order.
+		ip := netip.AddrFrom4([4]byte{byte(key >> 24), byte(key >> 16), byte(key >> 8), byte(key)})
+		out[ip.String()] = count
+	}
+	return out, entries.Err()
+}
+
+// Close detaches the program and releases its resources
+func (pc *packetCounter) Close() error {
+	if pc == nil {
+		return nil
+	}
+	err := unix.Close(pc.fd)
+	pc.program.Close()
+	pc.counts.Close()
+	return err
+}
@@ -0,0 +1,22 @@
+//go:build !(linux && ebpf)
+
+package router
+
+// packetCounter is only available on Linux in builds with the ebpf tag;
+// elsewhere no packets are counted
+type packetCounter struct{}
+
+// newPacketCounter returns no counter, since packet counting is not built in
+func newPacketCounter() (*packetCounter, error) {
+	return nil, nil
+}
+
+// Counts returns no counts
+func (pc *packetCounter) Counts() (map[string]uint64, error) {
+	return nil, nil
+}
+
+// Close does nothing
+func (pc *packetCounter) Close() error {
+	return nil
+}
@@ -0,0 +1,45 @@
+//go:build linux && ebpf
+
+package router
+
+import (
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+)
+
+func TestPacketCounter(t *testing.T) {
+	pc, err := newPacketCounter()
+	if errors.Is(err, ebpf.ErrNotSupported) || errors.Is(err, os.ErrPermission) {
+		t.Skipf("eBPF unavailable: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	conn, err := net.Dial("udp4", "127.0.0.1:9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn.Write([]byte("ping"))
+		counts, err := pc.Counts()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if counts["127.0.0.1"] > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no packets counted for 127.0.0.1, counts = %v", counts)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
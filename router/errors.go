@@ -0,0 +1,58 @@
+package router
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// defaultErrorContentType labels error bodies unless ErrorContentType overrides it
+const defaultErrorContentType = "application/json"
+
+// writeJSONError answers with status and a JSON body holding code under
+// "error" alongside the fields of detail, for example
+// {"error":"service_not_found","service":"foo"}. The body is labelled
+// application/json unless w already has a Content-Type.
+func writeJSONError(w http.ResponseWriter, status int, code string, detail map[string]string) {
+	body := make(map[string]string, len(detail)+1)
+	for key, value := range detail {
+		body[key] = value
+	}
+	body["error"] = code
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", defaultErrorContentType)
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError is writeJSONError using the configured ErrorContentType, or
+// writes the ErrorPage configured for status instead
+func (r *Router) writeError(w http.ResponseWriter, status int, code string, detail map[string]string) {
+	r.mu.RLock()
+	contentType := r.ErrorContentType
+	page, ok := r.ErrorPages[status]
+	r.mu.RUnlock()
+	if ok {
+		writeErrorPage(w, status, page)
+		return
+	}
+	if contentType == "" {
+		contentType = defaultErrorContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	writeJSONError(w, status, code, detail)
+}
+
+// writeErrorPage answers with status and the body of page
+func writeErrorPage(w http.ResponseWriter, status int, page ErrorPage) {
+	contentType := page.ContentType
+	if contentType == "" {
+		contentType = defaultErrorPageType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	io.WriteString(w, page.Body)
+}
@@ -0,0 +1,75 @@
+package router
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestErrorEnvelope(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	slow := newSlowBackend(t, time.Second)
+	limited := newBackend(t, "limited")
+	rules := []Rule{
+		{Service: "down", Destination: down.URL},
+		{Service: "slow", Destination: slow.URL, TotalTimeoutMS: 20},
+		{Service: "limited", Destination: limited.URL, RateLimit: 0.001, Burst: 1},
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		service     string
+		status      int
+		want        map[string]string
+	}{
+		{name: "404", service: "foo", status: http.StatusNotFound, want: map[string]string{"error": "service_not_found", "service": "foo"}},
+		{name: "502", service: "down", status: http.StatusBadGateway, want: map[string]string{"error": "bad_gateway", "service": "down", "reason": reasonRefused}},
+		{name: "504", service: "slow", status: http.StatusGatewayTimeout, want: map[string]string{"error": "gateway_timeout", "service": "slow", "reason": reasonTimeout}},
+		{name: "429", service: "limited", status: http.StatusTooManyRequests, want: map[string]string{"error": "too_many_requests", "service": "limited"}},
+		{name: "configured content type", contentType: "application/problem+json", service: "foo", status: http.StatusNotFound, want: map[string]string{"error": "service_not_found", "service": "foo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, &RouterConfig{ErrorContentType: tt.contentType, Rules: rules})
+			if tt.status == http.StatusTooManyRequests {
+				serve(router, serviceRequest(tt.service, ""))
+			}
+			rec, _ := serve(router, serviceRequest(tt.service, ""))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d %s, want %d", rec.Code, rec.Body, tt.status)
+			}
+			wantType := tt.contentType
+			if wantType == "" {
+				wantType = defaultErrorContentType
+			}
+			if got := rec.Header().Get("Content-Type"); got != wantType {
+				t.Errorf("Content-Type = %q, want %q", got, wantType)
+			}
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q is not a JSON object: %v", rec.Body, err)
+			}
+			if !maps.Equal(body, tt.want) {
+				t.Errorf("body = %v, want %v", body, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSONError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	// detail cannot override the error code.
+	writeJSONError(rec, http.StatusConflict, "conflict", map[string]string{"error": "ignored", "rule": "api"})
+	var body map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	if want := map[string]string{"error": "conflict", "rule": "api"}; !maps.Equal(body, want) {
+		t.Errorf("body = %v, want %v", body, want)
+	}
+	if rec.Code != http.StatusConflict || rec.Header().Get("Content-Type") != defaultErrorContentType || rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("response = %d %v", rec.Code, rec.Header())
+	}
+}
@@ -0,0 +1,61 @@
+package router_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"go-router/router"
+)
+
+func ExampleNew() {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, "hello from %s", req.URL.Path)
+	}))
+	defer backend.Close()
+
+	r, err := router.New(router.WithConfig(&router.RouterConfig{
+		Rules: []router.Rule{{PathPrefix: "/api", Destination: backend.URL}},
+	}))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer r.Close()
+
+	// The router is an http.Handler, so it can be mounted in any server.
+	server := httptest.NewServer(r)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/api/users")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	fmt.Println(resp.StatusCode, string(body))
+	// Output: 200 hello from /api/users
+}
+
+func ExampleSessionManager_Snapshot() {
+	sessions := router.NewSessionManager(nil)
+	sessions.AddOrUpdateSession(&router.Session{DateTimeStamp: time.Now(), SourceIP: "192.0.2.1", SourcePort: "1234", Destination: "http://a:1"})
+
+	// GetSession, Count and Snapshot lock the manager themselves, so they
+	// are safe to call while the router records sessions.
+	if session, ok := sessions.GetSession("192.0.2.1:1234"); ok {
+		fmt.Println(session.Destination)
+	}
+	fmt.Println(sessions.Count())
+	for _, session := range sessions.Snapshot() {
+		session.Destination = "changed"
+	}
+	session, _ := sessions.GetSession("192.0.2.1:1234")
+	fmt.Println(session.Destination)
+	// Output:
+	// http://a:1
+	// 1
+	// http://a:1
+}
@@ -0,0 +1,62 @@
+package router
+
+import "net/http"
+
+// Explanation describes how the router would handle a request
+type Explanation struct {
+	Matched bool  `json:"matched"`
+	Rule    *Rule `json:"rule,omitempty"`
+	// Candidates are the destinations of the rule that can take traffic,
+	// which its balancer picks from. Destination is the first of them.
+	Candidates  []string `json:"candidates,omitempty"`
+	Destination string   `json:"destination,omitempty"`
+	// Reason says why the rule matched: "service" or "pattern" for the
+	// X-Service-Type header, "queryParam", "host" or "pathPrefix" for
+	// requests without it, "matcher" for a custom Matcher, or "default"
+	// when only the Default destination applies
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// matchReason names what made rule match req
+func matchReason(rule Rule, req *http.Request) string {
+	service, _, _ := routingInputs(req)
+	switch {
+	case rule.key() == defaultService:
+		return "default"
+	case rule.key() == matcherService:
+		return "matcher"
+	case service != "" && rule.Service == service:
+		return "service"
+	case service != "":
+		return "pattern"
+	case rule.QueryParam != "" && req.URL.Query().Get(rule.QueryParam) != "":
+		return "queryParam"
+	case rule.PathPrefix != "":
+		return "pathPrefix"
+	}
+	return "host"
+}
+
+// Explain reports which rule req would be routed under and the
+// destinations it could be sent to, without forwarding it. It leaves the
+// balancers and circuit breakers as they are: no turn in the rotation is
+// taken and no half-open probe claimed.
+func (r *Router) Explain(req *http.Request) Explanation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rule, err := r.matchedRule(req)
+	if err != nil {
+		return Explanation{Error: err.Error()}
+	}
+	explanation := Explanation{Matched: true, Rule: &rule, Reason: matchReason(rule, req)}
+	for _, destination := range r.candidates(rule) {
+		explanation.Candidates = append(explanation.Candidates, destination.Address)
+	}
+	if len(explanation.Candidates) == 0 {
+		explanation.Error = errNoDestination.Error()
+		return explanation
+	}
+	explanation.Destination = explanation.Candidates[0]
+	return explanation
+}
@@ -0,0 +1,96 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{
+		Default: "http://fallback:1",
+		Rules: []Rule{
+			{Service: "api", Destination: "http://api:1"},
+			{PathPrefix: "/static", Destination: "http://static:1"},
+		},
+	})
+	noDefault := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: "http://api:1"}}})
+
+	tests := []struct {
+		name        string
+		router      *Router
+		service     string
+		path        string
+		matched     bool
+		destination string
+		reason      string
+		err         string
+	}{
+		{name: "service header", router: router, service: "api", path: "/", matched: true, destination: "http://api:1", reason: "service"},
+		{name: "path prefix", router: router, path: "/static/app.js", matched: true, destination: "http://static:1", reason: "pathPrefix"},
+		{name: "default", router: router, service: "other", path: "/", matched: true, destination: "http://fallback:1", reason: "default"},
+		{name: "no match", router: noDefault, service: "other", path: "/", err: errRouteNotFound.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.service != "" {
+				req.Header.Set("X-Service-Type", tt.service)
+			}
+			got := tt.router.Explain(req)
+			if got.Matched != tt.matched || got.Destination != tt.destination || got.Reason != tt.reason || got.Error != tt.err {
+				t.Errorf("Explain = %+v, want matched %v, destination %q, reason %q, error %q", got, tt.matched, tt.destination, tt.reason, tt.err)
+			}
+			if tt.matched && (got.Rule == nil || !slices.Equal(got.Candidates, []string{tt.destination})) {
+				t.Errorf("Explain rule, candidates = %v, %q", got.Rule, got.Candidates)
+			}
+		})
+	}
+}
+
+// TestExplainLeavesBalancingAlone checks that explaining a request neither
+// takes a turn in the round-robin rotation nor claims a half-open probe
+func TestExplainLeavesBalancingAlone(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{
+		CircuitBreaker: &CircuitBreakerConfig{FailureThreshold: 1},
+		Rules:          []Rule{{Service: "api", Destinations: []string{"http://a:1", "http://b:1"}}},
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Service-Type", "api")
+
+	first, _ := router.RouteRequest(req)
+	router.Explain(req)
+	router.Explain(req)
+	if second, _ := router.RouteRequest(req); second == first {
+		t.Errorf("routed to %s twice in a row; Explain advanced the rotation", first)
+	}
+
+	// With no cooldown the circuit is half-open as soon as it opens.
+	router.breaker.Failure("http://b:1")
+	got := router.Explain(req)
+	if !slices.Contains(got.Candidates, "http://b:1") {
+		t.Errorf("candidates = %q, want the half-open http://b:1 offered", got.Candidates)
+	}
+	if !router.breaker.Allow("http://b:1") {
+		t.Error("Explain claimed the half-open probe")
+	}
+}
+
+func TestExplainEndpoint(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Host: "example.com", PathPrefix: "/api", Destination: "http://api:1"}}})
+	mux := adminMux(router, NewSessionManager(nil), "", nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/explain?host=example.com&path=/api/users", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /explain = %d %s", rec.Code, rec.Body)
+	}
+	var got Explanation
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Matched || got.Destination != "http://api:1" || got.Reason != "pathPrefix" {
+		t.Errorf("GET /explain = %+v", got)
+	}
+}
@@ -0,0 +1,169 @@
+package router
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// hopHeaders are the hop-by-hop headers that must not be passed on by a proxy
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// forwardClient is the HTTP client ForwardRequest uses to reach destinations
+var forwardClient = newForwardClient(TransportConfig{}, nil)
+
+// parseDestination parses a destination as a URL, assuming http when no scheme is given
+func parseDestination(destination string) (*url.URL, error) {
+	if !strings.Contains(destination, "://") {
+		destination = "http://" + destination
+	}
+	return url.Parse(destination)
+}
+
+// removeHopHeaders deletes hop-by-hop headers, including any named in Connection
+func removeHopHeaders(h http.Header) {
+	for _, field := range h.Values("Connection") {
+		for _, name := range strings.Split(field, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// trailersAccepted reports whether the TE header of h includes "trailers"
+func trailersAccepted(h http.Header) bool {
+	for _, field := range h.Values("Te") {
+		for _, value := range strings.Split(field, ",") {
+			if strings.EqualFold(strings.TrimSpace(value), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// singleJoiningSlash joins two URL paths with exactly one slash between them
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// ForwardRequest proxies req to destination, preserving the method, headers,
+// body, path and query string, and returns the upstream response
+func ForwardRequest(req *http.Request, destination string) (*http.Response, error) {
+	target, err := parseUpstream(destination)
+	if err != nil {
+		return nil, err
+	}
+	outReq, err := newForwardRequest(req, target)
+	if err != nil {
+		return nil, err
+	}
+	return clientFor(forwardClient, req, outReq).Do(outReq)
+}
+
+// forwardRule is ForwardRequest with the path and header rewrites of rule
+// applied, sent through the router's pooled client
+func (r *Router) forwardRule(req *http.Request, rule Rule, destination string) (*http.Response, error) {
+	target, err := rule.upstream(destination)
+	if err != nil {
+		return nil, err
+	}
+	outReq, err := newForwardRequest(rule.rewritePath(req), target)
+	if err != nil {
+		return nil, err
+	}
+	rule.rewriteRequest(outReq)
+	resp, err := clientFor(r.httpClient(), req, outReq).Do(outReq)
+	if err != nil {
+		return nil, err
+	}
+	rule.rewriteResponse(resp)
+	return resp, nil
+}
+
+// newForwardRequest builds the request sent to target on behalf of req
+func newForwardRequest(req *http.Request, target upstream) (*http.Request, error) {
+	outURL := *target.url
+	outURL.Path = singleJoiningSlash(target.url.Path, req.URL.Path)
+	outURL.RawPath = ""
+	outURL.RawQuery = req.URL.RawQuery
+
+	outReq, err := http.NewRequestWithContext(req.Context(), req.Method, outURL.String(), req.Body)
+	if err != nil {
+		return nil, err
+	}
+	outReq.ContentLength = req.ContentLength
+	outReq.Header = req.Header.Clone()
+	outReq.Trailer = req.Trailer
+	removeHopHeaders(outReq.Header)
+	// TE: trailers is hop-by-hop but required end to end by gRPC.
+	if trailersAccepted(req.Header) {
+		outReq.Header.Set("Te", "trailers")
+	}
+
+	injectTraceContext(req.Context(), outReq.Header)
+
+	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		if prior := outReq.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+			clientIP = strings.Join(prior, ", ") + ", " + clientIP
+		}
+		outReq.Header.Set("X-Forwarded-For", clientIP)
+	}
+	return outReq, nil
+}
+
+// copyResponse writes the upstream status code, headers, body and trailers
+// to w. gRPC, server-sent events and other streamed bodies are flushed as
+// they arrive, event streams starting with their headers so that clients
+// see the stream open before the first event.
+func copyResponse(w http.ResponseWriter, resp *http.Response) error {
+	defer resp.Body.Close()
+	removeHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	var dst io.Writer = w
+	if eventStream := isEventStream(resp.Header); eventStream || resp.ContentLength == -1 || strings.HasPrefix(resp.Header.Get("Content-Type"), "application/grpc") {
+		rc := http.NewResponseController(w)
+		if eventStream {
+			rc.Flush()
+		}
+		dst = flushWriter{w: w, rc: rc}
+	}
+	if _, err := io.Copy(dst, resp.Body); err != nil {
+		return err
+	}
+	for key, values := range resp.Trailer {
+		for _, value := range values {
+			w.Header().Add(http.TrailerPrefix+key, value)
+		}
+	}
+	return nil
+}
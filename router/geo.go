@@ -0,0 +1,74 @@
+package router
+
+import (
+	"net"
+	"strings"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// geoResolver looks up the country and continent of client IPs in a
+// MaxMind GeoIP2 or GeoLite2 Country or City database
+type geoResolver struct {
+	db *geoip2.Reader
+}
+
+// openGeoIP opens the MaxMind database at path
+func openGeoIP(path string) (*geoResolver, error) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &geoResolver{db: db}, nil
+}
+
+// locate returns the ISO country code and continent code of ip. A nil
+// resolver, an unparsable IP or a failed lookup locates nothing.
+func (g *geoResolver) locate(ip string) (country, continent string, ok bool) {
+	if g == nil {
+		return "", "", false
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return "", "", false
+	}
+	record, err := g.db.Country(addr)
+	if err != nil {
+		return "", "", false
+	}
+	country, continent = record.Country.IsoCode, record.Continent.Code
+	return country, continent, country != "" || continent != ""
+}
+
+// Close closes the database; closing a nil resolver does nothing
+func (g *geoResolver) Close() error {
+	if g == nil {
+		return nil
+	}
+	return g.db.Close()
+}
+
+// geoDestination returns the destination of rule's GeoDestinations for the
+// country of the client at ip, or else for its continent, if that
+// destination can take traffic. Without a database, or when the client
+// cannot be located, the rule's regular destinations are used instead.
+func (r *Router) geoDestination(rule Rule, ip string) (string, bool) {
+	if len(rule.GeoDestinations) == 0 {
+		return "", false
+	}
+	country, continent, ok := r.geo.locate(ip)
+	if !ok {
+		return "", false
+	}
+	for _, code := range []string{country, continent} {
+		if code == "" {
+			continue
+		}
+		for key, destination := range rule.GeoDestinations {
+			if strings.EqualFold(key, code) {
+				return r.pinnedDestination(rule, destination)
+			}
+		}
+	}
+	return "", false
+}
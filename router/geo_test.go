@@ -0,0 +1,173 @@
+package router
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mmdbValue is an encoded value of the MaxMind DB data section
+type mmdbValue []byte
+
+// mmdbControl encodes the control byte of a value of type kind and size,
+// which must be below 29
+func mmdbControl(kind, size int) []byte {
+	if kind <= 7 {
+		return []byte{byte(kind<<5 | size)}
+	}
+	return []byte{byte(size), byte(kind - 7)}
+}
+
+// mmdbString encodes a UTF-8 string
+func mmdbString(s string) mmdbValue {
+	return append(mmdbControl(2, len(s)), s...)
+}
+
+// mmdbUint encodes v as an unsigned integer of type kind, size bytes long
+func mmdbUint(kind, size int, v uint64) mmdbValue {
+	b := binary.BigEndian.AppendUint64(nil, v)
+	return append(mmdbControl(kind, size), b[8-size:]...)
+}
+
+// mmdbArray encodes an array of values
+func mmdbArray(values ...mmdbValue) mmdbValue {
+	out := mmdbControl(11, len(values))
+	for _, value := range values {
+		out = append(out, value...)
+	}
+	return out
+}
+
+// mmdbMap encodes the map with keys and values alternating in pairs
+func mmdbMap(pairs ...any) mmdbValue {
+	out := mmdbControl(7, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		out = append(out, mmdbString(pairs[i].(string))...)
+		out = append(out, pairs[i+1].(mmdbValue)...)
+	}
+	return out
+}
+
+// writeTestGeoIP writes an IPv4 country database to a temporary file and
+// returns its path. It locates 0.0.0.0/2 in Japan, Asia, and 128.0.0.0/1
+// only by continent, in Europe; 64.0.0.0/2 has no entry.
+func writeTestGeoIP(t *testing.T) string {
+	t.Helper()
+	japan := mmdbMap("continent", mmdbMap("code", mmdbString("AS")), "country", mmdbMap("iso_code", mmdbString("JP")))
+	europe := mmdbMap("continent", mmdbMap("code", mmdbString("EU")))
+
+	// Two nodes of two 24-bit records. A record of nodeCount means no
+	// entry; larger ones point into the data section, which follows the
+	// tree and 16 bytes of zeros.
+	const nodeCount = 2
+	data := func(offset int) int { return nodeCount + 16 + offset }
+	var file bytes.Buffer
+	for _, record := range []int{1, data(len(japan)), data(0), nodeCount} {
+		file.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+	}
+	file.Write(make([]byte, 16))
+	file.Write(japan)
+	file.Write(europe)
+	file.WriteString("\xab\xcd\xefMaxMind.com")
+	file.Write(mmdbMap(
+		"binary_format_major_version", mmdbUint(5, 2, 2),
+		"binary_format_minor_version", mmdbUint(5, 2, 0),
+		"build_epoch", mmdbUint(9, 8, 0),
+		"database_type", mmdbString("GeoLite2-Country"),
+		"description", mmdbMap("en", mmdbString("test")),
+		"ip_version", mmdbUint(5, 2, 4),
+		"languages", mmdbArray(mmdbString("en")),
+		"node_count", mmdbUint(6, 4, nodeCount),
+		"record_size", mmdbUint(5, 2, 24),
+	))
+
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	if err := os.WriteFile(path, file.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestGeoResolverLocate(t *testing.T) {
+	geo, err := openGeoIP(writeTestGeoIP(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer geo.Close()
+	tests := []struct {
+		ip, country, continent string
+		ok                     bool
+	}{
+		{"1.2.3.4", "JP", "AS", true},
+		{"200.0.0.1", "", "EU", true},
+		{"100.0.0.1", "", "", false},
+		{"not-an-ip", "", "", false},
+	}
+	for _, tt := range tests {
+		country, continent, ok := geo.locate(tt.ip)
+		if country != tt.country || continent != tt.continent || ok != tt.ok {
+			t.Errorf("locate(%q) = %q, %q, %v, want %q, %q, %v", tt.ip, country, continent, ok, tt.country, tt.continent, tt.ok)
+		}
+	}
+	if _, _, ok := (*geoResolver)(nil).locate("1.2.3.4"); ok {
+		t.Error("a nil resolver located an address")
+	}
+}
+
+func TestOpenGeoIPMissing(t *testing.T) {
+	if _, err := openGeoIP(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("opening a missing database succeeded")
+	}
+}
+
+func TestGeoDestinations(t *testing.T) {
+	home, jp, eu := newBackend(t, "home"), newBackend(t, "jp"), newBackend(t, "eu")
+	config := &RouterConfig{
+		HealthCheck: &HealthCheckConfig{},
+		Rules: []Rule{{
+			Service:         "api",
+			Destination:     home.URL,
+			GeoDestinations: map[string]string{"jp": jp.URL, "EU": eu.URL},
+		}},
+	}
+	clients := []struct{ remoteAddr, want string }{
+		{"1.2.3.4:1234", "jp"},         // by country, matched case-insensitively
+		{"200.0.0.1:1234", "eu"},       // by continent
+		{"100.0.0.1:1234", "home"},     // not in the database
+		{"[2001:db8::1]:1234", "home"}, // not in an IPv4 database
+	}
+
+	t.Run("without a database", func(t *testing.T) {
+		router := newTestRouter(t, config)
+		for _, client := range clients {
+			if _, got := serve(router, serviceRequest("api", client.remoteAddr)); got != "home" {
+				t.Errorf("%s went to %q, want home", client.remoteAddr, got)
+			}
+		}
+	})
+
+	t.Run("with a database", func(t *testing.T) {
+		router := newTestRouter(t, config)
+		geo, err := openGeoIP(writeTestGeoIP(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		router.geo = geo
+		router.OnClose(geo.Close)
+		for _, client := range clients {
+			if rec, got := serve(router, serviceRequest("api", client.remoteAddr)); rec.Code != http.StatusOK || got != client.want {
+				t.Errorf("%s = %d %q, want 200 from %s", client.remoteAddr, rec.Code, got, client.want)
+			}
+		}
+
+		router.health.Load().mu.Lock()
+		router.health.Load().healthy[jp.URL] = false
+		router.health.Load().mu.Unlock()
+		if _, got := serve(router, serviceRequest("api", "1.2.3.4:1234")); got != "home" {
+			t.Errorf("with jp unhealthy the client went to %q, want home", got)
+		}
+	})
+}
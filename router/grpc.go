@@ -0,0 +1,54 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+)
+
+// h2cClient forwards gRPC requests to plaintext destinations over HTTP/2
+// with prior knowledge, since gRPC does not work over HTTP/1.1
+var h2cClient = &http.Client{
+	Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	},
+	CheckRedirect: forwardClient.CheckRedirect,
+}
+
+// isGRPC reports whether req is a gRPC call
+func isGRPC(req *http.Request) bool {
+	return req.ProtoMajor == 2 && strings.HasPrefix(req.Header.Get("Content-Type"), "application/grpc")
+}
+
+// clientFor returns the client used to send outReq, forwarded on behalf of
+// req: h2cClient for plaintext gRPC and client otherwise
+func clientFor(client *http.Client, req, outReq *http.Request) *http.Client {
+	if isGRPC(req) && outReq.URL.Scheme == "http" {
+		return h2cClient
+	}
+	return client
+}
+
+// flushWriter flushes after every write so streamed responses reach the
+// client as they arrive
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if err == nil {
+		err = fw.rc.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,83 @@
+package router
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCRouting(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := grpc.NewServer()
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("api", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(backend, healthServer)
+	go backend.Serve(lis)
+	t.Cleanup(backend.Stop)
+
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{PathPrefix: "/grpc.health.v1.Health/", Destination: "http://" + lis.Addr().String()},
+	}})
+	front := httptest.NewUnstartedServer(router)
+	if err := serveHTTP2(front.Config, true); err != nil {
+		t.Fatal(err)
+	}
+	front.Start()
+	t.Cleanup(front.Close)
+
+	conn, err := grpc.NewClient(front.Listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := healthpb.NewHealthClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %v, want SERVING", resp.Status)
+	}
+	// The status of a failed call only travels in the grpc-status trailer.
+	_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("unknown service err = %v, want NotFound from the backend", err)
+	}
+}
+
+func TestIsGRPC(t *testing.T) {
+	tests := []struct {
+		protoMajor  int
+		contentType string
+		want        bool
+	}{
+		{2, "application/grpc", true},
+		{2, "application/grpc+proto", true},
+		{1, "application/grpc", false},
+		{2, "application/json", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+		req.ProtoMajor = tt.protoMajor
+		req.Header.Set("Content-Type", tt.contentType)
+		if got := isGRPC(req); got != tt.want {
+			t.Errorf("isGRPC(HTTP/%d, %q) = %v, want %v", tt.protoMajor, tt.contentType, got, tt.want)
+		}
+	}
+}
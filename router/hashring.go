@@ -0,0 +1,141 @@
+package router
+
+import (
+	"hash/fnv"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ringReplicas is how many points each unit of weight places on a hash
+// ring; more points spread keys more evenly
+const ringReplicas = 160
+
+// hashRing is a consistent hash ring: keys belong to the destination owning
+// the first point at or after their hash, so adding or removing a
+// destination only moves the keys of the points it gains or loses
+type hashRing struct {
+	points []uint64
+	owners []Destination // owner of each point
+}
+
+// hashKey hashes s onto the ring
+func hashKey(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return mix64(h.Sum64())
+}
+
+// mix64 spreads every bit of h over the high bits, which FNV leaves poorly
+// mixed for short keys differing only at the end (the splitmix64 finalizer)
+func mix64(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	return h ^ h>>31
+}
+
+// newHashRing places ringReplicas points per unit of weight for each destination
+func newHashRing(destinations []Destination) *hashRing {
+	type point struct {
+		hash  uint64
+		owner Destination
+	}
+	var points []point
+	for _, d := range destinations {
+		for i := 0; i < ringReplicas*max(d.Weight, 1); i++ {
+			points = append(points, point{hashKey(d.Address + "#" + strconv.Itoa(i)), d})
+		}
+	}
+	slices.SortFunc(points, func(a, b point) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		}
+		return strings.Compare(a.owner.Address, b.owner.Address)
+	})
+	ring := &hashRing{points: make([]uint64, len(points)), owners: make([]Destination, len(points))}
+	for i, p := range points {
+		ring.points[i], ring.owners[i] = p.hash, p.owner
+	}
+	return ring
+}
+
+// lookup returns the destination owning key
+func (ring *hashRing) lookup(key string) Destination {
+	i, _ := slices.BinarySearch(ring.points, hashKey(key))
+	if i == len(ring.points) {
+		i = 0
+	}
+	return ring.owners[i]
+}
+
+// ringCache keeps the hash ring of the last set of destinations picked
+// from, rebuilding it only when that set changes
+type ringCache struct {
+	mu        sync.Mutex
+	signature string
+	ring      *hashRing
+}
+
+// pick returns the destination key belongs to on the ring of destinations
+func (c *ringCache) pick(destinations []Destination, key string) (Destination, error) {
+	if len(destinations) == 0 {
+		return Destination{}, errNoDestination
+	}
+	var b strings.Builder
+	for _, d := range destinations {
+		b.WriteString(d.Address)
+		b.WriteByte('=')
+		b.WriteString(strconv.Itoa(d.Weight))
+		b.WriteByte(',')
+	}
+	c.mu.Lock()
+	if c.ring == nil || c.signature != b.String() {
+		c.signature, c.ring = b.String(), newHashRing(destinations)
+	}
+	ring := c.ring
+	c.mu.Unlock()
+	owner := ring.lookup(key)
+	// Return the caller's copy, which carries the current Active count.
+	for _, d := range destinations {
+		if d.Address == owner.Address {
+			return d, nil
+		}
+	}
+	return owner, nil
+}
+
+// IPHash sends each client IP to the same destination for as long as it is
+// available, by consistent hashing
+type IPHash struct {
+	ring ringCache
+}
+
+func (b *IPHash) Pick(destinations []Destination, req *http.Request) (Destination, error) {
+	return b.ring.pick(destinations, clientIP(req))
+}
+
+// KeyHash sends requests carrying the same value of Header to the same
+// destination, by consistent hashing, so caching backends see the same
+// keys; requests without the header are hashed by client IP
+type KeyHash struct {
+	Header string
+	ring   ringCache
+}
+
+func (b *KeyHash) Pick(destinations []Destination, req *http.Request) (Destination, error) {
+	key := ""
+	if req != nil {
+		key = req.Header.Get(b.Header)
+	}
+	if key == "" {
+		key = clientIP(req)
+	}
+	return b.ring.pick(destinations, key)
+}
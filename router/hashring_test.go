@@ -0,0 +1,99 @@
+package router
+
+import (
+	"fmt"
+	"testing"
+)
+
+// ringDestinations returns n destinations of weight 1
+func ringDestinations(n int) []Destination {
+	destinations := make([]Destination, n)
+	for i := range destinations {
+		destinations[i] = Destination{Address: fmt.Sprintf("http://10.0.0.%d:8080", i+1), Weight: 1}
+	}
+	return destinations
+}
+
+// owners returns the destination each of keys belongs to on ring
+func owners(ring *hashRing, keys []string) map[string]string {
+	out := make(map[string]string, len(keys))
+	for _, key := range keys {
+		out[key] = ring.lookup(key).Address
+	}
+	return out
+}
+
+func TestHashRingChurn(t *testing.T) {
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("object-%d", i)
+	}
+	pool := ringDestinations(11)
+	before := owners(newHashRing(pool[:10]), keys)
+
+	// Growing the pool from 10 to 11 moves about 1/11 of the keys, all of
+	// them to the new destination.
+	grown := owners(newHashRing(pool), keys)
+	moved := 0
+	for _, key := range keys {
+		if grown[key] != before[key] {
+			moved++
+			if grown[key] != pool[10].Address {
+				t.Fatalf("%s moved from %s to %s, not to the added destination", key, before[key], grown[key])
+			}
+		}
+	}
+	if churn := float64(moved) / float64(len(keys)); churn < 0.05 || churn > 0.14 {
+		t.Errorf("adding a destination moved %.1f%% of the keys, want about 9%%", churn*100)
+	}
+
+	// Removing a destination only moves the keys it owned.
+	removed := pool[3].Address
+	shrunk := owners(newHashRing(append(append([]Destination(nil), pool[:3]...), pool[4:10]...)), keys)
+	moved = 0
+	for _, key := range keys {
+		if shrunk[key] != before[key] {
+			moved++
+			if before[key] != removed {
+				t.Fatalf("%s moved from %s, which stayed in the pool", key, before[key])
+			}
+		}
+	}
+	if churn := float64(moved) / float64(len(keys)); churn < 0.05 || churn > 0.15 {
+		t.Errorf("removing a destination moved %.1f%% of the keys, want about 10%%", churn*100)
+	}
+}
+
+func TestHashRingWeights(t *testing.T) {
+	ring := newHashRing([]Destination{{Address: "heavy", Weight: 3}, {Address: "light", Weight: 1}})
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[ring.lookup(fmt.Sprintf("object-%d", i)).Address]++
+	}
+	if share := float64(counts["heavy"]) / 10000; share < 0.68 || share > 0.82 {
+		t.Errorf("weight 3 of 4 owns %.1f%% of the keys, want about 75%%", share*100)
+	}
+}
+
+func TestRingCacheRebuildsOnChange(t *testing.T) {
+	var cache ringCache
+	pool := ringDestinations(3)
+	first, _ := cache.pick(pool, "object")
+	ring := cache.ring
+	// In-flight counts are not part of the ring, but picks report them.
+	for i := range pool {
+		if pool[i].Address == first.Address {
+			pool[i].Active = 5
+		}
+	}
+	if picked, _ := cache.pick(pool, "object"); cache.ring != ring || picked.Active != 5 {
+		t.Errorf("after a change of Active count: ring rebuilt %v, picked Active %d, want false, 5", cache.ring != ring, picked.Active)
+	}
+	cache.pick(pool[:2], "object")
+	if cache.ring == ring {
+		t.Error("ring not rebuilt when the pool changed")
+	}
+	if _, err := cache.pick(nil, "object"); err == nil {
+		t.Error("picking from an empty pool succeeded")
+	}
+}
@@ -0,0 +1,87 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHeadRequests(t *testing.T) {
+	payload := strings.Repeat("compress me ", 200)
+	methods := make(chan string, 10)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		methods <- req.Method
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+		if req.Method != http.MethodHead {
+			io.WriteString(w, payload)
+		}
+	}))
+	t.Cleanup(backend.Close)
+	router := newTestRouter(t, &RouterConfig{
+		Compression: true,
+		Rules:       []Rule{{Service: "api", Destination: backend.URL, CacheTTLMS: 60000}},
+	})
+	front := httptest.NewServer(router)
+	t.Cleanup(front.Close)
+	// Compression is asked for by hand, so that the response is seen as sent.
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	t.Cleanup(client.CloseIdleConnections)
+	send := func(method, url string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, url, nil)
+		req.Header.Set("X-Service-Type", "api")
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	direct, _ := send(http.MethodHead, backend.URL)
+	<-methods
+	tests := []struct {
+		step, cache, forwarded string
+	}{
+		// HEAD responses are not cached, so the GET is forwarded too.
+		{"HEAD", "", http.MethodHead},
+		{"GET", "MISS", http.MethodGet},
+		{"HEAD after GET", "HIT", ""},
+	}
+	for _, tt := range tests {
+		method, _, _ := strings.Cut(tt.step, " ")
+		resp, body := send(method, front.URL)
+		if tt.forwarded != "" {
+			if got := <-methods; got != tt.forwarded {
+				t.Errorf("%s: forwarded as %s, want %s", tt.step, got, tt.forwarded)
+			}
+		}
+		if cache := resp.Header.Get("X-Cache"); cache != tt.cache {
+			t.Errorf("%s: X-Cache = %q, want %q", tt.step, cache, tt.cache)
+		}
+		if method == http.MethodGet {
+			if resp.Header.Get("Content-Encoding") != "gzip" {
+				t.Errorf("GET: Content-Encoding = %q, want gzip", resp.Header.Get("Content-Encoding"))
+			}
+			continue
+		}
+		// As the backend answers it: its Content-Length, uncompressed, and
+		// no body.
+		if resp.StatusCode != direct.StatusCode || resp.ContentLength != direct.ContentLength || resp.Header.Get("Content-Type") != direct.Header.Get("Content-Type") {
+			t.Errorf("%s: %d with length %d and type %q, want %d, %d and %q as from the backend", tt.step,
+				resp.StatusCode, resp.ContentLength, resp.Header.Get("Content-Type"), direct.StatusCode, direct.ContentLength, direct.Header.Get("Content-Type"))
+		}
+		if encoding := resp.Header.Get("Content-Encoding"); encoding != "" || body != "" {
+			t.Errorf("%s: Content-Encoding %q with body %q, want neither", tt.step, encoding, body)
+		}
+	}
+	if len(methods) != 0 {
+		t.Errorf("the cached HEAD reached the backend as %s", <-methods)
+	}
+}
@@ -0,0 +1,230 @@
+package router
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthPath     = "/healthz"
+	defaultHealthInterval = 10 * time.Second
+	defaultHealthTimeout  = 2 * time.Second
+)
+
+// HealthCheckConfig sets how destinations are probed
+type HealthCheckConfig struct {
+	// Path is requested on each destination; it defaults to /healthz
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// IntervalMS is the time between probe rounds
+	IntervalMS int `json:"intervalMS,omitempty" yaml:"intervalMS,omitempty"`
+	// TimeoutMS bounds each probe
+	TimeoutMS int `json:"timeoutMS,omitempty" yaml:"timeoutMS,omitempty"`
+}
+
+// HealthChecker periodically probes every destination and records whether it
+// is healthy. Destinations that have not been probed yet count as healthy, and
+// a nil HealthChecker reports every destination as healthy.
+type HealthChecker struct {
+	config       HealthCheckConfig
+	path         string
+	interval     time.Duration
+	client       *http.Client
+	destinations func() []string
+	logger       *slog.Logger
+
+	mu      sync.RWMutex
+	healthy map[string]bool
+}
+
+// NewHealthChecker creates a HealthChecker probing the addresses returned by destinations
+func NewHealthChecker(config HealthCheckConfig, destinations func() []string, logger *slog.Logger) *HealthChecker {
+	hc := &HealthChecker{
+		config:       config,
+		path:         config.Path,
+		interval:     time.Duration(config.IntervalMS) * time.Millisecond,
+		client:       &http.Client{Timeout: time.Duration(config.TimeoutMS) * time.Millisecond},
+		destinations: destinations,
+		logger:       logger,
+		healthy:      make(map[string]bool),
+	}
+	if hc.path == "" {
+		hc.path = defaultHealthPath
+	}
+	if hc.interval <= 0 {
+		hc.interval = defaultHealthInterval
+	}
+	if hc.client.Timeout <= 0 {
+		hc.client.Timeout = defaultHealthTimeout
+	}
+	return hc
+}
+
+// Healthy reports whether destination passed its most recent probe
+func (hc *HealthChecker) Healthy(destination string) bool {
+	if hc == nil {
+		return true
+	}
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	healthy, ok := hc.healthy[destination]
+	return !ok || healthy
+}
+
+// Start probes every destination immediately and then every interval until ctx is canceled
+func (hc *HealthChecker) Start(ctx context.Context) {
+	if hc == nil {
+		return
+	}
+	go hc.run(ctx)
+}
+
+// run probes every destination each interval until ctx is canceled
+func (hc *HealthChecker) run(ctx context.Context) {
+	if hc == nil {
+		return
+	}
+	ticker := time.NewTicker(hc.interval)
+	defer ticker.Stop()
+	for {
+		hc.CheckAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll probes every destination concurrently and records the results,
+// forgetting destinations that are no longer configured
+func (hc *HealthChecker) CheckAll(ctx context.Context) {
+	destinations := hc.destinations()
+	results := make(map[string]bool, len(destinations))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, destination := range destinations {
+		wg.Add(1)
+		go func(destination string) {
+			defer wg.Done()
+			healthy := hc.probe(ctx, destination)
+			mu.Lock()
+			results[destination] = healthy
+			mu.Unlock()
+		}(destination)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	for destination, healthy := range results {
+		if was, ok := hc.healthy[destination]; (ok && was != healthy) || (!ok && !healthy) {
+			hc.logger.Info("destination health changed", "destination", destination, "healthy", healthy)
+		}
+	}
+	hc.healthy = results
+}
+
+// probe requests the health path on destination and reports whether it answered 2xx or 3xx
+func (hc *HealthChecker) probe(ctx context.Context, destination string) bool {
+	target, err := parseDestination(destination)
+	if err != nil {
+		return false
+	}
+	target.Path = singleJoiningSlash(target.Path, hc.path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < http.StatusBadRequest
+}
+
+// destinations returns every distinct destination address across all rules
+func (r *Router) destinations() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seen := make(map[string]bool)
+	var destinations []string
+	add := func(destination string) {
+		if !seen[destination] {
+			seen[destination] = true
+			destinations = append(destinations, destination)
+		}
+	}
+	for _, rule := range r.Rules {
+		for _, destination := range rule.pool() {
+			add(destination)
+		}
+		for _, wd := range rule.Weights {
+			add(wd.Address)
+		}
+		for _, destination := range []string{rule.Blue, rule.Green} {
+			if destination != "" {
+				add(destination)
+			}
+		}
+		for _, destination := range rule.GeoDestinations {
+			add(destination)
+		}
+		for _, destination := range rule.Backup {
+			add(destination)
+		}
+	}
+	if r.Default != "" {
+		add(r.Default)
+	}
+	return destinations
+}
+
+// StartHealthChecks begins probing destinations if health checks are
+// configured. A reload that changes healthCheck replaces the checker, stopping
+// the old one, and the new one probes until ctx is done too.
+func (r *Router) StartHealthChecks(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.healthCtx = ctx
+	r.startHealth()
+}
+
+// startHealth runs the current checker with the context given to
+// StartHealthChecks, if it has been called. The caller must hold r.mu.
+func (r *Router) startHealth() {
+	hc := r.health.Load()
+	if hc == nil || r.healthCtx == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(r.healthCtx)
+	r.stopHealth = cancel
+	r.goBackground(ctx, hc.run)
+}
+
+// configureHealth replaces the health checker when config differs from the
+// one it was created with, dropping it when config is nil. The new checker
+// starts with every destination healthy and probes them at once. The caller
+// must hold r.mu.
+func (r *Router) configureHealth(config *HealthCheckConfig) {
+	old := r.health.Load()
+	if (old == nil && config == nil) || (old != nil && config != nil && old.config == *config) {
+		return
+	}
+	if r.stopHealth != nil {
+		r.stopHealth()
+		r.stopHealth = nil
+	}
+	var hc *HealthChecker
+	if config != nil {
+		hc = NewHealthChecker(*config, r.destinations, r.logger())
+	}
+	r.health.Store(hc)
+	r.startHealth()
+}
@@ -0,0 +1,197 @@
+package router
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFlippingBackend starts a backend answering its name, whose health path
+// answers 200 or 503 depending on healthy
+func newFlippingBackend(t *testing.T, name string, healthy *atomic.Bool) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/ping" {
+			if !healthy.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			return
+		}
+		w.Write([]byte(name))
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func TestHealthChecksFlipMidRun(t *testing.T) {
+	var aUp, bUp atomic.Bool
+	a, b := newFlippingBackend(t, "a", &aUp), newFlippingBackend(t, "b", &bUp)
+	router := newTestRouter(t, &RouterConfig{
+		HealthCheck: &HealthCheckConfig{Path: "/ping"},
+		Rules:       []Rule{{Service: "api", Destinations: []string{a.URL, b.URL}}},
+	})
+
+	// Each step records which backend, or "503", answered four requests.
+	tests := []struct {
+		name     string
+		aUp, bUp bool
+		want     map[string]int
+	}{
+		{"both healthy", true, true, map[string]int{"a": 2, "b": 2}},
+		{"a down", false, true, map[string]int{"b": 4}},
+		{"a back, b down", true, false, map[string]int{"a": 4}},
+		{"all down", false, false, map[string]int{"503": 4}},
+		{"recovered", true, true, map[string]int{"a": 2, "b": 2}},
+	}
+	for _, tt := range tests {
+		aUp.Store(tt.aUp)
+		bUp.Store(tt.bUp)
+		router.health.Load().CheckAll(context.Background())
+		if router.health.Load().Healthy(a.URL) != tt.aUp || router.health.Load().Healthy(b.URL) != tt.bUp {
+			t.Errorf("%s: healthy = %v, %v", tt.name, router.health.Load().Healthy(a.URL), router.health.Load().Healthy(b.URL))
+		}
+		got := map[string]int{}
+		for i := 0; i < 4; i++ {
+			rec, body := serve(router, serviceRequest("api", ""))
+			if rec.Code == http.StatusServiceUnavailable {
+				body = "503"
+			}
+			got[body]++
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHealthCheckProbe(t *testing.T) {
+	var up atomic.Bool
+	up.Store(true)
+	backend := newFlippingBackend(t, "a", &up)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	hc := NewHealthChecker(HealthCheckConfig{Path: "/ping", TimeoutMS: 100}, func() []string {
+		return []string{backend.URL, down.URL}
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if !hc.Healthy(backend.URL) || !hc.Healthy(down.URL) {
+		t.Error("destinations not probed yet should count as healthy")
+	}
+	hc.CheckAll(context.Background())
+	if !hc.Healthy(backend.URL) || hc.Healthy(down.URL) {
+		t.Errorf("healthy = %v, %v, want true, false", hc.Healthy(backend.URL), hc.Healthy(down.URL))
+	}
+	up.Store(false)
+	hc.CheckAll(context.Background())
+	if hc.Healthy(backend.URL) {
+		t.Error("backend answering 503 still healthy")
+	}
+}
+
+func TestBackupFailover(t *testing.T) {
+	var primaryUp, backupUp atomic.Bool
+	a, b := newFlippingBackend(t, "a", &primaryUp), newFlippingBackend(t, "b", &primaryUp)
+	backup := newFlippingBackend(t, "backup", &backupUp)
+	router := newTestRouter(t, &RouterConfig{
+		HealthCheck: &HealthCheckConfig{Path: "/ping"},
+		Rules:       []Rule{{Service: "api", Destinations: []string{a.URL, b.URL}, Backup: []string{backup.URL}}},
+	})
+
+	// Each step records which backend, or "503", answered four requests.
+	tests := []struct {
+		name                string
+		primaryUp, backupUp bool
+		want                map[string]int
+	}{
+		{"primaries healthy", true, true, map[string]int{"a": 2, "b": 2}},
+		{"primaries down", false, true, map[string]int{"backup": 4}},
+		{"everything down", false, false, map[string]int{"503": 4}},
+		{"primaries recovered", true, false, map[string]int{"a": 2, "b": 2}},
+		{"primaries recovered with the backup", true, true, map[string]int{"a": 2, "b": 2}},
+	}
+	for _, tt := range tests {
+		primaryUp.Store(tt.primaryUp)
+		backupUp.Store(tt.backupUp)
+		router.health.Load().CheckAll(context.Background())
+		if router.health.Load().Healthy(backup.URL) != tt.backupUp {
+			t.Errorf("%s: backup healthy = %v, want it checked like the primaries", tt.name, router.health.Load().Healthy(backup.URL))
+		}
+		got := map[string]int{}
+		for i := 0; i < 4; i++ {
+			rec, body := serve(router, serviceRequest("api", ""))
+			if rec.Code == http.StatusServiceUnavailable {
+				body = "503"
+			}
+			got[body]++
+		}
+		if !maps.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// One healthy primary is enough to keep the backup idle.
+	router.health.Load().mu.Lock()
+	router.health.Load().healthy[b.URL] = false
+	router.health.Load().mu.Unlock()
+	for i := 0; i < 4; i++ {
+		if _, body := serve(router, serviceRequest("api", "")); body != "a" {
+			t.Fatalf("with b down got %q, want a", body)
+		}
+	}
+}
+
+func TestHealthCheckReload(t *testing.T) {
+	var up atomic.Bool
+	backend := newFlippingBackend(t, "a", &up)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL}}})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	router.StartHealthChecks(ctx)
+
+	file := filepath.Join(t.TempDir(), "router.json")
+	reload := func(healthCheck string) {
+		t.Helper()
+		config := `{"rules":[{"service":"api","destination":"` + backend.URL + `"}]` + healthCheck + `}`
+		if err := os.WriteFile(file, []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := router.reload(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// healthy waits for the running checker to report want for the backend.
+	healthy := func(want bool) bool {
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			if router.health.Load().Healthy(backend.URL) == want {
+				return true
+			}
+		}
+		return false
+	}
+
+	reload(`,"healthCheck":{"path":"/ping","intervalMS":10}`)
+	if !healthy(false) {
+		t.Fatal("backend failing /ping still healthy after a reload added healthCheck")
+	}
+	up.Store(true)
+	if !healthy(true) {
+		t.Fatal("backend answering /ping not healthy again")
+	}
+	up.Store(false)
+	reload(`,"healthCheck":{"path":"/","intervalMS":10}`)
+	if !healthy(true) || router.health.Load().config.Path != "/" {
+		t.Fatal("reload changing the health path did not replace the checker")
+	}
+	reload("")
+	if hc := router.health.Load(); hc != nil {
+		t.Fatalf("health checker = %+v after a reload removed healthCheck, want none", hc.config)
+	}
+}
@@ -0,0 +1,24 @@
+package router
+
+import (
+	"net/http"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// serveHTTP2 enables HTTP/2 on server so that clients can multiplex
+// requests over one connection: over TLS it is negotiated as h2 by ALPN,
+// and with cleartext set plaintext connections may also speak h2c, by
+// prior knowledge or an h2c upgrade, as plaintext gRPC clients do. Either
+// way each stream is a request of its own to the handler, and
+// HTTP/1.1 clients are served as before.
+func serveHTTP2(server *http.Server, cleartext bool) error {
+	h2 := &http2.Server{}
+	if cleartext {
+		server.Handler = h2c.NewHandler(server.Handler, h2)
+	}
+	// Besides h2 this lets shutdown close idle h2c connections, which
+	// the server no longer tracks once they are handed over.
+	return http2.ConfigureServer(server, h2)
+}
@@ -0,0 +1,141 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+// newHTTP2Router starts the router on a server with HTTP/2 enabled, over
+// TLS unless cleartext is set
+func newHTTP2Router(t *testing.T, router *Router, cleartext bool) *httptest.Server {
+	t.Helper()
+	front := httptest.NewUnstartedServer(router)
+	if err := serveHTTP2(front.Config, cleartext); err != nil {
+		t.Fatal(err)
+	}
+	if cleartext {
+		front.Start()
+	} else {
+		// StartTLS only offers h2 that ConfigureServer added when given
+		// the server's TLS config.
+		front.TLS = front.Config.TLSConfig
+		front.StartTLS()
+	}
+	t.Cleanup(front.Close)
+	return front
+}
+
+// echoPath starts a backend answering each request with its path
+func echoPath(t *testing.T) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, req.URL.Path)
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func TestHTTP2OverTLS(t *testing.T) {
+	backend := echoPath(t)
+	front := newHTTP2Router(t, newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL}}}), false)
+	transport := &http2.Transport{TLSClientConfig: front.Client().Transport.(*http.Transport).TLSClientConfig}
+	t.Cleanup(transport.CloseIdleConnections)
+	client := &http.Client{Transport: transport}
+
+	// Concurrent requests are streams of one connection, each routed on
+	// its own.
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		conns = make(map[string]bool)
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("/item/%d", i)
+			req, _ := http.NewRequest(http.MethodGet, front.URL+path, nil)
+			req.Header.Set("X-Service-Type", "api")
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+				GotConn: func(info httptrace.GotConnInfo) {
+					mu.Lock()
+					defer mu.Unlock()
+					conns[info.Conn.LocalAddr().String()] = true
+				},
+			}))
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.ProtoMajor != 2 || resp.TLS == nil || resp.TLS.NegotiatedProtocol != "h2" {
+				t.Errorf("%s over %s, ALPN %v, want h2", path, resp.Proto, resp.TLS)
+			}
+			if resp.StatusCode != http.StatusOK || string(body) != path {
+				t.Errorf("%s = %d %q, want 200 from its own route", path, resp.StatusCode, body)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(conns) != 1 {
+		t.Errorf("requests used %d connections, want them multiplexed over 1", len(conns))
+	}
+
+	// HTTP/1.1 clients are still served.
+	resp, err := front.Client().Get(front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Errorf("HTTP/1.1 client negotiated %s", resp.Proto)
+	}
+}
+
+func TestHTTP2Cleartext(t *testing.T) {
+	backend := echoPath(t)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL}}})
+	front := newHTTP2Router(t, router, true)
+	// Prior knowledge: HTTP/2 from the first byte, without TLS.
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}
+	t.Cleanup(transport.CloseIdleConnections)
+	req, _ := http.NewRequest(http.MethodGet, front.URL+"/h2c", nil)
+	req.Header.Set("X-Service-Type", "api")
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || string(body) != "/h2c" {
+		t.Errorf("h2c request = %s %q, want HTTP/2 from the backend", resp.Proto, body)
+	}
+
+	// Without cleartext set, plaintext connections stay HTTP/1.
+	plain := httptest.NewUnstartedServer(router)
+	if err := serveHTTP2(plain.Config, false); err != nil {
+		t.Fatal(err)
+	}
+	plain.Start()
+	t.Cleanup(plain.Close)
+	if _, err := (&http.Client{Transport: transport}).Get(plain.URL); err == nil {
+		t.Error("h2c request succeeded without cleartext HTTP/2 enabled")
+	}
+}
@@ -0,0 +1,125 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// expandEnv replaces the ${VAR} and ${VAR:-default} references in s with
+// the values lookup returns. The default is used when VAR is unset or
+// empty; a reference to an unset variable without a default is an error.
+func expandEnv(s string, lookup func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "${")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated ${ in %q", s)
+		}
+		b.WriteString(s[:start])
+		ref := s[start+2 : start+end]
+		name, fallback, hasDefault := strings.Cut(ref, ":-")
+		value, ok := lookup(name)
+		switch {
+		case ok && value != "":
+		case hasDefault:
+			value = fallback
+		case !ok:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		b.WriteString(value)
+		s = s[start+end+1:]
+	}
+}
+
+// preprocessJSON blanks out // and /* */ comments in JSON config data and
+// expands environment references inside its string literals. Comments are
+// replaced with spaces so offsets in later errors still point at the
+// right line.
+func preprocessJSON(data []byte, lookup func(string) (string, bool)) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); {
+		switch {
+		case data[i] == '"':
+			end := i + 1
+			for end < len(data) && data[end] != '"' {
+				if data[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(data) {
+				// Leave the unterminated string to the JSON decoder.
+				return append(out, data[i:]...), nil
+			}
+			literal := data[i : end+1]
+			if bytes.Contains(literal, []byte("${")) {
+				var value string
+				if err := json.Unmarshal(literal, &value); err != nil {
+					return nil, err
+				}
+				expanded, err := expandEnv(value, lookup)
+				if err != nil {
+					return nil, err
+				}
+				if literal, err = json.Marshal(expanded); err != nil {
+					return nil, err
+				}
+			}
+			out = append(out, literal...)
+			i = end + 1
+		case bytes.HasPrefix(data[i:], []byte("//")):
+			end := bytes.IndexByte(data[i:], '\n')
+			if end < 0 {
+				end = len(data) - i
+			}
+			out = append(out, bytes.Repeat([]byte(" "), end)...)
+			i += end
+		case bytes.HasPrefix(data[i:], []byte("/*")):
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated /* comment")
+			}
+			for _, c := range data[i : i+2+end+2] {
+				if c != '\n' {
+					c = ' '
+				}
+				out = append(out, c)
+			}
+			i += 2 + end + 2
+		default:
+			out = append(out, data[i])
+			i++
+		}
+	}
+	return out, nil
+}
+
+// expandYAML expands environment references in every scalar of node. Plain
+// scalars lose their resolved tag, so ${PORT} can stand for a number.
+func expandYAML(node *yaml.Node, lookup func(string) (string, bool)) error {
+	if node.Kind == yaml.ScalarNode && strings.Contains(node.Value, "${") {
+		value, err := expandEnv(node.Value, lookup)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Value = value
+		if node.Style == 0 {
+			node.Tag = ""
+		}
+	}
+	for _, child := range node.Content {
+		if err := expandYAML(child, lookup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
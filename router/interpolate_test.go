@@ -0,0 +1,116 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{"HOST": "api.internal", "EMPTY": ""}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	tests := []struct {
+		in, want, err string
+	}{
+		{in: "http://${HOST}:8080", want: "http://api.internal:8080"},
+		{in: "${HOST}${HOST}", want: "api.internal" + "api.internal"},
+		{in: "${PORT:-9000}", want: "9000"},
+		{in: "${EMPTY:-fallback}", want: "fallback"},
+		{in: "${HOST:-fallback}", want: "api.internal"},
+		{in: "${EMPTY}", want: ""},
+		{in: "${PORT:-}", want: ""},
+		{in: "no references", want: "no references"},
+		{in: "${PORT}", err: "environment variable PORT is not set"},
+		{in: "${HOST", err: "unterminated ${"},
+	}
+	for _, tt := range tests {
+		got, err := expandEnv(tt.in, lookup)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expandEnv(%q) err = %v, want %q", tt.in, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("expandEnv(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestInterpolatedConfig(t *testing.T) {
+	t.Setenv("API_HOST", "api.internal")
+	tests := []struct {
+		file, data, err string
+	}{
+		{file: "router.json", data: `{
+			// the API backend
+			"rules": [{"service": "api", "destination": "http://${API_HOST}:${API_PORT:-8080}"}] /* one rule */
+		}`},
+		{file: "router.yaml", data: "rules:\n  - service: api # the API backend\n    destination: http://${API_HOST}:${API_PORT:-8080}\n"},
+		{file: "router.json", data: `{"rules": [{"service": "api", "destination": "http://${MISSING_HOST}"}]}`, err: "MISSING_HOST is not set"},
+		{file: "router.yaml", data: "rules:\n  - service: api\n    destination: http://${MISSING_HOST}\n", err: "line 3: environment variable MISSING_HOST is not set"},
+		{file: "router.json", data: `{"rules": [] /* open`, err: "unterminated /* comment"},
+	}
+	for _, tt := range tests {
+		var config RouterConfig
+		err := unmarshalConfig(tt.file, []byte(tt.data), &config, true)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: err = %v, want %q", tt.file, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		if got := config.Rules[0].Destination; got != "http://api.internal:8080" {
+			t.Errorf("%s: destination = %q", tt.file, got)
+		}
+		if !config.interpolated {
+			t.Errorf("%s: config not marked interpolated", tt.file)
+		}
+	}
+}
+
+// TestInterpolatedConfigNotSaved checks that rule changes are refused
+// rather than saving a config's ${VAR} references as their values
+func TestInterpolatedConfigNotSaved(t *testing.T) {
+	t.Setenv("API_HOST", "api.internal")
+	file := filepath.Join(t.TempDir(), "router.json")
+	raw := `{"rules":[{"service":"api","destination":"http://${API_HOST}:8080"}]}`
+	if err := os.WriteFile(file, []byte(raw), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	router, err := NewRouter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer router.Close()
+	mux := adminMux(router, NewSessionManager(nil), file, nil)
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/rules", strings.NewReader(`{"service":"web","destination":"http://w:1"}`)),
+		httptest.NewRequest(http.MethodDelete, "/rules/api", nil),
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "config_interpolated") {
+			t.Errorf("%s %s = %d %s, want 409 config_interpolated", req.Method, req.URL.Path, rec.Code, rec.Body)
+		}
+	}
+	if rules := router.ListRules(); len(rules) != 1 {
+		t.Errorf("refused changes were applied: %d rules", len(rules))
+	}
+	if err := router.SaveConfig(file); err != errInterpolatedConfig {
+		t.Errorf("SaveConfig err = %v, want errInterpolatedConfig", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != raw {
+		t.Errorf("config file rewritten to %s", data)
+	}
+}
@@ -0,0 +1,53 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// unixPrefix marks a listen address as the path of a Unix domain socket
+const unixPrefix = "unix:"
+
+// listenAddrs splits a comma-separated listen setting into its addresses
+func listenAddrs(setting string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(setting, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// tcpAddr returns the first TCP address of a listen setting, or "" if it
+// only has Unix sockets
+func tcpAddr(setting string) string {
+	for _, addr := range listenAddrs(setting) {
+		if !strings.HasPrefix(addr, unixPrefix) {
+			return addr
+		}
+	}
+	return ""
+}
+
+// listen binds addr, a TCP address or unix:/path for a Unix domain socket.
+// A socket file left behind by a process that is no longer listening on it
+// is replaced; the file is removed again when the listener is closed.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("socket %s is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket: %w", err)
+		}
+	}
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,101 @@
+package router
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestListenAddrs(t *testing.T) {
+	setting := " :8080, unix:/run/router.sock ,,127.0.0.1:9090"
+	if got, want := listenAddrs(setting), []string{":8080", "unix:/run/router.sock", "127.0.0.1:9090"}; !slices.Equal(got, want) {
+		t.Errorf("listenAddrs = %q, want %q", got, want)
+	}
+	tests := map[string]string{
+		":8080":                         ":8080",
+		"unix:/run/router.sock,:9090":   ":9090",
+		"unix:/run/a.sock,unix:/b.sock": "",
+	}
+	for setting, want := range tests {
+		if got := tcpAddr(setting); got != want {
+			t.Errorf("tcpAddr(%q) = %q, want %q", setting, got, want)
+		}
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	backend := newBackend(t, "api")
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL}}})
+	path := filepath.Join(t.TempDir(), "router.sock")
+	listener, err := listen(unixPrefix + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: router}
+	go server.Serve(listener)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	req, _ := http.NewRequest(http.MethodGet, "http://router/", nil)
+	req.Header.Set("X-Service-Type", "api")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "api" {
+		t.Errorf("request over the socket = %d %q, want 200 from api", resp.StatusCode, body)
+	}
+
+	if _, err := listen(unixPrefix + path); err == nil || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("listening on a socket in use err = %v, want in use", err)
+	}
+	client.CloseIdleConnections()
+	server.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file left after close: %v", err)
+	}
+}
+
+func TestListenReplacesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "router.sock")
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// As if the process had crashed, leaving the file behind.
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("stale socket file missing: %v", err)
+	}
+
+	listener, err := listen(unixPrefix + path)
+	if err != nil {
+		t.Fatalf("listening over a stale socket: %v", err)
+	}
+	listener.Close()
+
+	// A file that is not a socket is never removed.
+	regular := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(regular, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if listener, err := listen(unixPrefix + regular); err == nil {
+		listener.Close()
+		t.Error("listening over a regular file succeeded")
+	}
+	if data, err := os.ReadFile(regular); err != nil || string(data) != "{}" {
+		t.Errorf("regular file after listen = %q, %v", data, err)
+	}
+}
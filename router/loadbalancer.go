@@ -0,0 +1,144 @@
+package router
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Load balancing strategies of Rule.Strategy
+const (
+	StrategyRoundRobin       = "roundRobin"
+	StrategyWeighted         = "weighted"
+	StrategyRandom           = "random"
+	StrategyLeastConnections = "leastConnections"
+	StrategyIPHash           = "ipHash"
+	StrategyKeyHash          = "keyHash"
+)
+
+// Destination is a destination a LoadBalancer may pick, with its relative
+// weight and the number of requests it is currently serving
+type Destination struct {
+	Address string
+	Weight  int
+	Active  int64
+}
+
+// LoadBalancer picks the destination of a request among the available
+// destinations of a rule, which are never empty. A LoadBalancer is created
+// per rule and must be safe for concurrent use.
+type LoadBalancer interface {
+	Pick(destinations []Destination, req *http.Request) (Destination, error)
+}
+
+// BalancerFactory creates the LoadBalancer of a rule from its Strategy
+type BalancerFactory func(rule Rule) (LoadBalancer, error)
+
+// NewLoadBalancer creates the LoadBalancer of the rule's strategy, which
+// must be one of the built-in ones
+func NewLoadBalancer(rule Rule) (LoadBalancer, error) {
+	switch strategy := rule.strategy(); strategy {
+	case StrategyRoundRobin:
+		return &RoundRobin{}, nil
+	case StrategyWeighted:
+		return &Weighted{}, nil
+	case StrategyRandom:
+		return Random{}, nil
+	case StrategyLeastConnections:
+		return &LeastConnections{}, nil
+	case StrategyIPHash:
+		return &IPHash{}, nil
+	case StrategyKeyHash:
+		if rule.HashHeader == "" {
+			return nil, fmt.Errorf("strategy %s requires hashHeader", strategy)
+		}
+		return &KeyHash{Header: rule.HashHeader}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy %q", rule.Strategy)
+}
+
+// RoundRobin cycles through the destinations in order
+type RoundRobin struct {
+	next atomic.Uint64
+}
+
+func (b *RoundRobin) Pick(destinations []Destination, req *http.Request) (Destination, error) {
+	if len(destinations) == 0 {
+		return Destination{}, errNoDestination
+	}
+	n := b.next.Add(1) - 1
+	return destinations[n%uint64(len(destinations))], nil
+}
+
+// Weighted picks destinations in proportion to their weights using smooth
+// weighted round-robin, so a 4:1 split is served as a,a,b,a,a rather than
+// a,a,a,a,b
+type Weighted struct {
+	mu      sync.Mutex
+	current map[string]int // running weight by address
+}
+
+func (b *Weighted) Pick(destinations []Destination, req *http.Request) (Destination, error) {
+	if len(destinations) == 0 {
+		return Destination{}, errNoDestination
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.current == nil {
+		b.current = make(map[string]int)
+	}
+	total, best := 0, 0
+	for i, d := range destinations {
+		total += d.Weight
+		b.current[d.Address] += d.Weight
+		if b.current[d.Address] > b.current[destinations[best].Address] {
+			best = i
+		}
+	}
+	b.current[destinations[best].Address] -= total
+	return destinations[best], nil
+}
+
+// Random picks a destination at random, in proportion to the weights
+type Random struct{}
+
+func (Random) Pick(destinations []Destination, req *http.Request) (Destination, error) {
+	total := 0
+	for _, d := range destinations {
+		total += d.Weight
+	}
+	if total <= 0 {
+		return Destination{}, errNoDestination
+	}
+	n := rand.IntN(total)
+	for _, d := range destinations {
+		if n -= d.Weight; n < 0 {
+			return d, nil
+		}
+	}
+	return destinations[len(destinations)-1], nil
+}
+
+// LeastConnections picks the destination serving the fewest requests
+// relative to its weight. Ties rotate, so idle destinations share traffic.
+type LeastConnections struct {
+	next atomic.Uint64
+}
+
+func (b *LeastConnections) Pick(destinations []Destination, req *http.Request) (Destination, error) {
+	if len(destinations) == 0 {
+		return Destination{}, errNoDestination
+	}
+	start := b.next.Add(1) - 1
+	best := destinations[start%uint64(len(destinations))]
+	for i := 1; i < len(destinations); i++ {
+		d := destinations[(start+uint64(i))%uint64(len(destinations))]
+		// d.Active/d.Weight < best.Active/best.Weight, without dividing
+		if d.Active*int64(best.Weight) < best.Active*int64(d.Weight) {
+			best = d
+		}
+	}
+	return best, nil
+}
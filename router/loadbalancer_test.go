@@ -0,0 +1,225 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLeastConnectionsPick(t *testing.T) {
+	tests := []struct {
+		name         string
+		destinations []Destination
+		want         string
+	}{
+		{"fewest active", []Destination{{"a", 1, 3}, {"b", 1, 1}, {"c", 1, 2}}, "b"},
+		{"relative to weight", []Destination{{"a", 1, 2}, {"b", 4, 4}}, "b"},
+		{"idle beats weighted busy", []Destination{{"a", 1, 0}, {"b", 10, 1}}, "a"},
+	}
+	for _, tt := range tests {
+		var b LeastConnections
+		for i := 0; i < len(tt.destinations); i++ {
+			if got, err := b.Pick(tt.destinations, nil); err != nil || got.Address != tt.want {
+				t.Errorf("%s: pick %d = %q, %v, want %q", tt.name, i+1, got.Address, err, tt.want)
+			}
+		}
+	}
+
+	// Idle destinations take turns.
+	var b LeastConnections
+	idle := []Destination{{"a", 1, 0}, {"b", 1, 0}, {"c", 1, 0}}
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		picked, _ := b.Pick(idle, nil)
+		seen[picked.Address] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("three picks among idle destinations reached %d of them, want all 3", len(seen))
+	}
+	if _, err := b.Pick(nil, nil); err == nil {
+		t.Error("picking among no destinations succeeded")
+	}
+}
+
+func TestLeastConnectionsAvoidsSlowBackend(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+	slow, entered := newBlockingBackend(t, "slow", unblock)
+	fast := newBackend(t, "fast")
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{
+		Service:      "api",
+		Destinations: []string{slow.URL, fast.URL},
+		Strategy:     StrategyLeastConnections,
+	}}})
+
+	// Send requests one at a time until the slow backend holds one.
+	for busy := false; !busy; {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			serve(router, serviceRequest("api", ""))
+		}()
+		select {
+		case <-entered:
+			busy = true
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the slow backend never got a request")
+		}
+	}
+	for i := 0; i < 20; i++ {
+		if rec, got := serve(router, serviceRequest("api", "")); rec.Code != http.StatusOK || got != "fast" {
+			t.Fatalf("request %d while slow was busy = %d %q, want 200 from fast", i+1, rec.Code, got)
+		}
+	}
+	select {
+	case <-entered:
+		t.Error("the slow backend got a second request while busy")
+	default:
+	}
+}
+
+func TestRoundRobinPick(t *testing.T) {
+	var b RoundRobin
+	destinations := []Destination{{Address: "a"}, {Address: "b"}, {Address: "c"}}
+	var got []string
+	for i := 0; i < 6; i++ {
+		d, _ := b.Pick(destinations, nil)
+		got = append(got, d.Address)
+	}
+	if !slices.Equal(got, []string{"a", "b", "c", "a", "b", "c"}) {
+		t.Errorf("round-robin picked %v", got)
+	}
+}
+
+func TestWeightedPick(t *testing.T) {
+	var b Weighted
+	destinations := []Destination{{Address: "a", Weight: 4}, {Address: "b", Weight: 1}}
+	var got []string
+	for i := 0; i < 10; i++ {
+		d, _ := b.Pick(destinations, nil)
+		got = append(got, d.Address)
+	}
+	// Smooth weighted round-robin spreads b's turns out.
+	if want := []string{"a", "a", "b", "a", "a", "a", "a", "b", "a", "a"}; !slices.Equal(got, want) {
+		t.Errorf("weighted picked %v, want %v", got, want)
+	}
+}
+
+func TestRandomPick(t *testing.T) {
+	destinations := []Destination{{Address: "a", Weight: 3}, {Address: "b", Weight: 1}, {Address: "none", Weight: 0}}
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		d, err := Random{}.Pick(destinations, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[d.Address]++
+	}
+	if counts["none"] != 0 || counts["a"] < 2800 || counts["a"] > 3200 {
+		t.Errorf("random picks = %v, want about 3000 a, 1000 b and no none", counts)
+	}
+	if _, err := (Random{}).Pick([]Destination{{Address: "a"}}, nil); err == nil {
+		t.Error("picking among zero weights succeeded")
+	}
+}
+
+func TestHashPick(t *testing.T) {
+	destinations := []Destination{{Address: "a", Weight: 1}, {Address: "b", Weight: 1}, {Address: "c", Weight: 1}}
+	request := func(remoteAddr, key string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		if key != "" {
+			req.Header.Set("X-Cache-Key", key)
+		}
+		return req
+	}
+	ipHash := new(IPHash)
+	keyHash := &KeyHash{Header: "X-Cache-Key"}
+	for i := 0; i < 20; i++ {
+		ip := fmt.Sprintf("192.0.2.%d", i)
+		first, _ := ipHash.Pick(destinations, request(ip+":1000", ""))
+		if again, _ := ipHash.Pick(destinations, request(ip+":2000", "")); again.Address != first.Address {
+			t.Errorf("ipHash sent %s to %s, then from another port to %s", ip, first.Address, again.Address)
+		}
+
+		key := fmt.Sprintf("object-%d", i)
+		first, _ = keyHash.Pick(destinations, request("192.0.2.1:1000", key))
+		if again, _ := keyHash.Pick(destinations, request("198.51.100.1:1000", key)); again.Address != first.Address {
+			t.Errorf("keyHash sent %s to %s, then from another client to %s", key, first.Address, again.Address)
+		}
+	}
+	// Without the header keyHash falls back to the client IP.
+	byIP, _ := ipHash.Pick(destinations, request("192.0.2.7:1000", ""))
+	if byKey, _ := keyHash.Pick(destinations, request("192.0.2.7:1000", "")); byKey.Address != byIP.Address {
+		t.Errorf("keyHash without the header picked %s, ipHash %s", byKey.Address, byIP.Address)
+	}
+}
+
+func TestNewLoadBalancer(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		want LoadBalancer
+		err  string
+	}{
+		{rule: Rule{}, want: &RoundRobin{}},
+		{rule: Rule{Weights: []WeightedDestination{{"a", 1}}}, want: &Weighted{}},
+		{rule: Rule{Strategy: StrategyRandom}, want: Random{}},
+		{rule: Rule{Strategy: StrategyLeastConnections}, want: &LeastConnections{}},
+		{rule: Rule{Strategy: StrategyIPHash}, want: &IPHash{}},
+		{rule: Rule{Strategy: StrategyKeyHash, HashHeader: "X-Key"}, want: &KeyHash{Header: "X-Key"}},
+		{rule: Rule{Strategy: StrategyKeyHash}, err: "strategy keyHash requires hashHeader"},
+		{rule: Rule{Strategy: "fastest"}, err: `unknown strategy "fastest"`},
+	}
+	for _, tt := range tests {
+		b, err := NewLoadBalancer(tt.rule)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("NewLoadBalancer(%q) err = %v, want %q", tt.rule.Strategy, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || fmt.Sprintf("%T", b) != fmt.Sprintf("%T", tt.want) {
+			t.Errorf("NewLoadBalancer(%q) = %T, %v, want %T", tt.rule.Strategy, b, err, tt.want)
+		}
+	}
+}
+
+func TestUnknownStrategyFailsValidation(t *testing.T) {
+	config := &RouterConfig{Rules: []Rule{{Service: "api", Destination: "http://a:1", Strategy: "fastest"}}}
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), `unknown strategy "fastest"`) {
+		t.Errorf("Validate() = %v, want an unknown strategy error", err)
+	}
+	if _, err := New(WithConfig(&RouterConfig{}), WithStrategy("fastest")); err == nil {
+		t.Error("New accepted an unknown default strategy")
+	}
+}
+
+// firstBalancer always picks the first destination offered
+type firstBalancer struct{}
+
+func (firstBalancer) Pick(destinations []Destination, req *http.Request) (Destination, error) {
+	return destinations[0], nil
+}
+
+func TestBalancerFactory(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destinations: []string{a.URL, b.URL}}}})
+	var created []string
+	router.Balancers = func(rule Rule) (LoadBalancer, error) {
+		created = append(created, rule.key())
+		return firstBalancer{}, nil
+	}
+	for i := 0; i < 3; i++ {
+		if _, got := serve(router, serviceRequest("api", "")); got != "a" {
+			t.Errorf("request %d went to %q, want a from the custom balancer", i+1, got)
+		}
+	}
+	if len(created) != 1 {
+		t.Errorf("factory called %d times, want once per rule", len(created))
+	}
+}
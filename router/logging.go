@@ -0,0 +1,108 @@
+package router
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logger returns the router's logger, falling back to the slog default
+func (r *Router) logger() *slog.Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+	return slog.Default()
+}
+
+// statusRecorder captures the status code written through a ResponseWriter
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// accessLog describes a single handled request
+type accessLog struct {
+	sourceIP    string
+	service     string
+	owner       string // the Service of the matched rule
+	destination string
+	matched     bool
+}
+
+// sampleKey identifies req for log sampling: its trace ID when it is
+// traced, so every service samples a trace alike, or else its request ID
+func sampleKey(req *http.Request) string {
+	if sc := trace.SpanContextFromContext(req.Context()); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return RequestID(req.Context())
+}
+
+// sampled reports whether a successful request is logged under rate, the
+// fraction of requests to log. The decision is a hash of the request's
+// sampleKey, so the same request is always sampled the same way.
+func sampled(req *http.Request, rate float64) bool {
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+	key := sampleKey(req)
+	if key == "" {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return float64(h.Sum64()) < rate*math.MaxUint64
+}
+
+// logRequest emits one structured record for a handled request. Requests that
+// matched no rule are logged at warn level with the service that was asked for.
+// Successful requests are subject to LogSampleRate; errors are always logged.
+// Matched requests go to the AccessLoggers of their rule's service, if any.
+func (r *Router) logRequest(req *http.Request, entry *accessLog, status int, start time.Time) {
+	level := slog.LevelInfo
+	msg := "request"
+	if !entry.matched {
+		level = slog.LevelWarn
+		msg = "no route"
+	} else if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	if level == slog.LevelInfo && status < http.StatusBadRequest {
+		r.mu.RLock()
+		rate := r.LogSampleRate
+		r.mu.RUnlock()
+		if !sampled(req, rate) {
+			return
+		}
+	}
+	logger := r.logger()
+	if entry.matched && entry.owner != "" && entry.owner != matcherService && r.AccessLoggers != nil {
+		if l := r.AccessLoggers(entry.owner); l != nil {
+			logger = l
+		}
+	}
+	logger.LogAttrs(req.Context(), level, msg,
+		slog.String("requestID", RequestID(req.Context())),
+		slog.String("method", req.Method),
+		slog.String("path", req.URL.Path),
+		slog.String("sourceIP", entry.sourceIP),
+		slog.String("service", entry.service),
+		slog.String("destination", entry.destination),
+		slog.Int("status", status),
+		slog.Duration("duration", time.Since(start)),
+	)
+}
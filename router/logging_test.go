@@ -0,0 +1,99 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// logRecorder is a slog.Handler keeping the message of every record by level
+type logRecorder struct {
+	mu      sync.Mutex
+	records map[slog.Level][]string
+}
+
+func (lr *logRecorder) Enabled(context.Context, slog.Level) bool { return true }
+func (lr *logRecorder) WithAttrs([]slog.Attr) slog.Handler       { return lr }
+func (lr *logRecorder) WithGroup(string) slog.Handler            { return lr }
+
+func (lr *logRecorder) Handle(_ context.Context, record slog.Record) error {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if lr.records == nil {
+		lr.records = make(map[slog.Level][]string)
+	}
+	lr.records[record.Level] = append(lr.records[record.Level], record.Message)
+	return nil
+}
+
+// count returns how many records of level had message msg
+func (lr *logRecorder) count(level slog.Level, msg string) int {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	n := 0
+	for _, m := range lr.records[level] {
+		if m == msg {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLogSampleRate(t *testing.T) {
+	backend := newBackend(t, "api")
+	failing := newCountingBackend(t, "failing", http.StatusBadGateway, new(atomic.Int32))
+	var logs logRecorder
+	router := newTestRouter(t, &RouterConfig{
+		LogSampleRate: 0.1,
+		Rules: []Rule{
+			{Service: "api", Destination: backend.URL},
+			{Service: "failing", Destination: failing.URL},
+		},
+	}, WithLogger(slog.New(&logs)))
+
+	const requests = 2000
+	for i := 0; i < requests; i++ {
+		serve(router, serviceRequest("api", ""))
+	}
+	// 10% of 2000 has a standard deviation of about 13.
+	if n := logs.count(slog.LevelInfo, "request"); n < 140 || n > 260 {
+		t.Errorf("logged %d of %d successful requests, want about 200", n, requests)
+	}
+
+	for i := 0; i < 100; i++ {
+		serve(router, serviceRequest("failing", ""))
+		serve(router, serviceRequest("missing", ""))
+	}
+	if n := logs.count(slog.LevelError, "request"); n != 100 {
+		t.Errorf("logged %d of 100 failed requests, want all", n)
+	}
+	if n := logs.count(slog.LevelWarn, "no route"); n != 100 {
+		t.Errorf("logged %d of 100 unrouted requests, want all", n)
+	}
+}
+
+func TestSampledDeterministic(t *testing.T) {
+	backend := newBackend(t, "api")
+	var logs logRecorder
+	router := newTestRouter(t, &RouterConfig{
+		LogSampleRate: 0.5,
+		Rules:         []Rule{{Service: "api", Destination: backend.URL}},
+	}, WithLogger(slog.New(&logs)))
+
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("request-%d", i)
+		before := logs.count(slog.LevelInfo, "request")
+		for j := 0; j < 5; j++ {
+			req := serviceRequest("api", "")
+			req.Header.Set(requestIDHeader, id)
+			serve(router, req)
+		}
+		if n := logs.count(slog.LevelInfo, "request") - before; n != 0 && n != 5 {
+			t.Errorf("request ID %s was logged %d of 5 times, want always or never", id, n)
+		}
+	}
+}
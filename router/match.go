@@ -0,0 +1,270 @@
+package router
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// errRouteNotFound is returned when no rule matches a request
+	errRouteNotFound = errors.New("service not found")
+	// errNoDestination is returned when a rule matches but none of its destinations is available
+	errNoDestination = errors.New("no destination available")
+)
+
+// key identifies the rule for per-rule balancing state and duplicate detection
+func (rule Rule) key() string {
+	key := rule.Service
+	if rule.Pattern != "" {
+		key += "~" + rule.Pattern
+	}
+	if rule.Host != "" || rule.PathPrefix != "" {
+		key += "|" + rule.Host + rule.PathPrefix
+	}
+	if len(rule.Methods) > 0 {
+		key += "@" + strings.ToUpper(strings.Join(rule.Methods, ","))
+	}
+	if rule.Schedule != nil {
+		key += "[" + rule.Schedule.String() + "]"
+	}
+	return key
+}
+
+// allowsMethod reports whether the rule applies to requests with method;
+// a rule without Methods allows them all
+func (rule Rule) allowsMethod(method string) bool {
+	if len(rule.Methods) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(rule.Methods, func(m string) bool { return strings.EqualFold(m, method) })
+}
+
+// anchorPattern makes a Pattern match whole service names only
+func anchorPattern(pattern string) string {
+	return "^(?:" + pattern + ")$"
+}
+
+// compile caches the rule's compiled Pattern, parsed access list, parsed
+// destinations and parsed Schedule. All are checked by Validate, so a
+// pattern that fails to compile simply never matches.
+func (rule *Rule) compile() {
+	rule.pattern = nil
+	if rule.Pattern != "" {
+		rule.pattern, _ = regexp.Compile(anchorPattern(rule.Pattern))
+	}
+	rule.access, _ = parseAccessList(rule.Allow, rule.Deny)
+	rule.compileUpstreams()
+	rule.window, _ = parseSchedule(rule.Schedule)
+}
+
+// ruleIndex groups the rules by how they are matched, so a request only
+// looks at the rules that can apply to it. Entries are indexes into Rules.
+type ruleIndex struct {
+	byService map[string][]int // rules by exact Service, in config order
+	patterns  []int            // rules with a Pattern, in config order
+	byHost    map[string][]int // host and prefix rules by exact Host, longest prefix first
+	fallback  []int            // host and prefix rules for wildcard or no Host, most specific first
+	byQuery   map[string][]int // rules with a QueryParam by its name, in config order
+	params    []string         // the QueryParam names, in config order
+}
+
+// hostPathRule reports whether rule applies to requests without an
+// X-Service-Type header: it has a PathPrefix, or only a Host
+func (rule Rule) hostPathRule() bool {
+	return rule.PathPrefix != "" || (rule.Host != "" && rule.Service == "" && rule.Pattern == "")
+}
+
+// wildcardScore is the hostScore of the rule for any host its wildcard
+// matches, or 0 without a Host
+func (rule Rule) wildcardScore() int {
+	if suffix, ok := strings.CutPrefix(rule.Host, "*"); ok {
+		return len(suffix)
+	}
+	return 0
+}
+
+// buildIndex indexes rules. The ordered slices are sorted so that the first
+// rule that matches a request is the one the built-in matchers must pick.
+func buildIndex(rules []Rule) ruleIndex {
+	index := ruleIndex{byService: make(map[string][]int), byHost: make(map[string][]int), byQuery: make(map[string][]int)}
+	for i, rule := range rules {
+		if rule.QueryParam != "" {
+			if _, ok := index.byQuery[rule.QueryParam]; !ok {
+				index.params = append(index.params, rule.QueryParam)
+			}
+			index.byQuery[rule.QueryParam] = append(index.byQuery[rule.QueryParam], i)
+		}
+		if rule.Service != "" {
+			index.byService[rule.Service] = append(index.byService[rule.Service], i)
+		}
+		if rule.Pattern != "" {
+			index.patterns = append(index.patterns, i)
+		}
+		if !rule.hostPathRule() {
+			continue
+		}
+		if rule.Host != "" && !strings.HasPrefix(rule.Host, "*") {
+			host := strings.ToLower(rule.Host)
+			index.byHost[host] = append(index.byHost[host], i)
+		} else {
+			index.fallback = append(index.fallback, i)
+		}
+	}
+	byPrefix := func(a, b int) int { return len(rules[b].PathPrefix) - len(rules[a].PathPrefix) }
+	for _, indexes := range index.byHost {
+		slices.SortStableFunc(indexes, byPrefix)
+	}
+	slices.SortStableFunc(index.fallback, func(a, b int) int {
+		if d := rules[b].wildcardScore() - rules[a].wildcardScore(); d != 0 {
+			return d
+		}
+		return byPrefix(a, b)
+	})
+	return index
+}
+
+// compileRules compiles every rule in place
+func compileRules(rules []Rule) {
+	for i := range rules {
+		rules[i].compile()
+	}
+}
+
+// matchesPath reports whether path falls under the rule's prefix on a segment boundary
+func (rule Rule) matchesPath(path string) bool {
+	prefix := rule.PathPrefix
+	if prefix == "" || !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// exactHostScore is added to exact host matches so they outrank any wildcard
+const exactHostScore = 1 << 16
+
+// hostScore ranks how specifically pattern matches host. A rule without a
+// host scores 0, wildcards score the length of their suffix so that
+// *.api.example.com beats *.example.com, exact matches beat every wildcard,
+// and -1 means the rule does not apply to host.
+func hostScore(pattern, host string) int {
+	if pattern == "" {
+		return 0
+	}
+	pattern = strings.ToLower(pattern)
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+			return len(suffix)
+		}
+		return -1
+	}
+	if pattern == host {
+		return exactHostScore + len(pattern)
+	}
+	return -1
+}
+
+// normalizeHost lowercases host and strips any port
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// defaultService names the rule standing in for the Default destination
+const defaultService = "(default)"
+
+// defaultRule returns the rule used for requests no configured rule matches
+func (r *Router) defaultRule() Rule {
+	return Rule{Service: defaultService, Destination: r.Default}
+}
+
+// routingInputs returns the parts of req that routing decisions are based
+// on: the X-Service-Type header naming the service, the host and the path
+func routingInputs(req *http.Request) (service, host, path string) {
+	return req.Header.Get("X-Service-Type"), req.Host, req.URL.Path
+}
+
+// matchQuery returns the index of the rule matching the query parameters
+// of a request without a service, or -1. Parameters are tried in the order
+// the rules name them; for each one the request carries, a rule whose
+// Service equals its value wins over one whose Pattern matches it. A rule
+// that also sets a PathPrefix only applies under it.
+func (r *Router) matchQuery(query url.Values, host, path, method string) int {
+	for _, param := range r.index.params {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		indexes := r.index.byQuery[param]
+		underPrefix := func(rule Rule) bool { return rule.PathPrefix == "" || rule.matchesPath(path) }
+		if i := r.bestHost(indexes, host, method, func(rule Rule) bool {
+			return rule.Service == value && underPrefix(rule)
+		}); i >= 0 {
+			return i
+		}
+		if i := r.bestHost(indexes, host, method, func(rule Rule) bool {
+			return rule.Service != value && rule.pattern != nil && rule.pattern.MatchString(value) && underPrefix(rule)
+		}); i >= 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// bestHost returns whichever of the rules at indexes that allow method, are
+// in schedule and are accepted by keep (all of them if nil) best matches
+// host, or -1
+func (r *Router) bestHost(indexes []int, host, method string, keep func(Rule) bool) int {
+	best, bestHost := -1, 0
+	for _, i := range indexes {
+		rule := r.Rules[i]
+		if !rule.allowsMethod(method) || !r.inSchedule(rule) || (keep != nil && !keep(rule)) {
+			continue
+		}
+		if hs := hostScore(rule.Host, host); hs >= 0 && (best < 0 || hs > bestHost) {
+			best, bestHost = i, hs
+		}
+	}
+	return best
+}
+
+// match returns the rule the matcher chain picks for req and a destination
+// for it: the one pin returns for the rule if it returns ok, or else the one
+// the rule's balancer picks. pin may be nil. It returns errRouteNotFound if
+// no rule matches and errNoDestination if the rule has no destination
+// currently available. The caller must hold r.mu.
+func (r *Router) match(req *http.Request, pin func(Rule) (string, bool)) (Rule, string, error) {
+	rule, err := r.matchedRule(req)
+	if err != nil {
+		return Rule{}, "", err
+	}
+	if pin != nil {
+		if destination, ok := pin(rule); ok {
+			return rule, destination, nil
+		}
+	}
+	if destination := r.pickDestination(rule, req); destination != "" {
+		return rule, destination, nil
+	}
+	return rule, "", errNoDestination
+}
+
+// matchedRule returns the rule the matcher chain picks for req, falling
+// back to the Default destination. It returns errRouteNotFound if no rule
+// matches and there is no Default. The caller must hold r.mu.
+func (r *Router) matchedRule(req *http.Request) (Rule, error) {
+	rule, ok := r.matchChain(req)
+	if !ok && r.Default == "" {
+		return Rule{}, errRouteNotFound
+	}
+	if !ok {
+		rule = r.defaultRule()
+	}
+	return rule, nil
+}
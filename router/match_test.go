@@ -0,0 +1,279 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// routeCase is a request and the destination it must be routed to, "" for
+// none
+type routeCase struct {
+	method, service, host, path, want string
+}
+
+// checkRoutes routes each case through router and checks its destination
+func checkRoutes(t *testing.T, router *Router, cases []routeCase) {
+	t.Helper()
+	for _, tt := range cases {
+		method := tt.method
+		if method == "" {
+			method = http.MethodGet
+		}
+		req := httptest.NewRequest(method, "http://localhost"+tt.path, nil)
+		if tt.host != "" {
+			req.Host = tt.host
+		}
+		if tt.service != "" {
+			req.Header.Set("X-Service-Type", tt.service)
+		}
+		got, ok := router.RouteRequest(req)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("%s %s%s (service %q) routed to %q, %v, want %q", method, tt.host, tt.path, tt.service, got, ok, tt.want)
+		}
+	}
+}
+
+func TestPathPrefixRouting(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{PathPrefix: "/api", Destination: "http://api:1"},
+		{PathPrefix: "/api/v2", Destination: "http://api-v2:1"},
+		{PathPrefix: "/static/", Destination: "http://static:1"},
+		{Service: "users", PathPrefix: "/users", Destination: "http://users:1"},
+	}})
+	checkRoutes(t, router, []routeCase{
+		{path: "/api", want: "http://api:1"},
+		{path: "/api/users", want: "http://api:1"},
+		{path: "/api/v2", want: "http://api-v2:1"},
+		{path: "/api/v2/users", want: "http://api-v2:1"},
+		{path: "/api/v2beta", want: "http://api:1"},
+		{path: "/apis", want: ""},
+		{path: "/static/app.js", want: "http://static:1"},
+		{path: "/other", want: ""},
+		// The header takes precedence over the path.
+		{service: "users", path: "/api/v2", want: "http://users:1"},
+		{path: "/users/1", want: "http://users:1"},
+	})
+}
+
+func TestMethodRouting(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{
+		Default: "http://fallback:1",
+		Rules: []Rule{
+			{Service: "api", Methods: []string{"get", "HEAD"}, Destination: "http://replica:1"},
+			{Service: "api", Methods: []string{"POST"}, Destination: "http://primary:1"},
+			{PathPrefix: "/upload", Methods: []string{"PUT"}, Destination: "http://uploads:1"},
+			{PathPrefix: "/", Destination: "http://web:1"},
+		},
+	})
+	tests := []struct {
+		method, service, path, want string
+	}{
+		{http.MethodGet, "api", "/", "http://replica:1"},
+		{http.MethodHead, "api", "/", "http://replica:1"},
+		{http.MethodPost, "api", "/", "http://primary:1"},
+		{http.MethodDelete, "api", "/", "http://fallback:1"},
+		{http.MethodPut, "", "/upload/a", "http://uploads:1"},
+		{http.MethodGet, "", "/upload/a", "http://web:1"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.service != "" {
+			req.Header.Set("X-Service-Type", tt.service)
+		}
+		if got, ok := router.RouteRequest(req); !ok || got != tt.want {
+			t.Errorf("%s %s (service %q) routed to %q, %v, want %q", tt.method, tt.path, tt.service, got, ok, tt.want)
+		}
+	}
+}
+
+func TestHostRouting(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Host: "*.example.com", Destination: "http://wildcard:1"},
+		{Host: "*.api.example.com", Destination: "http://api-wildcard:1"},
+		{Host: "shop.example.com", Destination: "http://shop:1"},
+		{Host: "shop.example.com", PathPrefix: "/cart", Destination: "http://cart:1"},
+		{Host: "*.example.com", PathPrefix: "/cart", Destination: "http://any-cart:1"},
+		{Service: "billing", Host: "pay.example.com", Destination: "http://billing:1"},
+		{Service: "billing", Destination: "http://billing-default:1"},
+	}})
+	checkRoutes(t, router, []routeCase{
+		{host: "shop.example.com", path: "/", want: "http://shop:1"},
+		{host: "SHOP.example.com:8443", path: "/", want: "http://shop:1"},
+		{host: "blog.example.com", path: "/", want: "http://wildcard:1"},
+		{host: "v1.api.example.com", path: "/", want: "http://api-wildcard:1"},
+		{host: "example.com", path: "/", want: ""},
+		{host: "other.org", path: "/", want: ""},
+		// An exact host beats a wildcard, even one with a longer prefix.
+		{host: "shop.example.com", path: "/cart/1", want: "http://cart:1"},
+		{host: "blog.example.com", path: "/cart/1", want: "http://any-cart:1"},
+		// Rules with both a Service and a Host need both to match.
+		{service: "billing", host: "pay.example.com", path: "/", want: "http://billing:1"},
+		{service: "billing", host: "shop.example.com", path: "/", want: "http://billing-default:1"},
+	})
+}
+
+func TestPatternRouting(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Pattern: "payments-.*", Destination: "http://payments:1"},
+		{Service: "payments-eu", Destination: "http://payments-eu:1"},
+		{Pattern: "pay.*|billing", Destination: "http://pay:1"},
+	}})
+	checkRoutes(t, router, []routeCase{
+		{service: "payments-us", want: "http://payments:1"},
+		// An exact Service match wins over an earlier pattern.
+		{service: "payments-eu", want: "http://payments-eu:1"},
+		// Patterns must match the whole service name.
+		{service: "old-payments-us", want: ""},
+		{service: "billing", want: "http://pay:1"},
+		{service: "billing-v2", want: ""},
+		{service: "payroll", want: "http://pay:1"},
+	})
+}
+
+func TestMatchPrecedence(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		cases []routeCase
+	}{
+		{
+			name: "exact before pattern in config",
+			rules: []Rule{
+				{Service: "orders", Destination: "http://exact:1"},
+				{Pattern: "ord.*", Destination: "http://pattern:1"},
+			},
+			cases: []routeCase{{service: "orders", want: "http://exact:1"}, {service: "ordering", want: "http://pattern:1"}},
+		},
+		{
+			name: "exact after pattern in config",
+			rules: []Rule{
+				{Pattern: "ord.*", Destination: "http://pattern:1"},
+				{Service: "orders", Destination: "http://exact:1"},
+			},
+			cases: []routeCase{{service: "orders", want: "http://exact:1"}},
+		},
+		{
+			name: "first pattern in config order",
+			rules: []Rule{
+				{Pattern: "ord.*", Destination: "http://first:1"},
+				{Pattern: "orders|refunds", Destination: "http://second:1"},
+			},
+			cases: []routeCase{{service: "orders", want: "http://first:1"}, {service: "refunds", want: "http://second:1"}},
+		},
+		{
+			name: "service header before path",
+			rules: []Rule{
+				{PathPrefix: "/orders", Destination: "http://path:1"},
+				{Pattern: "ord.*", Destination: "http://pattern:1"},
+			},
+			cases: []routeCase{{service: "orders", path: "/orders", want: "http://pattern:1"}, {path: "/orders", want: "http://path:1"}},
+		},
+		{
+			name: "exact host before wildcard and longest prefix",
+			rules: []Rule{
+				{Host: "*.example.com", PathPrefix: "/", Destination: "http://wildcard:1"},
+				{Host: "api.example.com", PathPrefix: "/", Destination: "http://host:1"},
+				{Host: "api.example.com", PathPrefix: "/v2", Destination: "http://host-v2:1"},
+			},
+			cases: []routeCase{
+				{host: "api.example.com", path: "/v1", want: "http://host:1"},
+				{host: "api.example.com", path: "/v2/orders", want: "http://host-v2:1"},
+				{host: "www.example.com", path: "/v2", want: "http://wildcard:1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkRoutes(t, newTestRouter(t, &RouterConfig{Rules: tt.rules}), tt.cases)
+		})
+	}
+}
+
+func TestQueryParamRouting(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Service: "payments", QueryParam: "svc", Destination: "http://payments:1"},
+		{Service: "orders", QueryParam: "svc", Destination: "http://orders:1"},
+		{Pattern: "legacy-.*", QueryParam: "svc", Destination: "http://legacy:1"},
+		{Host: "api.example.com", Destination: "http://host:1"},
+	}})
+	checkRoutes(t, router, []routeCase{
+		{path: "/pay?svc=payments", want: "http://payments:1"},
+		{path: "/?svc=orders", want: "http://orders:1"},
+		{path: "/?svc=legacy-billing", want: "http://legacy:1"},
+		{path: "/?svc=unknown"},
+		{path: "/?other=payments"},
+		{path: "/"},
+		// The header takes precedence over the parameter.
+		{service: "orders", path: "/?svc=payments", want: "http://orders:1"},
+		{service: "payments", path: "/", want: "http://payments:1"},
+		// The parameter takes precedence over host and path rules.
+		{host: "api.example.com", path: "/?svc=payments", want: "http://payments:1"},
+		{host: "api.example.com", path: "/?svc=unknown", want: "http://host:1"},
+	})
+}
+
+func TestPatternValidation(t *testing.T) {
+	_, err := New(WithConfig(&RouterConfig{Rules: []Rule{{Pattern: "payments-(", Destination: "http://payments:1"}}}))
+	if err == nil || !strings.Contains(err.Error(), `pattern "payments-("`) {
+		t.Errorf("err = %v, want the pattern reported", err)
+	}
+}
+
+func TestServiceIndex(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Service: "api", Destination: "http://first:1"},
+		{Pattern: "^api-.*", Destination: "http://pattern:1"},
+		{Service: "web", Destination: "http://web:1"},
+	}})
+	checkRoutes(t, router, []routeCase{
+		{service: "api", want: "http://first:1"},
+		{service: "api-v2", want: "http://pattern:1"},
+		{service: "web", want: "http://web:1"},
+		{service: "other"},
+	})
+
+	// Replacing the rules, as a reload does, must rebuild the index.
+	router.SetRules([]Rule{
+		{Service: "web", Destination: "http://web2:1"},
+		{Service: "new", Destination: "http://new:1"},
+	})
+	checkRoutes(t, router, []routeCase{
+		{service: "api"},
+		{service: "api-v2"},
+		{service: "web", want: "http://web2:1"},
+		{service: "new", want: "http://new:1"},
+	})
+	if err := router.AddRule(Rule{Service: "added", Destination: "http://added:1"}); err != nil {
+		t.Fatal(err)
+	}
+	checkRoutes(t, router, []routeCase{{service: "added", want: "http://added:1"}})
+}
+
+// BenchmarkRouteRequest routes the last of n exact service rules, which a
+// linear scan would reach only after checking every other rule
+func BenchmarkRouteRequest(b *testing.B) {
+	for _, n := range []int{10, 100, 10000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			rules := make([]Rule, n)
+			for i := range rules {
+				rules[i] = Rule{Service: "service-" + strconv.Itoa(i), Destination: "http://backend-" + strconv.Itoa(i) + ":1"}
+			}
+			router, err := New(WithConfig(&RouterConfig{Rules: rules}))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer router.Close()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("X-Service-Type", "service-"+strconv.Itoa(n-1))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, ok := router.RouteRequest(req); !ok {
+					b.Fatal("no route")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package router
+
+import "net/http"
+
+// Matcher picks the destination of a request, for routing on what the
+// rules cannot express such as a JWT claim or the time of day. The Router
+// tries its Matchers in order and the first that matches routes the
+// request. Matchers are called with the router locked for reading, so they
+// must not call back into it, and must be safe for concurrent use.
+type Matcher interface {
+	Match(req *http.Request) (destination string, matched bool)
+}
+
+// ruleMatcher is implemented by the built-in matchers, which match one of
+// the router's rules so that the request is handled under that rule's
+// settings rather than only sent to a destination
+type ruleMatcher interface {
+	// matchRule returns the index of the matched rule, or -1. The caller
+	// must hold r.mu.
+	matchRule(req *http.Request) int
+}
+
+// matcherService names the rule standing in for a destination picked by a
+// Matcher that is not built in
+const matcherService = "(matcher)"
+
+// BuiltinMatchers returns the matchers of the router's rules, which are the
+// Matchers of a new Router. They apply in this order of precedence:
+//
+//  1. With an X-Service-Type service, rules whose Service equals it exactly.
+//  2. Then rules whose Pattern matches the service.
+//  3. Without a service, rules with a QueryParam the request carries, by
+//     matchQuery.
+//  4. Then rules with a PathPrefix or only a Host, by the most specific
+//     Host: an exact host, then the longest wildcard suffix, then rules
+//     without a Host.
+//
+// Within each step the most specific Host wins, and among rules matched by
+// path the longest PathPrefix breaks ties; remaining ties go to the rule
+// listed first. A rule that sets a Host only applies to requests for that
+// host, one that sets Methods only to requests with one of them, and one
+// with a Schedule only within it.
+//
+// The built-in matchers read the rules without locking the router, so
+// they must only be called by it as part of its Matchers.
+func (r *Router) BuiltinMatchers() []Matcher {
+	return []Matcher{serviceMatcher{r}, patternMatcher{r}, queryMatcher{r}, hostPathMatcher{r}}
+}
+
+// matchers returns the router's Matchers, or the built-in ones when nil
+func (r *Router) matchers() []Matcher {
+	if r.Matchers == nil {
+		return r.BuiltinMatchers()
+	}
+	return r.Matchers
+}
+
+// matchChain returns the rule of the first of the router's matchers that
+// matches req. The caller must hold r.mu.
+func (r *Router) matchChain(req *http.Request) (Rule, bool) {
+	for _, m := range r.matchers() {
+		if rm, ok := m.(ruleMatcher); ok {
+			if i := rm.matchRule(req); i >= 0 {
+				return r.Rules[i], true
+			}
+			continue
+		}
+		if destination, ok := m.Match(req); ok {
+			return Rule{Service: matcherService, Destination: destination}, true
+		}
+	}
+	return Rule{}, false
+}
+
+// matchDestination implements Match for a built-in matcher. The caller
+// must hold r.mu.
+func (r *Router) matchDestination(m ruleMatcher, req *http.Request) (string, bool) {
+	i := m.matchRule(req)
+	if i < 0 {
+		return "", false
+	}
+	destination := r.pickDestination(r.Rules[i], req)
+	return destination, destination != ""
+}
+
+// serviceMatcher matches the X-Service-Type header to the rules' Service
+type serviceMatcher struct{ r *Router }
+
+func (m serviceMatcher) Match(req *http.Request) (string, bool) { return m.r.matchDestination(m, req) }
+
+func (m serviceMatcher) matchRule(req *http.Request) int {
+	service, host, _ := routingInputs(req)
+	if service == "" {
+		return -1
+	}
+	return m.r.bestHost(m.r.index.byService[service], normalizeHost(host), req.Method, nil)
+}
+
+// patternMatcher matches the X-Service-Type header to the rules' Pattern
+type patternMatcher struct{ r *Router }
+
+func (m patternMatcher) Match(req *http.Request) (string, bool) { return m.r.matchDestination(m, req) }
+
+func (m patternMatcher) matchRule(req *http.Request) int {
+	service, host, _ := routingInputs(req)
+	if service == "" {
+		return -1
+	}
+	return m.r.bestHost(m.r.index.patterns, normalizeHost(host), req.Method, func(rule Rule) bool {
+		return rule.pattern != nil && rule.pattern.MatchString(service)
+	})
+}
+
+// queryMatcher matches requests without a service by the rules' QueryParam
+type queryMatcher struct{ r *Router }
+
+func (m queryMatcher) Match(req *http.Request) (string, bool) { return m.r.matchDestination(m, req) }
+
+func (m queryMatcher) matchRule(req *http.Request) int {
+	service, host, path := routingInputs(req)
+	if service != "" || len(m.r.index.params) == 0 {
+		return -1
+	}
+	return m.r.matchQuery(req.URL.Query(), normalizeHost(host), path, req.Method)
+}
+
+// hostPathMatcher matches requests without a service by the rules' Host
+// and PathPrefix
+type hostPathMatcher struct{ r *Router }
+
+func (m hostPathMatcher) Match(req *http.Request) (string, bool) { return m.r.matchDestination(m, req) }
+
+func (m hostPathMatcher) matchRule(req *http.Request) int {
+	service, host, path := routingInputs(req)
+	if service != "" {
+		return -1
+	}
+	host = normalizeHost(host)
+	applies := func(rule Rule) bool {
+		return (rule.PathPrefix == "" || rule.matchesPath(path)) && rule.allowsMethod(req.Method) && m.r.inSchedule(rule)
+	}
+	for _, i := range m.r.index.byHost[host] {
+		if applies(m.r.Rules[i]) {
+			return i
+		}
+	}
+	for _, i := range m.r.index.fallback {
+		if rule := m.r.Rules[i]; hostScore(rule.Host, host) >= 0 && applies(rule) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,95 @@
+package router
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// claimMatcher routes requests whose bearer token carries a tenant claim
+// to that tenant's destination. The signature is not checked, as it would
+// be by authentication in front of the router.
+type claimMatcher map[string]string
+
+func (m claimMatcher) Match(req *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", false
+	}
+	var claims struct {
+		Tenant string `json:"tenant"`
+	}
+	if json.Unmarshal(payload, &claims) != nil {
+		return "", false
+	}
+	destination, ok := m[claims.Tenant]
+	return destination, ok
+}
+
+// bearer returns an unsigned JWT with claims
+func bearer(claims string) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return "Bearer " + encode([]byte(`{"alg":"none"}`)) + "." + encode([]byte(claims)) + "."
+}
+
+func TestCustomMatcher(t *testing.T) {
+	api := newBackend(t, "api")
+	beta := newBackend(t, "beta")
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: api.URL}}})
+	router.Matchers = append([]Matcher{claimMatcher{"beta": beta.URL}}, router.BuiltinMatchers()...)
+
+	tests := []struct {
+		name, authorization, want string
+	}{
+		{"beta tenant", bearer(`{"sub":"ada","tenant":"beta"}`), "beta"},
+		{"other tenant", bearer(`{"sub":"bob","tenant":"acme"}`), "api"},
+		{"no token", "", "api"},
+		{"malformed token", "Bearer not-a-jwt", "api"},
+	}
+	for _, tt := range tests {
+		req := serviceRequest("api", "")
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		if rec, body := serve(router, req); rec.Code != http.StatusOK || body != tt.want {
+			t.Errorf("%s = %d %q, want 200 from %s", tt.name, rec.Code, body, tt.want)
+		}
+	}
+
+	req := serviceRequest("api", "")
+	req.Header.Set("Authorization", bearer(`{"tenant":"beta"}`))
+	if destination, ok := router.RouteRequest(req); !ok || destination != beta.URL {
+		t.Errorf("RouteRequest = %q, %v, want %q", destination, ok, beta.URL)
+	}
+	if explanation := router.Explain(req); explanation.Reason != "matcher" || explanation.Destination != beta.URL {
+		t.Errorf("Explain = %+v, want reason matcher to %s", explanation, beta.URL)
+	}
+}
+
+func TestMatchersReplaceBuiltins(t *testing.T) {
+	api := newBackend(t, "api")
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: api.URL}}})
+	// A chain without the built-in matchers ignores the rules.
+	router.Matchers = []Matcher{claimMatcher{}}
+	if rec, _ := serve(router, serviceRequest("api", "")); rec.Code != http.StatusNotFound {
+		t.Errorf("without the built-in matchers status = %d, want 404", rec.Code)
+	}
+	router.Matchers = nil
+	if rec, body := serve(router, httptest.NewRequest(http.MethodGet, "/", nil)); rec.Code != http.StatusNotFound {
+		t.Errorf("unmatched request = %d %q, want 404", rec.Code, body)
+	}
+	if rec, body := serve(router, serviceRequest("api", "")); rec.Code != http.StatusOK || body != "api" {
+		t.Errorf("nil Matchers = %d %q, want the built-in matchers", rec.Code, body)
+	}
+}
@@ -0,0 +1,53 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsRegistry holds the router's metrics, separately from the global
+// default registry so that embedding programs don't see them twice
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	requestsRouted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "router_requests_routed_total",
+		Help: "Requests matched to a routing rule, by service.",
+	}, []string{"service"})
+
+	routingMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "router_routing_misses_total",
+		Help: "Requests that matched no routing rule.",
+	})
+
+	forwardDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "router_forward_duration_seconds",
+		Help:    "Latency of requests forwarded to a destination.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"destination"})
+
+	activeSessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "router_sessions",
+		Help: "Sessions currently tracked by the session manager.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		requestsRouted,
+		routingMisses,
+		forwardDuration,
+		activeSessions,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// metricsHandler serves the router's metrics in the Prometheus exposition
+// format. It can be mounted on the main mux or on the admin mux.
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
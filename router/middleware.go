@@ -0,0 +1,16 @@
+package router
+
+import "net/http"
+
+// Chain composes mw into one middleware that applies them in order: the
+// first is outermost and sees each request first, and each passes on the
+// request, with any context it added, to the next, the last to the
+// wrapped handler
+func Chain(mw ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		for i := len(mw) - 1; i >= 0; i-- {
+			h = mw[i](h)
+		}
+		return h
+	}
+}
@@ -0,0 +1,82 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// traceKey is the context key of the names of the middleware a request passed
+type traceKey struct{}
+
+// tracing returns a middleware recording name in calls on the way in and
+// out, and adding it to the names in the request's context
+func tracing(name string, calls *[]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			*calls = append(*calls, name+">")
+			names, _ := req.Context().Value(traceKey{}).([]string)
+			ctx := context.WithValue(req.Context(), traceKey{}, append(slices.Clip(names), name))
+			next.ServeHTTP(w, req.WithContext(ctx))
+			*calls = append(*calls, "<"+name)
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls, seen []string
+	handler := Chain(tracing("a", &calls), tracing("b", &calls), tracing("c", &calls))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls = append(calls, "handler")
+		seen, _ = req.Context().Value(traceKey{}).([]string)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if want := []string{"a>", "b>", "c>", "handler", "<c", "<b", "<a"}; !slices.Equal(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+	if want := []string{"a", "b", "c"}; !slices.Equal(seen, want) {
+		t.Errorf("handler saw the context of %q, want %q", seen, want)
+	}
+
+	calls = nil
+	Chain()(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { calls = append(calls, "handler") })).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if !slices.Equal(calls, []string{"handler"}) {
+		t.Errorf("empty chain calls = %q, want the handler alone", calls)
+	}
+}
+
+func TestWithMiddleware(t *testing.T) {
+	backend, forwarded := newRecordingBackend(t, nil)
+	var calls []string
+	var requestID string
+	// The last middleware passes what the earlier ones added on to the
+	// backend, after the router's own request ID middleware.
+	tag := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requestID = RequestID(req.Context())
+			names, _ := req.Context().Value(traceKey{}).([]string)
+			for _, name := range names {
+				req.Header.Add("X-Middleware", name)
+			}
+			next.ServeHTTP(w, req)
+		})
+	}
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL}}},
+		WithMiddleware(tracing("auth", &calls), tracing("limit", &calls)), WithMiddleware(tag))
+
+	rec, _ := serve(router, serviceRequest("api", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if want := []string{"auth>", "limit>", "<limit", "<auth"}; !slices.Equal(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+	req := <-forwarded
+	if got := req.Header.Values("X-Middleware"); !slices.Equal(got, []string{"auth", "limit"}) {
+		t.Errorf("backend saw X-Middleware %q, want auth, limit", got)
+	}
+	if requestID == "" || requestID != rec.Header().Get("X-Request-ID") {
+		t.Errorf("middleware saw request ID %q, response has %q", requestID, rec.Header().Get("X-Request-ID"))
+	}
+}
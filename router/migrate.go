@@ -0,0 +1,65 @@
+package router
+
+import "fmt"
+
+// currentConfigVersion is the version of the config shape RouterConfig
+// describes. Configs without a version are version 1.
+const currentConfigVersion = 2
+
+// configMigrations upgrade a config by one version, the first from version
+// 1 to 2, returning a warning for every deprecated field they rewrite
+var configMigrations = []func(config *RouterConfig) []string{
+	migrateV1,
+}
+
+// migrateConfig upgrades a config just decoded from a file from its Version
+// to currentConfigVersion, returning warnings about the deprecated fields
+// it rewrote. Versions newer than this router, and fields a config's
+// version no longer has, are errors.
+func migrateConfig(config *RouterConfig) ([]string, error) {
+	version := config.Version
+	if version == 0 {
+		version = 1
+	}
+	if version < 1 || version > currentConfigVersion {
+		return nil, fmt.Errorf("config version %d is not supported; this router reads versions 1 to %d", config.Version, currentConfigVersion)
+	}
+	if version >= 2 {
+		for _, rule := range config.Rules {
+			if rule.TimeoutMS != 0 {
+				return nil, fmt.Errorf("rule %q: timeoutMS was replaced by totalTimeoutMS in config version 2", rule.key())
+			}
+		}
+	}
+	var warnings []string
+	for ; version < currentConfigVersion; version++ {
+		warnings = append(warnings, configMigrations[version-1](config)...)
+	}
+	config.Version = currentConfigVersion
+	return warnings, nil
+}
+
+// migrateV1 renames the rules' timeoutMS to totalTimeoutMS, which it
+// became when dial and response header timeouts were added
+func migrateV1(config *RouterConfig) []string {
+	var warnings []string
+	for i, rule := range config.Rules {
+		if rule.TimeoutMS == 0 {
+			continue
+		}
+		config.Rules[i] = upgradeRule(rule)
+		warnings = append(warnings, fmt.Sprintf("rule %q: timeoutMS is deprecated, use totalTimeoutMS", rule.key()))
+	}
+	return warnings
+}
+
+// upgradeRule moves a version 1 rule's timeoutMS to totalTimeoutMS. Rules
+// added at runtime go through it too, since they are saved in the current
+// version, which no longer has timeoutMS.
+func upgradeRule(rule Rule) Rule {
+	if rule.TimeoutMS != 0 && rule.TotalTimeoutMS == 0 {
+		rule.TotalTimeoutMS = rule.TimeoutMS
+	}
+	rule.TimeoutMS = 0
+	return rule
+}
@@ -0,0 +1,133 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	tests := []struct {
+		name         string
+		file         string
+		data         string
+		totalTimeout int
+		warnings     int
+		err          string
+	}{
+		{
+			name:         "v1 timeoutMS becomes totalTimeoutMS",
+			file:         "router.json",
+			data:         `{"version":1,"rules":[{"service":"api","destination":"http://a:1","timeoutMS":250}]}`,
+			totalTimeout: 250,
+			warnings:     1,
+		},
+		{
+			name:         "unversioned files are v1",
+			file:         "router.yaml",
+			data:         "rules:\n  - service: api\n    destination: http://a:1\n    timeoutMS: 250\n",
+			totalTimeout: 250,
+			warnings:     1,
+		},
+		{
+			name:         "v1 totalTimeoutMS wins over timeoutMS",
+			file:         "router.json",
+			data:         `{"rules":[{"service":"api","destination":"http://a:1","timeoutMS":250,"totalTimeoutMS":500}]}`,
+			totalTimeout: 500,
+			warnings:     1,
+		},
+		{
+			name:         "current version",
+			file:         "router.json",
+			data:         `{"version":2,"rules":[{"service":"api","destination":"http://a:1","totalTimeoutMS":500}]}`,
+			totalTimeout: 500,
+		},
+		{
+			name: "removed field in current version",
+			file: "router.json",
+			data: `{"version":2,"rules":[{"service":"api","destination":"http://a:1","timeoutMS":250}]}`,
+			err:  "timeoutMS was replaced by totalTimeoutMS",
+		},
+		{
+			name: "future version",
+			file: "router.json",
+			data: `{"version":3,"rules":[{"service":"api","destination":"http://a:1"}]}`,
+			err:  "config version 3 is not supported",
+		},
+		{
+			name: "negative version",
+			file: "router.json",
+			data: `{"version":-1,"rules":[{"service":"api","destination":"http://a:1"}]}`,
+			err:  "config version -1 is not supported",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config RouterConfig
+			err := unmarshalConfig(tt.file, []byte(tt.data), &config, false)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Version != currentConfigVersion {
+				t.Errorf("Version = %d, want %d", config.Version, currentConfigVersion)
+			}
+			rule := config.Rules[0]
+			if rule.TotalTimeoutMS != tt.totalTimeout || rule.TimeoutMS != 0 {
+				t.Errorf("totalTimeoutMS, timeoutMS = %d, %d, want %d, 0", rule.TotalTimeoutMS, rule.TimeoutMS, tt.totalTimeout)
+			}
+			if len(config.warnings) != tt.warnings {
+				t.Errorf("warnings = %q, want %d", config.warnings, tt.warnings)
+			}
+			for _, warning := range config.warnings {
+				if !strings.HasPrefix(warning, tt.file+": ") {
+					t.Errorf("warning %q does not name %s", warning, tt.file)
+				}
+			}
+		})
+	}
+}
+
+// TestAddedRuleTimeoutSurvivesSave adds a rule with the version 1 timeoutMS
+// at runtime and checks that the saved config still loads
+func TestAddedRuleTimeoutSurvivesSave(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "router.json")
+	if err := os.WriteFile(file, []byte(`{"version":2,"rules":[{"service":"web","destination":"http://w:1"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	router, err := NewRouter(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := router.AddRule(Rule{Service: "api", Destination: "http://a:1", TimeoutMS: 250}); err != nil {
+		t.Fatal(err)
+	}
+	mux := adminMux(router, NewSessionManager(nil), file, nil)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/rules", strings.NewReader(`{"service":"admin","destination":"http://b:1","timeoutMS":100}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /rules = %d %s", rec.Code, rec.Body)
+	}
+
+	config, err := loadConfig(file, false)
+	if err != nil {
+		t.Fatalf("reloading the saved config: %v", err)
+	}
+	want := map[string]int{"web": 0, "api": 250, "admin": 100}
+	for _, rule := range config.Rules {
+		if rule.TimeoutMS != 0 || rule.TotalTimeoutMS != want[rule.Service] {
+			t.Errorf("rule %s: timeoutMS, totalTimeoutMS = %d, %d, want 0, %d", rule.Service, rule.TimeoutMS, rule.TotalTimeoutMS, want[rule.Service])
+		}
+	}
+	if len(config.Rules) != len(want) {
+		t.Errorf("saved %d rules, want %d", len(config.Rules), len(want))
+	}
+}
@@ -0,0 +1,100 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// maxMirrorBody is the largest request body that is mirrored
+	maxMirrorBody = 1 << 20
+	// mirrorTimeout bounds each mirrored request
+	mirrorTimeout = 30 * time.Second
+)
+
+// mirrorCapture records the request body as the primary forward reads it,
+// so mirroring never delays the primary request by reading ahead
+type mirrorCapture struct {
+	body     io.ReadCloser
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	complete bool // the whole body was read
+	overflow bool // the body exceeded maxMirrorBody
+}
+
+func (mc *mirrorCapture) Read(p []byte) (int, error) {
+	n, err := mc.body.Read(p)
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if !mc.overflow {
+		if mc.buf.Len()+n > maxMirrorBody {
+			mc.overflow = true
+			mc.buf = bytes.Buffer{}
+		} else {
+			mc.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		mc.complete = true
+	}
+	return n, err
+}
+
+func (mc *mirrorCapture) Close() error {
+	return mc.body.Close()
+}
+
+// captured returns the body read so far and whether it is the whole body
+func (mc *mirrorCapture) captured() ([]byte, bool) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return bytes.Clone(mc.buf.Bytes()), mc.complete && !mc.overflow
+}
+
+// sampleMirror decides whether req is mirrored to the rule's Mirror. If so
+// it starts capturing the body of req and returns a function that, once
+// the primary forward is done, replays req to the mirror in the background,
+// discarding the outcome; otherwise it returns nil. Requests whose body was
+// not read in full or exceeds maxMirrorBody are not replayed.
+func (r *Router) sampleMirror(req *http.Request, rule Rule) func() {
+	if rule.Mirror == "" || rule.MirrorPercent <= 0 || req.ContentLength > maxMirrorBody {
+		return nil
+	}
+	if rule.MirrorPercent < 100 && rand.IntN(100) >= rule.MirrorPercent {
+		return nil
+	}
+	shadow := req.Clone(context.Background())
+	var capture *mirrorCapture
+	if req.Body != nil && req.Body != http.NoBody {
+		capture = &mirrorCapture{body: req.Body}
+		req.Body = capture
+	}
+	return func() {
+		if capture != nil {
+			body, ok := capture.captured()
+			if !ok {
+				return
+			}
+			shadow.Body = io.NopCloser(bytes.NewReader(body))
+			shadow.ContentLength = int64(len(body))
+		}
+		go r.replay(shadow, rule)
+	}
+}
+
+// replay sends req to the rule's Mirror and discards the response
+func (r *Router) replay(req *http.Request, rule Rule) {
+	ctx, cancel := context.WithTimeout(req.Context(), mirrorTimeout)
+	defer cancel()
+	resp, err := r.forwardRule(req.WithContext(ctx), rule, rule.Mirror)
+	if err != nil {
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
@@ -0,0 +1,109 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newMirrorBackend starts a shadow backend that passes the body of each
+// request it receives on bodies
+func newMirrorBackend(t *testing.T) (*httptest.Server, <-chan string) {
+	t.Helper()
+	bodies := make(chan string, 1000)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		bodies <- string(body)
+		io.WriteString(w, "shadow")
+	}))
+	t.Cleanup(backend.Close)
+	return backend, bodies
+}
+
+func TestMirrorReplaysRequest(t *testing.T) {
+	primary := newBackend(t, "primary")
+	shadow, bodies := newMirrorBackend(t)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Service: "api", Destination: primary.URL, Mirror: shadow.URL, MirrorPercent: 100},
+	}})
+
+	req := serviceRequest("api", "")
+	req.Method = http.MethodPost
+	req.Body = io.NopCloser(strings.NewReader("payload"))
+	req.ContentLength = int64(len("payload"))
+	if rec, got := serve(router, req); rec.Code != http.StatusOK || got != "primary" {
+		t.Fatalf("mirrored request = %d %q, want 200 from primary", rec.Code, got)
+	}
+	select {
+	case body := <-bodies:
+		if body != "payload" {
+			t.Errorf("mirror got body %q, want payload", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the mirror never received the request")
+	}
+}
+
+func TestMirrorPercent(t *testing.T) {
+	const requests = 500
+	for _, percent := range []int{0, 20, 100} {
+		primary := newBackend(t, "primary")
+		var mirrored atomic.Int32
+		shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			mirrored.Add(1)
+		}))
+		t.Cleanup(shadow.Close)
+		router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+			{Service: "api", Destination: primary.URL, Mirror: shadow.URL, MirrorPercent: percent},
+		}})
+
+		for i := 0; i < requests; i++ {
+			serve(router, serviceRequest("api", ""))
+		}
+		// Replays are asynchronous; wait for the count to settle.
+		want := requests * percent / 100
+		var got int
+		for last := -1; ; last = got {
+			time.Sleep(50 * time.Millisecond)
+			if got = int(mirrored.Load()); got == last {
+				break
+			}
+		}
+		// 20% of 500 has a standard deviation of about 9.
+		if tolerance := requests * 8 / 100; got < want-tolerance || got > want+tolerance {
+			t.Errorf("MirrorPercent %d mirrored %d of %d requests, want about %d", percent, got, requests, want)
+		}
+	}
+}
+
+func TestMirrorDoesNotDelayPrimary(t *testing.T) {
+	primary := newBackend(t, "primary")
+	unblock := make(chan struct{})
+	defer close(unblock)
+	slow, entered := newBlockingBackend(t, "shadow", unblock)
+	failing := httptest.NewServer(http.NotFoundHandler())
+	failing.Close()
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Service: "slow", Destination: primary.URL, Mirror: slow.URL, MirrorPercent: 100},
+		{Service: "failing", Destination: primary.URL, Mirror: failing.URL, MirrorPercent: 100},
+	}})
+
+	start := time.Now()
+	for _, service := range []string{"slow", "failing"} {
+		if rec, got := serve(router, serviceRequest(service, "")); rec.Code != http.StatusOK || got != "primary" {
+			t.Errorf("%s: got %d %q, want 200 from primary", service, rec.Code, got)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("primary requests took %s with a stalled mirror", elapsed)
+	}
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Error("the slow mirror never received the request")
+	}
+}
@@ -0,0 +1,84 @@
+package router
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Option configures a Router created by New. Without options New behaves
+// like NewRouter on the default config file, go-router.json.
+type Option func(*options)
+
+// options are the settings Options fill in for New
+type options struct {
+	config       *RouterConfig
+	configFile   string
+	strictConfig bool
+	logger       *slog.Logger
+	sessions     *SessionManager
+	timeout      time.Duration
+	tls          *tls.Config
+	strategy     string
+	middleware   []func(http.Handler) http.Handler
+}
+
+// WithConfig routes by config rather than a config file
+func WithConfig(config *RouterConfig) Option {
+	return func(o *options) { o.config = config }
+}
+
+// WithConfigFile loads the config from filename, a JSON or YAML file or a
+// directory of them
+func WithConfigFile(filename string) Option {
+	return func(o *options) { o.configFile = filename }
+}
+
+// WithStrictConfig rejects config files with fields the router does not know
+func WithStrictConfig() Option {
+	return func(o *options) { o.strictConfig = true }
+}
+
+// WithLogger sends the router's structured logs to logger instead of slog.Default
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) { o.logger = logger }
+}
+
+// WithTimeout bounds forwarded requests whose rule has no timeout of its
+// own while the config sets no global timeoutMS either
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) { o.timeout = timeout }
+}
+
+// WithSessionStore keeps the clients' sessions in store, managed with opts,
+// instead of in memory
+func WithSessionStore(store SessionStore, opts ...SessionOption) Option {
+	return func(o *options) { o.sessions = NewSessionManager(store, opts...) }
+}
+
+// WithSessions tracks the clients' sessions with sessions, which may be
+// shared with other routers or an admin API
+func WithSessions(sessions *SessionManager) Option {
+	return func(o *options) { o.sessions = sessions }
+}
+
+// WithTLS connects to https destinations with config, such as to trust a
+// private CA or present a client certificate, instead of the system's
+// defaults
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) { o.tls = config }
+}
+
+// WithStrategy balances the rules that set neither a Strategy nor Weights
+// with strategy instead of round-robin. keyHash, which needs a rule's
+// hashHeader, cannot be a default.
+func WithStrategy(strategy string) Option {
+	return func(o *options) { o.strategy = strategy }
+}
+
+// WithMiddleware wraps the routing of each request in mw, applied in order
+// as by Chain, adding to the Router's Middleware
+func WithMiddleware(mw ...func(http.Handler) http.Handler) Option {
+	return func(o *options) { o.middleware = append(o.middleware, mw...) }
+}
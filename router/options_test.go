@@ -0,0 +1,66 @@
+package router
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewDefaults(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destinations: []string{a.URL, b.URL}}}})
+	if timeout := router.timeoutFor(Rule{}); timeout != 0 {
+		t.Errorf("default timeout = %v, want none", timeout)
+	}
+	got := map[string]int{}
+	for i := 0; i < 4; i++ {
+		_, body := serve(router, serviceRequest("api", ""))
+		got[body]++
+	}
+	if want := map[string]int{"a": 2, "b": 2}; !maps.Equal(got, want) {
+		t.Errorf("default balancing = %v, want round-robin %v", got, want)
+	}
+	if _, ok := router.sessions.Store().(*MemoryStore); !ok || router.sessions.TTL != DefaultSessionTTL {
+		t.Errorf("default sessions = %T with TTL %v, want in memory with %v", router.sessions.Store(), router.sessions.TTL, DefaultSessionTTL)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	var up atomic.Bool
+	backend := newFlippingBackend(t, "api", &up)
+	var logs logRecorder
+	router := newTestRouter(t, &RouterConfig{
+		HealthCheck: &HealthCheckConfig{Path: "/ping"},
+		Rules:       []Rule{{Service: "api", Destination: backend.URL}},
+	}, WithLogger(slog.New(&logs)))
+
+	serve(router, serviceRequest("missing", ""))
+	if n := logs.count(slog.LevelWarn, "no route"); n != 1 {
+		t.Errorf("logged %d unrouted requests, want 1", n)
+	}
+	// Health checks, which start before the logger is set, log to it too.
+	router.health.Load().CheckAll(context.Background())
+	if n := logs.count(slog.LevelInfo, "destination health changed"); n != 1 {
+		t.Errorf("logged %d health changes, want 1", n)
+	}
+}
+
+func TestWithSessionStore(t *testing.T) {
+	backend := newBackend(t, "api")
+	store := NewMemoryStore()
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL}}},
+		WithSessionStore(store, WithTTL(time.Minute)))
+	if rec, _ := serve(router, serviceRequest("api", "192.0.2.1:1000")); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if _, ok, err := store.Get("192.0.2.1:1000"); !ok || err != nil {
+		t.Errorf("session in the given store = %v, %v, want it stored", ok, err)
+	}
+	if router.sessions.TTL != time.Minute {
+		t.Errorf("session TTL = %v, want the WithTTL minute", router.sessions.TTL)
+	}
+}
@@ -0,0 +1,76 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// ErrorPage is a body served in place of the JSON error of a status code
+type ErrorPage struct {
+	// ContentType labels Body; it defaults to text/html
+	ContentType string `json:"contentType,omitempty" yaml:"contentType,omitempty"`
+	Body        string `json:"body" yaml:"body"`
+}
+
+// defaultErrorPageType labels error pages that do not set a ContentType
+const defaultErrorPageType = "text/html; charset=utf-8"
+
+// Reasons an upstream request failed, reported alongside its error code
+const (
+	reasonTimeout = "timeout"
+	reasonRefused = "connection_refused"
+	reasonReset   = "connection_reset"
+	reasonDNS     = "dns"
+	reasonTLS     = "tls"
+	reasonUnknown = "upstream_error"
+)
+
+// upstreamFailure maps an error forwarding a request to the status and
+// error code answered to the client and the reason it failed: timeouts
+// are 504 Gateway Timeout, anything else 502 Bad Gateway
+func upstreamFailure(err error) (status int, code, reason string) {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return http.StatusGatewayTimeout, "gateway_timeout", reasonTimeout
+	}
+	var (
+		dnsErr       *net.DNSError
+		recordErr    tls.RecordHeaderError
+		verifyErr    *tls.CertificateVerificationError
+		alertErr     tls.AlertError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+	)
+	reason = reasonUnknown
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		reason = reasonRefused
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		reason = reasonReset
+	case errors.As(err, &dnsErr):
+		reason = reasonDNS
+	case errors.As(err, &recordErr), errors.As(err, &verifyErr), errors.As(err, &alertErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		reason = reasonTLS
+	}
+	return http.StatusBadGateway, "bad_gateway", reason
+}
+
+// writeUpstreamError answers a request under rule whose forwarding to
+// destination failed with err, logging the failure
+func (r *Router) writeUpstreamError(w http.ResponseWriter, rule Rule, destination string, err error) {
+	status, code, reason := upstreamFailure(err)
+	if status == http.StatusGatewayTimeout {
+		r.logger().Warn("forward timed out", "destination", destination, "error", err)
+	} else {
+		r.logger().Error("forwarding", "destination", destination, "reason", reason, "error", err)
+	}
+	r.writeError(w, status, code, map[string]string{"service": rule.key(), "reason": reason})
+}
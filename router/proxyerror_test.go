@@ -0,0 +1,87 @@
+package router
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestUpstreamFailure(t *testing.T) {
+	dial := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)}
+	}
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		reason string
+	}{
+		{"deadline", fmt.Errorf("forwarding: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, reasonTimeout},
+		{"dial timeout", &net.OpError{Op: "dial", Err: os.ErrDeadlineExceeded}, http.StatusGatewayTimeout, reasonTimeout},
+		{"refused", dial(syscall.ECONNREFUSED), http.StatusBadGateway, reasonRefused},
+		{"reset", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, http.StatusBadGateway, reasonReset},
+		{"closed early", io.ErrUnexpectedEOF, http.StatusBadGateway, reasonReset},
+		{"dns", &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "api.internal", IsNotFound: true}}, http.StatusBadGateway, reasonDNS},
+		{"tls", fmt.Errorf("tls: %w", x509.UnknownAuthorityError{}), http.StatusBadGateway, reasonTLS},
+		{"other", errors.New("something else"), http.StatusBadGateway, reasonUnknown},
+	}
+	for _, tt := range tests {
+		if status, _, reason := upstreamFailure(tt.err); status != tt.status || reason != tt.reason {
+			t.Errorf("%s: upstreamFailure = %d %s, want %d %s", tt.name, status, reason, tt.status, tt.reason)
+		}
+	}
+}
+
+func TestUpstreamErrorPages(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	untrusted := httptest.NewUnstartedServer(http.NotFoundHandler())
+	untrusted.Config.ErrorLog = log.New(io.Discard, "", 0)
+	untrusted.StartTLS()
+	t.Cleanup(untrusted.Close)
+	slow := newSlowBackend(t, time.Second)
+	router := newTestRouter(t, &RouterConfig{
+		ErrorPages: map[int]ErrorPage{
+			http.StatusBadGateway:     {Body: "<h1>Backend unavailable</h1>"},
+			http.StatusGatewayTimeout: {ContentType: "application/json", Body: `{"message":"try again later"}`},
+		},
+		Rules: []Rule{
+			{Service: "down", Destination: down.URL},
+			{Service: "untrusted", Destination: untrusted.URL},
+			{Service: "slow", Destination: slow.URL, TotalTimeoutMS: 20},
+		},
+	})
+	tests := []struct {
+		service, contentType, body string
+		status                     int
+	}{
+		{"down", defaultErrorPageType, "<h1>Backend unavailable</h1>", http.StatusBadGateway},
+		{"untrusted", defaultErrorPageType, "<h1>Backend unavailable</h1>", http.StatusBadGateway},
+		{"slow", "application/json", `{"message":"try again later"}`, http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		rec, body := serve(router, serviceRequest(tt.service, ""))
+		if rec.Code != tt.status || rec.Header().Get("Content-Type") != tt.contentType || body != tt.body {
+			t.Errorf("%s = %d %q %q, want %d %q %q", tt.service, rec.Code, rec.Header().Get("Content-Type"), body, tt.status, tt.contentType, tt.body)
+		}
+	}
+
+	// Without a page the error code and reason are reported as JSON.
+	router = newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "untrusted", Destination: untrusted.URL}}})
+	rec, _ := serve(router, serviceRequest("untrusted", ""))
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] != "bad_gateway" || body["reason"] != reasonTLS {
+		t.Errorf("untrusted without a page = %d %s, want bad_gateway for reason tls", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,34 @@
+package router
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// proxyProtocolListener wraps ln to read the PROXY protocol v1 or v2 header
+// an L4 load balancer sends ahead of each connection, so that the
+// connection's RemoteAddr, and with it sessions and rate limits, is the
+// client's address rather than the balancer's. Connections without a header
+// are accepted as they are. When the config lists TrustedProxies only those
+// peers may send a header; a header from any other peer is refused.
+func (r *Router) proxyProtocolListener(ln net.Listener) net.Listener {
+	return &proxyproto.Listener{
+		Listener: ln,
+		Policy: func(upstream net.Addr) (proxyproto.Policy, error) {
+			r.mu.RLock()
+			trusted := r.trustedProxies
+			r.mu.RUnlock()
+			if len(trusted) == 0 {
+				return proxyproto.USE, nil
+			}
+			// An error would stop the server accepting, so refuse instead.
+			addr, err := netip.ParseAddrPort(upstream.String())
+			if err != nil || !containsAddr(trusted, addr.Addr()) {
+				return proxyproto.REJECT, nil
+			}
+			return proxyproto.USE, nil
+		},
+	}
+}
@@ -0,0 +1,113 @@
+package router
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// serveProxyProtocol serves router on a local listener reading PROXY
+// protocol headers and returns its address
+func serveProxyProtocol(t *testing.T, router *Router) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: router}
+	go server.Serve(router.proxyProtocolListener(ln))
+	t.Cleanup(func() { server.Close() })
+	return ln.Addr().String()
+}
+
+// sendWithHeader sends a request for the api service over a new connection
+// to addr, after header unless it is nil, and returns the response status
+func sendWithHeader(t *testing.T, addr string, header *proxyproto.Header) (int, error) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if header != nil {
+		if _, err := header.WriteTo(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: router\r\nX-Service-Type: api\r\nConnection: close\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func proxyHeader(version byte, source string) *proxyproto.Header {
+	src, _ := net.ResolveTCPAddr("tcp", source)
+	dst, _ := net.ResolveTCPAddr("tcp", "10.0.0.1:80")
+	protocol := proxyproto.TCPv4
+	if src.IP.To4() == nil {
+		protocol = proxyproto.TCPv6
+		dst, _ = net.ResolveTCPAddr("tcp", "[2001:db8::1]:80")
+	}
+	return &proxyproto.Header{Version: version, Command: proxyproto.PROXY, TransportProtocol: protocol, SourceAddr: src, DestinationAddr: dst}
+}
+
+func TestProxyProtocol(t *testing.T) {
+	backend := newBackend(t, "api")
+	sessions := NewSessionManager(nil)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL}}}, WithSessions(sessions))
+	addr := serveProxyProtocol(t, router)
+
+	tests := []struct {
+		name   string
+		header *proxyproto.Header
+		client string
+	}{
+		{"v1", proxyHeader(1, "203.0.113.7:51234"), "203.0.113.7:51234"},
+		{"v2", proxyHeader(2, "198.51.100.9:40000"), "198.51.100.9:40000"},
+		{"v2 IPv6", proxyHeader(2, "[2001:db8::7]:443"), "[2001:db8::7]:443"},
+	}
+	for _, tt := range tests {
+		status, err := sendWithHeader(t, addr, tt.header)
+		if err != nil || status != http.StatusOK {
+			t.Fatalf("%s: status = %d, %v, want 200", tt.name, status, err)
+		}
+		if _, ok := sessions.GetSession(tt.client); !ok {
+			t.Errorf("%s: no session for the relayed client %s", tt.name, tt.client)
+		}
+	}
+
+	// Connections without a header are accepted with their own address.
+	before := sessions.Count()
+	if status, err := sendWithHeader(t, addr, nil); err != nil || status != http.StatusOK {
+		t.Fatalf("without a header: status = %d, %v, want 200", status, err)
+	}
+	if sessions.Count() != before+1 {
+		t.Errorf("request without a header recorded %d sessions, want 1", sessions.Count()-before)
+	}
+}
+
+func TestProxyProtocolTrustedProxies(t *testing.T) {
+	backend := newBackend(t, "api")
+	sessions := NewSessionManager(nil)
+	router := newTestRouter(t, &RouterConfig{
+		TrustedProxies: []string{"192.0.2.0/24"},
+		Rules:          []Rule{{Service: "api", Destination: backend.URL}},
+	}, WithSessions(sessions))
+	addr := serveProxyProtocol(t, router)
+	// The test connects from 127.0.0.1, which may not send a header.
+	if status, err := sendWithHeader(t, addr, proxyHeader(1, "203.0.113.7:51234")); err == nil && status == http.StatusOK {
+		t.Error("header from an untrusted peer was routed")
+	}
+	if _, ok := sessions.GetSession("203.0.113.7:51234"); ok {
+		t.Error("session recorded for the address claimed by an untrusted peer")
+	}
+}
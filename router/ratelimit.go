@@ -0,0 +1,116 @@
+package router
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTimeout is how long a rule's limiter may go unused before it is dropped
+const limiterIdleTimeout = 5 * time.Minute
+
+// limiterEntry is the token bucket of one rule or client IP
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	limit    rate.Limit
+	burst    int
+	lastUsed atomic.Int64 // UnixNano
+}
+
+// burstFor returns the bucket size for limit, defaulting to one second of traffic
+func burstFor(limit float64, burst int) int {
+	if burst > 0 {
+		return burst
+	}
+	return int(math.Max(1, math.Ceil(limit)))
+}
+
+// limiterFor returns the limiter stored under key in limiters, creating it on
+// first use or when its limits changed
+func limiterFor(limiters *sync.Map, key string, limit rate.Limit, burst int) *limiterEntry {
+	if v, ok := limiters.Load(key); ok {
+		if sl := v.(*limiterEntry); sl.limit == limit && sl.burst == burst {
+			return sl
+		}
+	}
+	sl := &limiterEntry{limiter: rate.NewLimiter(limit, burst), limit: limit, burst: burst}
+	if v, loaded := limiters.LoadOrStore(key, sl); loaded {
+		if existing := v.(*limiterEntry); existing.limit == limit && existing.burst == burst {
+			return existing
+		}
+		limiters.Store(key, sl)
+	}
+	return sl
+}
+
+// take removes a token from the bucket under key. When the bucket is empty
+// it reports how long the client should wait before retrying.
+func take(limiters *sync.Map, key string, limit float64, burst int) (bool, time.Duration) {
+	if limit <= 0 {
+		return true, 0
+	}
+	sl := limiterFor(limiters, key, rate.Limit(limit), burstFor(limit, burst))
+	now := time.Now()
+	sl.lastUsed.Store(now.UnixNano())
+	reservation := sl.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+	return true, 0
+}
+
+// allow applies the rate limit of rule
+func (r *Router) allow(rule Rule) (bool, time.Duration) {
+	return take(&r.limiters, rule.key(), rule.RateLimit, rule.Burst)
+}
+
+// allowClient applies the per-client rate limit to ip
+func (r *Router) allowClient(ip string) (bool, time.Duration) {
+	r.mu.RLock()
+	limit, burst := r.ClientRateLimit, r.ClientBurst
+	r.mu.RUnlock()
+	return take(&r.clientLimiters, ip, limit, burst)
+}
+
+// pruneLimiters drops limiters that have not been used for idle
+func (r *Router) pruneLimiters(idle time.Duration) {
+	cutoff := time.Now().Add(-idle).UnixNano()
+	prune := func(key, v any, limiters *sync.Map) {
+		if v.(*limiterEntry).lastUsed.Load() < cutoff {
+			limiters.Delete(key)
+		}
+	}
+	for _, limiters := range []*sync.Map{&r.limiters, &r.clientLimiters} {
+		limiters.Range(func(key, v any) bool {
+			prune(key, v, limiters)
+			return true
+		})
+	}
+}
+
+// StartLimiterCleanup drops idle rate limiters every interval until ctx is
+// canceled or the router is closed
+func (r *Router) StartLimiterCleanup(ctx context.Context, interval time.Duration) {
+	r.goBackground(ctx, func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.pruneLimiters(limiterIdleTimeout)
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// retryAfterSeconds formats a delay for the Retry-After header, rounding up
+func retryAfterSeconds(delay time.Duration) int {
+	return int(math.Ceil(delay.Seconds()))
+}
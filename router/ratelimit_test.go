@@ -0,0 +1,135 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countStatuses serves n requests built by newReq and counts the responses by status
+func countStatuses(router *Router, n int, newReq func() *http.Request) map[int]int {
+	counts := map[int]int{}
+	for i := 0; i < n; i++ {
+		rec, _ := serve(router, newReq())
+		counts[rec.Code]++
+	}
+	return counts
+}
+
+func TestServiceRateLimit(t *testing.T) {
+	backend := newBackend(t, "a")
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Service: "noisy", Destination: backend.URL, RateLimit: 1, Burst: 3},
+		{Service: "quiet", Destination: backend.URL},
+	}})
+
+	counts := countStatuses(router, 5, func() *http.Request { return serviceRequest("noisy", "") })
+	if counts[http.StatusOK] != 3 || counts[http.StatusTooManyRequests] != 2 {
+		t.Errorf("noisy service got %v, want 3 200s and 2 429s", counts)
+	}
+	rec, _ := serve(router, serviceRequest("noisy", ""))
+	if retry, err := strconv.Atoi(rec.Header().Get("Retry-After")); rec.Code != http.StatusTooManyRequests || err != nil || retry < 1 {
+		t.Errorf("over the limit = %d with Retry-After %q, want 429 and a positive delay", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if counts := countStatuses(router, 5, func() *http.Request { return serviceRequest("quiet", "") }); counts[http.StatusOK] != 5 {
+		t.Errorf("quiet service got %v while noisy was limited, want 5 200s", counts)
+	}
+}
+
+func TestBurstFor(t *testing.T) {
+	tests := []struct {
+		limit float64
+		burst int
+		want  int
+	}{
+		{10, 0, 10},
+		{0.5, 0, 1},
+		{2.5, 0, 3},
+		{10, 4, 4},
+	}
+	for _, tt := range tests {
+		if got := burstFor(tt.limit, tt.burst); got != tt.want {
+			t.Errorf("burstFor(%v, %d) = %d, want %d", tt.limit, tt.burst, got, tt.want)
+		}
+	}
+}
+
+func TestPruneLimiters(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: "http://a:1", RateLimit: 1}}})
+	router.allow(router.ListRules()[0])
+	if _, ok := router.limiters.Load("api"); !ok {
+		t.Fatal("no limiter created for the rule")
+	}
+	router.pruneLimiters(time.Minute)
+	if _, ok := router.limiters.Load("api"); !ok {
+		t.Error("a limiter in use was pruned")
+	}
+	router.pruneLimiters(0)
+	if _, ok := router.limiters.Load("api"); ok {
+		t.Error("an idle limiter was not pruned")
+	}
+}
+
+func TestRateLimitChangeReplacesLimiter(t *testing.T) {
+	var limiters sync.Map
+	if ok, _ := take(&limiters, "api", 1, 1); !ok {
+		t.Fatal("first request refused")
+	}
+	if ok, _ := take(&limiters, "api", 1, 1); ok {
+		t.Fatal("second request allowed with a burst of 1")
+	}
+	// Raising the limit, as a config reload would, starts a fresh bucket.
+	if ok, _ := take(&limiters, "api", 1, 2); !ok {
+		t.Error("request refused after the burst was raised")
+	}
+	if ok, _ := take(&limiters, "api", 0, 0); !ok {
+		t.Error("request refused with the limit removed")
+	}
+}
+
+func TestClientRateLimit(t *testing.T) {
+	backend := newBackend(t, "a")
+	router := newTestRouter(t, &RouterConfig{
+		ClientRateLimit: 1,
+		ClientBurst:     2,
+		Rules:           []Rule{{Service: "api", Destination: backend.URL}},
+	})
+	first := countStatuses(router, 4, func() *http.Request { return serviceRequest("api", "192.0.2.1:1000") })
+	if first[http.StatusOK] != 2 || first[http.StatusTooManyRequests] != 2 {
+		t.Errorf("first client got %v, want 2 200s and 2 429s", first)
+	}
+	// Another port of the same client shares its bucket.
+	if rec, _ := serve(router, serviceRequest("api", "192.0.2.1:2000")); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("first client from another port = %d, want 429", rec.Code)
+	}
+	second := countStatuses(router, 4, func() *http.Request { return serviceRequest("api", "192.0.2.2:1000") })
+	if second[http.StatusOK] != 2 || second[http.StatusTooManyRequests] != 2 {
+		t.Errorf("second client got %v, want its own 2 200s and 2 429s", second)
+	}
+}
+
+func TestClientRateLimitForwardedIP(t *testing.T) {
+	backend := newBackend(t, "a")
+	router := newTestRouter(t, &RouterConfig{
+		TrustProxy:      true,
+		ClientRateLimit: 1,
+		ClientBurst:     1,
+		Rules:           []Rule{{Service: "api", Destination: backend.URL}},
+	})
+	// Every request arrives from the same load balancer.
+	behindProxy := func(client string) *http.Request {
+		req := serviceRequest("api", "10.0.0.1:5555")
+		req.Header.Set("X-Forwarded-For", client)
+		return req
+	}
+	for _, client := range []string{"198.51.100.1", "198.51.100.2"} {
+		if rec, _ := serve(router, behindProxy(client)); rec.Code != http.StatusOK {
+			t.Errorf("first request from %s = %d, want 200", client, rec.Code)
+		}
+	}
+	if rec, _ := serve(router, behindProxy("198.51.100.1")); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("second request from 198.51.100.1 = %d, want 429", rec.Code)
+	}
+}
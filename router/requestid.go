@@ -0,0 +1,90 @@
+package router
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// requestIDHeader carries the ID correlating a request across services
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps incoming request IDs; longer ones are replaced
+const maxRequestIDLength = 128
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// RequestID returns the request ID stored in ctx by WithRequestID, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID returns a random 128-bit request ID in hex
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID reports whether id is a non-empty, reasonably sized run of
+// printable ASCII that is safe to log and forward
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDWriter sets the request ID on the response, replacing any the
+// destination sent, when the header is written
+type requestIDWriter struct {
+	http.ResponseWriter
+	id          string
+	wroteHeader bool
+}
+
+func (rw *requestIDWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.Header().Set(requestIDHeader, rw.id)
+		rw.wroteHeader = status >= 200
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *requestIDWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (rw *requestIDWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// WithRequestID passes on the X-Request-ID of each request, generating one
+// when it is missing or malformed. The ID is stored in the request context,
+// forwarded upstream and echoed in the response.
+func WithRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+			// Handlers must not modify the request they are given, so the
+			// generated ID goes on a copy with headers of its own.
+			req = req.Clone(req.Context())
+			req.Header.Set(requestIDHeader, id)
+		}
+		req = req.WithContext(context.WithValue(req.Context(), requestIDKey{}, id))
+		next.ServeHTTP(&requestIDWriter{ResponseWriter: w, id: id}, req)
+	})
+}
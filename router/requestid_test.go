@@ -0,0 +1,65 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithRequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		incoming  string
+		preserved bool
+	}{
+		{name: "absent"},
+		{name: "present", incoming: "abc-123", preserved: true},
+		{name: "too long", incoming: strings.Repeat("a", maxRequestIDLength+1)},
+		{name: "control characters", incoming: "abc\x01"},
+		{name: "spaces", incoming: "abc 123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen, inContext string
+			handler := WithRequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				seen, inContext = req.Header.Get(requestIDHeader), RequestID(req.Context())
+				w.Header().Set(requestIDHeader, "from-destination")
+				w.Write([]byte("ok"))
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(requestIDHeader, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			echoed := rec.Header().Get(requestIDHeader)
+			if seen == "" || seen != inContext || seen != echoed {
+				t.Errorf("forwarded %q, context %q, echoed %q, want one ID", seen, inContext, echoed)
+			}
+			if tt.preserved != (seen == tt.incoming) {
+				t.Errorf("ID = %q for incoming %q, want preserved %v", seen, tt.incoming, tt.preserved)
+			}
+			if !tt.preserved && len(seen) != 32 {
+				t.Errorf("generated ID %q is not 128 bits of hex", seen)
+			}
+			if got := req.Header.Get(requestIDHeader); got != tt.incoming {
+				t.Errorf("inbound request header changed to %q", got)
+			}
+		})
+	}
+}
+
+func TestRequestIDGeneratedPerRequest(t *testing.T) {
+	handler := WithRequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) { w.WriteHeader(http.StatusNoContent) }))
+	ids := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		ids[rec.Header().Get(requestIDHeader)] = true
+	}
+	if len(ids) != 100 {
+		t.Errorf("100 requests got %d distinct IDs", len(ids))
+	}
+}
@@ -0,0 +1,145 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const (
+	// defaultRetryBackoff is the wait before the first retry
+	defaultRetryBackoff = 50 * time.Millisecond
+	// defaultRetryMaxBackoff caps the exponential backoff between retries
+	defaultRetryMaxBackoff = time.Second
+)
+
+// defaultRetryOnStatus are the upstream statuses retried when a rule has retries
+// but no RetryOnStatus of its own
+var defaultRetryOnStatus = []int{http.StatusBadGateway, http.StatusServiceUnavailable}
+
+// idempotentMethods are retried without the rule having to opt in
+var idempotentMethods = []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions}
+
+// retriesFor returns how many times req may be retried under rule
+func retriesFor(rule Rule, req *http.Request) int {
+	if rule.Retries <= 0 {
+		return 0
+	}
+	if !rule.RetryNonIdempotent && !slices.Contains(idempotentMethods, req.Method) {
+		return 0
+	}
+	return rule.Retries
+}
+
+// shouldRetry reports whether the outcome of an attempt is worth retrying
+func shouldRetry(rule Rule, resp *http.Response, err error) bool {
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		return !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) && !errors.As(err, &tooLarge)
+	}
+	statuses := rule.RetryOnStatus
+	if len(statuses) == 0 {
+		statuses = defaultRetryOnStatus
+	}
+	return slices.Contains(statuses, resp.StatusCode)
+}
+
+// forwardWithRetry forwards req to destination and, for requests the rule
+// allows to be retried, retries failed attempts against the next destination
+// from the rule's pool with exponential backoff while the retry budget
+// allows. It returns the final response and the destination that produced it.
+func (r *Router) forwardWithRetry(req *http.Request, rule Rule, destination string) (*http.Response, string, error) {
+	r.budget.deposit()
+	retries := retriesFor(rule, req)
+	if retries == 0 {
+		resp, err := r.forwardOnce(req, rule, destination)
+		return resp, destination, err
+	}
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, destination, err
+		}
+		req.Body.Close()
+	}
+
+	backoff := defaultRetryBackoff
+	if rule.RetryBackoffMS > 0 {
+		backoff = time.Duration(rule.RetryBackoffMS) * time.Millisecond
+	}
+	maxBackoff := defaultRetryMaxBackoff
+	if rule.RetryMaxBackoffMS > 0 {
+		maxBackoff = time.Duration(rule.RetryMaxBackoffMS) * time.Millisecond
+	}
+
+	for attempt := 0; ; attempt++ {
+		if body != nil {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		resp, err := r.forwardOnce(req, rule, destination)
+		if attempt == retries || !shouldRetry(rule, resp, err) {
+			return resp, destination, err
+		}
+		next := r.pickDestination(rule, req)
+		if next == "" || !r.budget.withdraw() {
+			return resp, destination, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, destination, req.Context().Err()
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, maxBackoff)
+		destination = next
+	}
+}
+
+// forwardOnce forwards req to destination under rule and reports the outcome to the
+// circuit breaker. Connection errors and 5xx responses count as failures;
+// a request canceled by the client or with an oversized body does not.
+func (r *Router) forwardOnce(req *http.Request, rule Rule, destination string) (*http.Response, error) {
+	req, span := startForwardSpan(req, destination)
+	defer span.End()
+	start := time.Now()
+	done := r.trackActive(destination)
+	req = req.WithContext(withDialTimeout(req.Context(), rule.dialTimeout()))
+	req, headers := startHeaderTimer(req, rule.responseHeaderTimeout())
+	resp, err := r.forwardRule(req, rule, destination)
+	err = headers.stop(err)
+	if err != nil {
+		headers.release()
+		done()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		resp.Body = &activeBody{ReadCloser: resp.Body, done: func() { done(); headers.release() }}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	}
+	forwardDuration.WithLabelValues(destination).Observe(time.Since(start).Seconds())
+	r.stats.countDestination(destination)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, context.Canceled), errors.As(err, &tooLarge):
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		r.breaker.Failure(destination)
+	default:
+		r.breaker.Success(destination)
+	}
+	return resp, err
+}
@@ -0,0 +1,149 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newCountingBackend starts a backend answering status with its name and
+// the request body, counting the requests it gets
+func newCountingBackend(t *testing.T, name string, status int, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hits.Add(1)
+		body, _ := io.ReadAll(req.Body)
+		w.WriteHeader(status)
+		io.WriteString(w, name+":"+string(body))
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func TestRetryNextDestination(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		rule     Rule
+		status   int
+		body     string
+		failHits int32
+	}{
+		{name: "GET", method: http.MethodGet, rule: Rule{Retries: 1}, status: http.StatusOK, body: "ok:", failHits: 1},
+		{name: "PUT body replayed", method: http.MethodPut, rule: Rule{Retries: 1}, status: http.StatusOK, body: "ok:payload", failHits: 1},
+		{name: "POST not retried", method: http.MethodPost, rule: Rule{Retries: 1}, status: http.StatusServiceUnavailable, body: "failing:payload", failHits: 1},
+		{name: "POST allowed", method: http.MethodPost, rule: Rule{Retries: 1, RetryNonIdempotent: true}, status: http.StatusOK, body: "ok:payload", failHits: 1},
+		{name: "status not retried", method: http.MethodGet, rule: Rule{Retries: 1, RetryOnStatus: []int{http.StatusBadGateway}}, status: http.StatusServiceUnavailable, body: "failing:", failHits: 1},
+		{name: "no retries", method: http.MethodGet, rule: Rule{}, status: http.StatusServiceUnavailable, body: "failing:", failHits: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failHits, okHits atomic.Int32
+			failing := newCountingBackend(t, "failing", http.StatusServiceUnavailable, &failHits)
+			ok := newCountingBackend(t, "ok", http.StatusOK, &okHits)
+			rule := tt.rule
+			rule.Service, rule.Destinations, rule.RetryBackoffMS = "api", []string{failing.URL, ok.URL}, 1
+			router := newTestRouter(t, &RouterConfig{Rules: []Rule{rule}})
+
+			var payload io.Reader
+			if tt.method != http.MethodGet {
+				payload = strings.NewReader("payload")
+			}
+			req := httptest.NewRequest(tt.method, "/", payload)
+			req.Header.Set("X-Service-Type", "api")
+			rec, body := serve(router, req)
+			if rec.Code != tt.status || body != tt.body {
+				t.Errorf("response = %d %q, want %d %q", rec.Code, body, tt.status, tt.body)
+			}
+			if failHits.Load() != tt.failHits {
+				t.Errorf("failing backend got %d requests, want %d", failHits.Load(), tt.failHits)
+			}
+		})
+	}
+}
+
+func TestRetryConnectionError(t *testing.T) {
+	var hits atomic.Int32
+	ok := newCountingBackend(t, "ok", http.StatusOK, &hits)
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destinations: []string{down.URL, ok.URL}, Retries: 2, RetryBackoffMS: 1}}})
+	if rec, body := serve(router, serviceRequest("api", "")); rec.Code != http.StatusOK || body != "ok:" {
+		t.Errorf("response = %d %q, want 200 from the live backend", rec.Code, body)
+	}
+}
+
+func TestRetriesFor(t *testing.T) {
+	tests := []struct {
+		method string
+		rule   Rule
+		want   int
+	}{
+		{http.MethodGet, Rule{Retries: 2}, 2},
+		{http.MethodHead, Rule{Retries: 2}, 2},
+		{http.MethodDelete, Rule{Retries: 2}, 2},
+		{http.MethodPost, Rule{Retries: 2}, 0},
+		{http.MethodPatch, Rule{Retries: 2, RetryNonIdempotent: true}, 2},
+		{http.MethodGet, Rule{Retries: -1}, 0},
+	}
+	for _, tt := range tests {
+		if got := retriesFor(tt.rule, httptest.NewRequest(tt.method, "/", nil)); got != tt.want {
+			t.Errorf("retriesFor(%s, %+v) = %d, want %d", tt.method, tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestRetryBudgetExhausted(t *testing.T) {
+	var hits atomic.Int32
+	failing := newCountingBackend(t, "failing", http.StatusServiceUnavailable, &hits)
+	router := newTestRouter(t, &RouterConfig{
+		RetryBudget: &RetryBudgetConfig{Ratio: 0.2},
+		Rules:       []Rule{{Service: "api", Destination: failing.URL, Retries: 3, RetryBackoffMS: 1}},
+	})
+
+	const requests = 100
+	for i := 0; i < requests; i++ {
+		if rec, _ := serve(router, serviceRequest("api", "")); rec.Code != http.StatusServiceUnavailable {
+			t.Fatalf("request %d = %d, want the backend's 503", i+1, rec.Code)
+		}
+	}
+	// Without the budget every request would be tried 4 times.
+	budget := router.Stats(nil).RetryBudget
+	if budget == nil {
+		t.Fatal("no retry budget in the stats")
+	}
+	if budget.Retries > requests/5 || budget.Retries < requests/5-1 {
+		t.Errorf("%d retries for %d requests, want about 1 in 5", budget.Retries, requests)
+	}
+	if n := uint64(hits.Load()); n != requests+budget.Retries {
+		t.Errorf("backend hit %d times, want %d requests and %d retries", n, requests, budget.Retries)
+	}
+	if budget.Refused == 0 || budget.Available != 0 || budget.Ratio != 0.2 {
+		t.Errorf("budget stats = %+v, want refused retries and none available", *budget)
+	}
+}
+
+func TestRetryBudgetMinPerSecond(t *testing.T) {
+	budget := newRetryBudget(&RetryBudgetConfig{Ratio: 0.25, MinPerSecond: 2})
+	// With no traffic MinPerSecond still allows retries.
+	if !budget.withdraw() || !budget.withdraw() {
+		t.Error("MinPerSecond retries refused")
+	}
+	if budget.withdraw() {
+		t.Error("retry allowed beyond MinPerSecond with no deposits")
+	}
+	for i := 0; i < 4; i++ {
+		budget.deposit()
+	}
+	if !budget.withdraw() {
+		t.Error("retry refused after 4 deposits at ratio 0.25")
+	}
+	var unlimited *retryBudget
+	unlimited.deposit()
+	if !unlimited.withdraw() || unlimited.stats() != nil {
+		t.Error("a nil budget limited retries")
+	}
+}
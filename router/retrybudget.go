@@ -0,0 +1,104 @@
+package router
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RetryBudgetConfig caps retries at a fraction of the requests forwarded,
+// so that during an outage retries cannot multiply the load on failing
+// destinations
+type RetryBudgetConfig struct {
+	// Ratio is the fraction of requests that may be retried: 0.2 allows
+	// one retry for every five requests
+	Ratio float64 `json:"ratio" yaml:"ratio"`
+	// MinPerSecond retries are allowed regardless of Ratio, so that
+	// services with little traffic can still retry
+	MinPerSecond float64 `json:"minPerSecond,omitempty" yaml:"minPerSecond,omitempty"`
+}
+
+// retryBudgetBurst is how many requests' worth of deposits the budget can
+// save up, bounding the burst of retries after a quiet period
+const retryBudgetBurst = 100
+
+// retryBudget is a token bucket that every forwarded request pays Ratio
+// into and every retry withdraws one token from. A nil retryBudget allows
+// every retry.
+type retryBudget struct {
+	ratio        float64
+	minPerSecond float64
+
+	mu      sync.Mutex
+	balance float64   // tokens earned by requests
+	reserve float64   // tokens from MinPerSecond
+	last    time.Time // when reserve was last refilled
+
+	retries atomic.Uint64
+	refused atomic.Uint64
+}
+
+// newRetryBudget creates the budget of config, or nil without one
+func newRetryBudget(config *RetryBudgetConfig) *retryBudget {
+	if config == nil {
+		return nil
+	}
+	return &retryBudget{ratio: config.Ratio, minPerSecond: config.MinPerSecond, reserve: config.MinPerSecond, last: time.Now()}
+}
+
+// deposit credits the budget for a forwarded request
+func (b *retryBudget) deposit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.balance = min(b.balance+b.ratio, b.ratio*retryBudgetBurst)
+}
+
+// withdraw reports whether a retry fits in the budget, spending a token if so
+func (b *retryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.reserve = min(b.reserve+now.Sub(b.last).Seconds()*b.minPerSecond, b.minPerSecond)
+	b.last = now
+	switch {
+	case b.reserve >= 1:
+		b.reserve--
+	case b.balance >= 1:
+		b.balance--
+	default:
+		b.refused.Add(1)
+		return false
+	}
+	b.retries.Add(1)
+	return true
+}
+
+// RetryBudgetStats reports the state of the retry budget
+type RetryBudgetStats struct {
+	Ratio     float64 `json:"ratio"`
+	Available int     `json:"available"` // retries that may be made right now
+	Retries   uint64  `json:"retries"`
+	Refused   uint64  `json:"refused"`
+}
+
+// stats returns the state of the budget, or nil without one
+func (b *retryBudget) stats() *RetryBudgetStats {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	reserve := min(b.reserve+time.Since(b.last).Seconds()*b.minPerSecond, b.minPerSecond)
+	return &RetryBudgetStats{
+		Ratio:     b.ratio,
+		Available: int(b.balance) + int(reserve),
+		Retries:   b.retries.Load(),
+		Refused:   b.refused.Load(),
+	}
+}
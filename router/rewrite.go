@@ -0,0 +1,65 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+)
+
+// setHeader sets key to value on h, or removes it when value is empty
+func setHeader(h http.Header, key, value string) {
+	if value == "" {
+		h.Del(key)
+		return
+	}
+	h.Set(key, value)
+}
+
+// upstreamPath returns the path forwarded for path under rule
+func (rule Rule) upstreamPath(path string) string {
+	if !rule.StripPrefix && rule.RewritePath == "" {
+		return path
+	}
+	rest := strings.TrimPrefix(path, rule.PathPrefix)
+	base := rule.RewritePath
+	if base == "" {
+		base = "/"
+	}
+	if rest == "" {
+		return base
+	}
+	return singleJoiningSlash(base, rest)
+}
+
+// rewritePath returns req with its path rewritten for rule, leaving req
+// itself untouched
+func (rule Rule) rewritePath(req *http.Request) *http.Request {
+	path := rule.upstreamPath(req.URL.Path)
+	if path == req.URL.Path {
+		return req
+	}
+	out := new(http.Request)
+	*out = *req
+	u := *req.URL
+	u.Path, u.RawPath = path, ""
+	out.URL = &u
+	return out
+}
+
+// rewriteRequest applies the RequestHeaders of rule to a forwarded request.
+// The Host key overrides the Host sent upstream rather than adding a header.
+func (rule Rule) rewriteRequest(outReq *http.Request) {
+	for key, value := range rule.RequestHeaders {
+		if strings.EqualFold(key, "Host") {
+			outReq.Host = value
+			continue
+		}
+		setHeader(outReq.Header, key, value)
+	}
+}
+
+// rewriteResponse applies the ResponseHeaders of rule to an upstream response
+func (rule Rule) rewriteResponse(resp *http.Response) {
+	for key, value := range rule.ResponseHeaders {
+		setHeader(resp.Header, key, value)
+	}
+}
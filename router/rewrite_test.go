@@ -0,0 +1,113 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newRecordingBackend starts a backend that passes each request it receives on seen
+func newRecordingBackend(t *testing.T, handler http.HandlerFunc) (*httptest.Server, <-chan *http.Request) {
+	t.Helper()
+	seen := make(chan *http.Request, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		seen <- req
+		if handler != nil {
+			handler(w, req)
+		}
+	}))
+	t.Cleanup(backend.Close)
+	return backend, seen
+}
+
+func TestHeaderRewriting(t *testing.T) {
+	backend, seen := newRecordingBackend(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Server", "backend/1.0")
+		w.Header().Set("X-Backend", "internal")
+	})
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{
+		Service:         "api",
+		Destination:     backend.URL,
+		RequestHeaders:  map[string]string{"Host": "api.internal", "Authorization": "Bearer upstream", "X-Client-Secret": ""},
+		ResponseHeaders: map[string]string{"X-Served-By": "router", "Server": "", "X-Backend": "public"},
+	}}})
+
+	req := serviceRequest("api", "")
+	req.Header.Set("Authorization", "Bearer client")
+	req.Header.Set("X-Client-Secret", "s3cret")
+	req.Header.Set("X-Kept", "yes")
+	rec, _ := serve(router, req)
+	got := <-seen
+
+	if got.Host != "api.internal" {
+		t.Errorf("upstream Host = %q, want api.internal", got.Host)
+	}
+	for key, want := range map[string]string{"Authorization": "Bearer upstream", "X-Client-Secret": "", "X-Kept": "yes", "Host": ""} {
+		if value := got.Header.Get(key); value != want {
+			t.Errorf("upstream %s = %q, want %q", key, value, want)
+		}
+	}
+	for key, want := range map[string]string{"X-Served-By": "router", "Server": "", "X-Backend": "public"} {
+		if value := rec.Header().Get(key); value != want {
+			t.Errorf("response %s = %q, want %q", key, value, want)
+		}
+	}
+}
+
+func TestHostKeyCaseInsensitive(t *testing.T) {
+	backend, seen := newRecordingBackend(t, nil)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL, RequestHeaders: map[string]string{"host": "api.internal"}}}})
+	serve(router, serviceRequest("api", ""))
+	if got := <-seen; got.Host != "api.internal" || got.Header.Get("Host") != "" {
+		t.Errorf("upstream Host = %q, header %q, want api.internal and no header", got.Host, got.Header.Get("Host"))
+	}
+}
+
+func TestUpstreamPath(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+		path string
+		want string
+	}{
+		{"no-op", Rule{PathPrefix: "/api"}, "/api/users", "/api/users"},
+		{"strip", Rule{PathPrefix: "/api", StripPrefix: true}, "/api/users", "/users"},
+		{"strip trailing slash prefix", Rule{PathPrefix: "/api/", StripPrefix: true}, "/api/users", "/users"},
+		{"strip full path", Rule{PathPrefix: "/api", StripPrefix: true}, "/api", "/"},
+		{"rewrite", Rule{PathPrefix: "/api", RewritePath: "/v2"}, "/api/users", "/v2/users"},
+		{"rewrite full path", Rule{PathPrefix: "/api", RewritePath: "/v2"}, "/api", "/v2"},
+		{"rewrite with slash", Rule{PathPrefix: "/api/", RewritePath: "/v2/"}, "/api/users", "/v2/users"},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.upstreamPath(tt.path); got != tt.want {
+			t.Errorf("%s: upstreamPath(%q) = %q, want %q", tt.name, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPathRewritingForwarded(t *testing.T) {
+	backend, seen := newRecordingBackend(t, nil)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{PathPrefix: "/api", StripPrefix: true, Destination: backend.URL},
+		{PathPrefix: "/old", RewritePath: "/new", Destination: backend.URL + "/base"},
+	}})
+	tests := []struct {
+		target, path, query string
+	}{
+		{"/api/users?page=2", "/users", "page=2"},
+		{"/api", "/", ""},
+		{"/old/items", "/base/new/items", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		serve(router, req)
+		got := <-seen
+		if got.URL.Path != tt.path || got.URL.RawQuery != tt.query {
+			t.Errorf("%s forwarded as %s?%s, want %s?%s", tt.target, got.URL.Path, got.URL.RawQuery, tt.path, tt.query)
+		}
+		if req.URL.Path != strings.SplitN(tt.target, "?", 2)[0] {
+			t.Errorf("rewriting %s changed the original request to %s", tt.target, req.URL.Path)
+		}
+	}
+}
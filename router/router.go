@@ -0,0 +1,909 @@
+// Package router routes HTTP requests to destinations by rules, matched on
+// the X-Service-Type header, the host, the path and the query. Run serves
+// it as the go-router binary does; New creates a Router to mount in a
+// server of one's own.
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ServiceRule defines the structure for service routing rules. It is the same
+// type as Rule so that RouterConfig and Router share a single rule shape.
+type ServiceRule = Rule
+
+// RouterConfig holds the array of service rules
+type RouterConfig struct {
+	// Version is the version of the config's shape; files without one are
+	// version 1 and are migrated when loaded
+	Version int `json:"version,omitempty" yaml:"version,omitempty"`
+
+	Rules []ServiceRule `json:"rules" yaml:"rules"`
+
+	// TimeoutMS bounds forwarded requests for rules without their own timeout
+	TimeoutMS int `json:"timeoutMS,omitempty" yaml:"timeoutMS,omitempty"`
+
+	// MaxConnectionAgeMS closes keep-alive client connections after the
+	// first response once they are this old, so clients cycle through
+	// redeployed routers
+	MaxConnectionAgeMS int `json:"maxConnectionAgeMS,omitempty" yaml:"maxConnectionAgeMS,omitempty"`
+
+	// CircuitBreaker stops traffic to destinations that keep failing
+	CircuitBreaker *CircuitBreakerConfig `json:"circuitBreaker,omitempty" yaml:"circuitBreaker,omitempty"`
+
+	// HealthCheck enables periodic probing of every destination
+	HealthCheck *HealthCheckConfig `json:"healthCheck,omitempty" yaml:"healthCheck,omitempty"`
+
+	// MaxBodyBytes caps request bodies; larger requests are answered with
+	// 413 Request Entity Too Large. Zero means no limit.
+	MaxBodyBytes int64 `json:"maxBodyBytes,omitempty" yaml:"maxBodyBytes,omitempty"`
+
+	// MaxConcurrent caps how many requests are handled at once; further
+	// requests are answered with 503 until one completes. Zero means no limit.
+	MaxConcurrent int `json:"maxConcurrent,omitempty" yaml:"maxConcurrent,omitempty"`
+
+	// CacheEntries caps how many responses rules with a CacheTTLMS keep
+	// cached, 1024 by default. It is read when the router is created.
+	CacheEntries int `json:"cacheEntries,omitempty" yaml:"cacheEntries,omitempty"`
+
+	// Compression gzips or deflates text responses of at least 1KB for
+	// clients that accept it, unless the destination already compressed them
+	Compression bool `json:"compression,omitempty" yaml:"compression,omitempty"`
+
+	// LogSampleRate is the fraction, between 0 and 1, of successful requests
+	// written to the access log; errors are always logged. Zero, the
+	// default, logs every request.
+	LogSampleRate float64 `json:"logSampleRate,omitempty" yaml:"logSampleRate,omitempty"`
+
+	// ErrorContentType labels the JSON error bodies of routed requests,
+	// application/json by default
+	ErrorContentType string `json:"errorContentType,omitempty" yaml:"errorContentType,omitempty"`
+	// ErrorPages replace the JSON error body of a status code, such as a
+	// branded HTML page for 502 when a destination is unreachable
+	ErrorPages map[int]ErrorPage `json:"errorPages,omitempty" yaml:"errorPages,omitempty"`
+
+	// Transport sizes the pool of connections to destinations
+	Transport *TransportConfig `json:"transport,omitempty" yaml:"transport,omitempty"`
+
+	// DNS caches the resolution of destination hostnames; like Transport
+	// it is read once at startup
+	DNS *DNSConfig `json:"dns,omitempty" yaml:"dns,omitempty"`
+
+	// RetryBudget limits the rules' retries to a fraction of all forwarded
+	// requests; it is also read once at startup
+	RetryBudget *RetryBudgetConfig `json:"retryBudget,omitempty" yaml:"retryBudget,omitempty"`
+
+	// Default is the destination for requests no rule matches; without it
+	// they are answered with 404
+	Default string `json:"default,omitempty" yaml:"default,omitempty"`
+
+	// TrustProxy takes the client IP from X-Forwarded-For or X-Real-IP.
+	// TrustedProxies lists the CIDRs of proxies whose X-Forwarded-For hops
+	// are skipped to find the client and, with -proxy-protocol, the peers
+	// allowed to send a PROXY protocol header.
+	TrustProxy     bool     `json:"trustProxy,omitempty" yaml:"trustProxy,omitempty"`
+	TrustedProxies []string `json:"trustedProxies,omitempty" yaml:"trustedProxies,omitempty"`
+
+	// ClientRateLimit caps each client IP at this many requests per second
+	// across all services, allowing bursts of up to ClientBurst requests
+	ClientRateLimit float64 `json:"clientRateLimit,omitempty" yaml:"clientRateLimit,omitempty"`
+	ClientBurst     int     `json:"clientBurst,omitempty" yaml:"clientBurst,omitempty"`
+
+	// UDPRoutes route the datagrams received on the UDP listener, in order
+	UDPRoutes []UDPRoute `json:"udpRoutes,omitempty" yaml:"udpRoutes,omitempty"`
+
+	// Allow and Deny list the CIDRs or IPs client addresses are checked
+	// against before routing; denied clients are answered with 403. The most
+	// specific matching entry decides, and with an Allow list clients
+	// matching no entry are denied.
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+
+	// AuthTokens, if set, are the bearer tokens routed requests must carry
+	AuthTokens []string `json:"authTokens,omitempty" yaml:"authTokens,omitempty"`
+
+	// CORS, if set, lets browser apps on the origins it allows call the
+	// routed APIs; preflight requests need no token
+	CORS *CORSConfig `json:"cors,omitempty" yaml:"cors,omitempty"`
+
+	// TimeZone is the IANA time zone, such as Europe/Berlin, that rule
+	// schedules are in; it defaults to the host's local time zone
+	TimeZone string `json:"timeZone,omitempty" yaml:"timeZone,omitempty"`
+
+	trustedProxies []netip.Prefix // parsed TrustedProxies
+	access         accessList     // parsed Allow and Deny
+	index          ruleIndex      // Rules grouped for matching
+	location       *time.Location // loaded TimeZone, nil for local time
+	warnings       []string       // deprecated fields found while loading
+	interpolated   bool           // values were expanded from ${VAR} references
+}
+
+// compile compiles the rule patterns, builds the rule index and parses the
+// trusted proxies. It must run on a validated config after loading it and
+// whenever Rules changes.
+func (c *RouterConfig) compile() {
+	compileRules(c.Rules)
+	c.index = buildIndex(c.Rules)
+	c.trustedProxies, _ = parsePrefixes("trusted proxy", c.TrustedProxies)
+	c.access, _ = parseAccessList(c.Allow, c.Deny)
+	c.location = nil
+	if c.TimeZone != "" {
+		c.location, _ = time.LoadLocation(c.TimeZone)
+	}
+}
+
+// circuitBreakerConfig returns the configured breaker thresholds, which are
+// all zero (disabled) when none are set
+func (c *RouterConfig) circuitBreakerConfig() CircuitBreakerConfig {
+	if c.CircuitBreaker == nil {
+		return CircuitBreakerConfig{}
+	}
+	return *c.CircuitBreaker
+}
+
+// loadConfig loads and validates routing rules from a JSON or YAML file, or
+// from a directory of them merged by loadConfigDir. When strict, unknown
+// fields are errors.
+func loadConfig(filename string, strict bool) (*RouterConfig, error) {
+	if info, err := os.Stat(filename); err == nil && info.IsDir() {
+		return loadConfigDir(filename, strict)
+	}
+	file, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := &RouterConfig{}
+	err = unmarshalConfig(filename, file, config, strict)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	config.compile()
+	return config, nil
+}
+
+// routeTraffic routes the incoming request based on the service rules
+func (r *Router) routeTraffic(service string) (string, bool) {
+	req := &http.Request{Header: http.Header{"X-Service-Type": {service}}, URL: &url.URL{}}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, destination, err := r.match(req, nil)
+	return destination, err == nil
+}
+
+// handler handles incoming HTTP requests, routes them based on service rules
+// and records a session for every routed request
+func handler(router *Router, sessionManager *SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		req, span := startSpan(req)
+		sourceIP, sourcePort := router.clientAddr(req)
+		req = withClientIP(req, sourceIP)
+		requestService := req.Header.Get("X-Service-Type")
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		w = rec
+		entry := &accessLog{sourceIP: sourceIP, service: requestService}
+		defer func() { router.logRequest(req, entry, rec.status, start) }()
+		defer func() { finishSpan(span, entry, rec.status) }()
+
+		if !router.permitClient(sourceIP) {
+			router.writeError(w, http.StatusForbidden, "forbidden", map[string]string{"sourceIP": sourceIP})
+			return
+		}
+		if ok, delay := router.allowClient(sourceIP); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(delay)))
+			router.writeError(w, http.StatusTooManyRequests, "too_many_requests", map[string]string{"sourceIP": sourceIP})
+			return
+		}
+
+		// A client pinned to a destination by its affinity cookie, its
+		// session or its location skips the balancer, so the balancer's
+		// pick never claims a half-open circuit it would not use.
+		rule, destination, err := router.resolve(req, func(rule Rule) (string, bool) {
+			if pinned, ok := router.cookieDestination(rule, req); ok {
+				return pinned, true
+			}
+			if sticky, ok := router.stickyDestination(rule, sessionManager, sourceIP, sourcePort); ok {
+				return sticky, true
+			}
+			return router.geoDestination(rule, sourceIP)
+		})
+		if errors.Is(err, errNoDestination) {
+			entry.matched, entry.service, entry.owner = true, rule.key(), rule.Service
+			router.writeError(w, http.StatusServiceUnavailable, "no_destination", map[string]string{"service": rule.key()})
+			return
+		}
+		if err != nil {
+			router.writeError(w, http.StatusNotFound, "service_not_found", map[string]string{"service": requestService})
+			return
+		}
+		entry.matched, entry.service, entry.owner, entry.destination = true, rule.key(), rule.Service, destination
+		if !rule.access.permits(sourceIP) {
+			router.writeError(w, http.StatusForbidden, "forbidden", map[string]string{"service": rule.key(), "sourceIP": sourceIP})
+			return
+		}
+		if ok, delay := router.allow(rule); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(delay)))
+			router.writeError(w, http.StatusTooManyRequests, "too_many_requests", map[string]string{"service": rule.key()})
+			return
+		}
+
+		release, ok := router.acquireQueued(req.Context(), rule)
+		if !ok {
+			router.writeError(w, http.StatusServiceUnavailable, "overloaded", map[string]string{"service": rule.key()})
+			return
+		}
+		defer release()
+
+		if limit := router.maxBodyFor(rule); limit > 0 {
+			if req.ContentLength > limit {
+				router.writeError(w, http.StatusRequestEntityTooLarge, "payload_too_large", map[string]string{"service": rule.key()})
+				return
+			}
+			req.Body = http.MaxBytesReader(w, req.Body, limit)
+		}
+
+		if isUpgrade(req) {
+			status, err := router.proxyUpgrade(w, req, rule, destination)
+			if status != 0 {
+				rec.status = status
+			}
+			if err != nil && status == 0 {
+				router.writeUpstreamError(w, rule, destination, err)
+			}
+			return
+		}
+
+		if router.cache.serve(w, rule, req) {
+			entry.destination = "cache"
+			return
+		}
+
+		// An event stream stays open for as long as it has events to send,
+		// so its timeout only bounds the wait for the stream to open.
+		ctx := req.Context()
+		var streamTimer *headerTimer
+		if timeout := router.timeoutFor(rule); timeout > 0 && acceptsEventStream(req) {
+			var timed *http.Request
+			timed, streamTimer = startHeaderTimer(req, timeout)
+			ctx = timed.Context()
+			defer streamTimer.release()
+		} else if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		var connected string
+		ctx = traceRemoteAddr(ctx, &connected)
+		mirror := router.sampleMirror(req, rule)
+		resp, destination, err := router.forwardWithRetry(req.WithContext(ctx), rule, destination)
+		err = streamTimer.stop(err)
+		if mirror != nil {
+			mirror()
+		}
+		entry.destination = destination
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			router.writeError(w, http.StatusRequestEntityTooLarge, "payload_too_large", map[string]string{"service": rule.key()})
+			return
+		}
+		if err != nil {
+			router.writeUpstreamError(w, rule, destination, err)
+			return
+		}
+		destIP, destPort := resolvedAddr(rule, destination, connected)
+		session := &Session{
+			DateTimeStamp:   time.Now(),
+			SourceIP:        sourceIP,
+			RequestService:  requestService,
+			SourcePort:      sourcePort,
+			Destination:     destination,
+			DestinationIP:   destIP,
+			DestinationPort: destPort,
+		}
+		sessionManager.AddOrUpdateSession(session)
+		setAffinityCookie(w, req, rule, destination)
+
+		copyResponse(w, router.cache.fill(rule, req, resp))
+	}
+}
+
+// Rule represents a routing rule with a service and one or more destinations
+type Rule struct {
+	Service      string   `json:"service" yaml:"service"`
+	Destination  string   `json:"destination,omitempty" yaml:"destination,omitempty"`
+	Destinations []string `json:"destinations,omitempty" yaml:"destinations,omitempty"`
+
+	Weights []WeightedDestination `json:"weights,omitempty" yaml:"weights,omitempty"`
+
+	// Backup destinations take the rule's traffic only while none of its
+	// other destinations is healthy, until one of them recovers
+	Backup []string `json:"backup,omitempty" yaml:"backup,omitempty"`
+
+	// Strategy names the LoadBalancer spreading requests over the
+	// destinations: roundRobin, weighted, random, leastConnections, ipHash
+	// or keyHash. It defaults to weighted for rules with Weights and
+	// roundRobin otherwise.
+	Strategy string `json:"strategy,omitempty" yaml:"strategy,omitempty"`
+	// HashHeader names the request header whose value keyHash routes by
+	HashHeader string `json:"hashHeader,omitempty" yaml:"hashHeader,omitempty"`
+
+	// Blue and Green are the destinations of a blue/green deployment; all
+	// traffic goes to the Active one, blue or green, blue by default. They
+	// take the place of the other destination fields.
+	Blue   string `json:"blue,omitempty" yaml:"blue,omitempty"`
+	Green  string `json:"green,omitempty" yaml:"green,omitempty"`
+	Active string `json:"active,omitempty" yaml:"active,omitempty"`
+
+	// PathPrefix matches requests without an X-Service-Type header by URL
+	// path, such as the /package.Service path of gRPC calls
+	PathPrefix string `json:"pathPrefix,omitempty" yaml:"pathPrefix,omitempty"`
+	// StripPrefix removes PathPrefix from the path forwarded upstream;
+	// RewritePath replaces it instead, so with PathPrefix /api and
+	// RewritePath /v2, /api/users is forwarded as /v2/users
+	StripPrefix bool   `json:"stripPrefix,omitempty" yaml:"stripPrefix,omitempty"`
+	RewritePath string `json:"rewritePath,omitempty" yaml:"rewritePath,omitempty"`
+	// Host restricts the rule to a virtual host, either exact or *.example.com
+	Host string `json:"host,omitempty" yaml:"host,omitempty"`
+	// Pattern matches X-Service-Type values against a regular expression
+	// when no rule's Service is an exact hit
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	// QueryParam names a query parameter, such as svc in ?svc=payments, whose
+	// value is matched against Service and Pattern for requests without an
+	// X-Service-Type header
+	QueryParam string `json:"queryParam,omitempty" yaml:"queryParam,omitempty"`
+	// Methods restricts the rule to requests with one of these HTTP
+	// methods, so rules for the same service can route reads and writes
+	// apart. Empty means every method.
+	Methods []string `json:"methods,omitempty" yaml:"methods,omitempty"`
+	// Schedule restricts the rule to a window of time; outside it requests
+	// fall through to the next rule that matches
+	Schedule *Schedule `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+
+	pattern   *regexp.Regexp      // compiled Pattern
+	access    accessList          // parsed Allow and Deny
+	upstreams map[string]upstream // parsed destinations
+	window    *window             // parsed Schedule
+
+	// TotalTimeoutMS bounds a forwarded request from start to the end of
+	// its response body, overriding the global timeout; TimeoutMS is its
+	// name in version 1 configs. DialTimeoutMS bounds connecting to a destination and
+	// ResponseHeaderTimeoutMS waiting for its response headers, per attempt.
+	// A rule setting either of those but no total timeout has none, so
+	// streamed responses are not cut off by the global timeout. Requests
+	// accepting text/event-stream are only bounded by the total timeout
+	// until the response headers arrive.
+	TotalTimeoutMS          int `json:"totalTimeoutMS,omitempty" yaml:"totalTimeoutMS,omitempty"`
+	TimeoutMS               int `json:"timeoutMS,omitempty" yaml:"timeoutMS,omitempty"`
+	DialTimeoutMS           int `json:"dialTimeoutMS,omitempty" yaml:"dialTimeoutMS,omitempty"`
+	ResponseHeaderTimeoutMS int `json:"responseHeaderTimeoutMS,omitempty" yaml:"responseHeaderTimeoutMS,omitempty"`
+
+	// Retries is how many times a failed request is retried against the next
+	// destination; only idempotent methods are retried unless
+	// RetryNonIdempotent is set
+	Retries            int   `json:"retries,omitempty" yaml:"retries,omitempty"`
+	RetryOnStatus      []int `json:"retryOnStatus,omitempty" yaml:"retryOnStatus,omitempty"`
+	RetryNonIdempotent bool  `json:"retryNonIdempotent,omitempty" yaml:"retryNonIdempotent,omitempty"`
+	RetryBackoffMS     int   `json:"retryBackoffMS,omitempty" yaml:"retryBackoffMS,omitempty"`
+	RetryMaxBackoffMS  int   `json:"retryMaxBackoffMS,omitempty" yaml:"retryMaxBackoffMS,omitempty"`
+
+	// RequestHeaders are set on requests forwarded under the rule, with the
+	// Host key overriding the upstream Host; ResponseHeaders are set on the
+	// responses passed back. An empty value removes the header.
+	RequestHeaders  map[string]string `json:"requestHeaders,omitempty" yaml:"requestHeaders,omitempty"`
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty" yaml:"responseHeaders,omitempty"`
+
+	// MaxBodyBytes caps request bodies, overriding the global limit
+	MaxBodyBytes int64 `json:"maxBodyBytes,omitempty" yaml:"maxBodyBytes,omitempty"`
+
+	// MaxConcurrent caps how many requests the rule handles at once, within
+	// the global limit
+	MaxConcurrent int `json:"maxConcurrent,omitempty" yaml:"maxConcurrent,omitempty"`
+
+	// QueueSize lets up to this many requests over a concurrency limit wait,
+	// in order of arrival, for a slot instead of failing at once. Those still
+	// waiting after QueueTimeoutMS, 1000 by default, fail with 503.
+	QueueSize      int `json:"queueSize,omitempty" yaml:"queueSize,omitempty"`
+	QueueTimeoutMS int `json:"queueTimeoutMS,omitempty" yaml:"queueTimeoutMS,omitempty"`
+
+	// GeoDestinations send clients to a destination by the ISO country code,
+	// such as DE, or else the continent code, such as EU, of their IP in
+	// the GeoIP database. Other clients, and all clients when no database
+	// is loaded, use the rule's regular destinations.
+	GeoDestinations map[string]string `json:"geoDestinations,omitempty" yaml:"geoDestinations,omitempty"`
+
+	// Mirror receives a copy of MirrorPercent percent of the rule's
+	// requests once they have been forwarded; its responses are discarded
+	Mirror        string `json:"mirror,omitempty" yaml:"mirror,omitempty"`
+	MirrorPercent int    `json:"mirrorPercent,omitempty" yaml:"mirrorPercent,omitempty"`
+
+	// Allow and Deny restrict the clients the rule serves, like the global
+	// lists and in addition to them
+	Allow []string `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty" yaml:"deny,omitempty"`
+
+	// CacheTTLMS caches successful GET responses for this long. Responses
+	// marked no-store or private, or setting cookies, are not cached.
+	CacheTTLMS int `json:"cacheTTLMS,omitempty" yaml:"cacheTTLMS,omitempty"`
+
+	// Sticky keeps sending a client to the destination recorded in its
+	// session for as long as the session lives and the destination is up
+	Sticky bool `json:"sticky,omitempty" yaml:"sticky,omitempty"`
+	// AffinityCookie names a cookie, such as ROUTERAFFINITY, that pins a
+	// client to a destination so affinity survives changes of client
+	// address. If the pinned destination is down another one is picked.
+	AffinityCookie string `json:"affinityCookie,omitempty" yaml:"affinityCookie,omitempty"`
+
+	// RateLimit caps the rule at this many requests per second, allowing
+	// bursts of up to Burst requests
+	RateLimit float64 `json:"rateLimit,omitempty" yaml:"rateLimit,omitempty"`
+	Burst     int     `json:"burst,omitempty" yaml:"burst,omitempty"`
+}
+
+// pool returns every destination of the rule, Destination first
+func (rule Rule) pool() []string {
+	if rule.Destination == "" {
+		return rule.Destinations
+	}
+	return append([]string{rule.Destination}, rule.Destinations...)
+}
+
+// Router holds the routing rules
+type Router struct {
+	RouterConfig
+	mu        sync.RWMutex
+	balancers sync.Map // rule key and strategy -> LoadBalancer
+	active    sync.Map // destination -> *atomic.Int64 in-flight requests
+	limiters  sync.Map // service -> *limiterEntry
+
+	clientLimiters sync.Map // client IP -> *limiterEntry
+	inFlight       inFlightCounts
+	queues         sync.Map // rule key -> *requestQueue
+
+	breaker *CircuitBreaker
+	health  atomic.Pointer[HealthChecker] // nil unless HealthCheck is configured
+	client  *http.Client                  // pooled client shared by all forwarded requests
+	dns     *dnsCache                     // nil unless DNS caching is configured
+	budget  *retryBudget                  // nil unless RetryBudget is configured
+	stats   *trafficStats
+	cache   *responseCache
+	geo     *geoResolver   // nil unless a GeoIP database is loaded
+	packets *packetCounter // nil unless built with the ebpf tag and permitted
+
+	configErr    error  // the last config reload error, nil while ready
+	rulesVersion uint64 // bumped whenever Rules is replaced
+
+	healthCtx  context.Context    // given to StartHealthChecks, nil before
+	stopHealth context.CancelFunc // stops the running health checker
+
+	closing     context.Context    // canceled by Close
+	closeRouter context.CancelFunc // cancels closing
+	closeOnce   sync.Once
+	closeErr    error
+	background  sync.WaitGroup // goroutines Close waits for
+	closers     []func() error // registered with OnClose
+
+	// Logger receives the router's structured logs; slog.Default is used when nil
+	Logger *slog.Logger
+	// AccessLoggers, if set, returns the logger receiving the access logs
+	// of requests matched to a rule of service, or nil for Logger. Requests
+	// that matched no rule are always logged to Logger.
+	AccessLoggers func(service string) *slog.Logger
+	// Balancers creates the LoadBalancer of each rule from its Strategy;
+	// NewLoadBalancer is used when nil
+	Balancers BalancerFactory
+	// Matchers pick the rule or destination of each request in order;
+	// BuiltinMatchers is used when nil. Prepend a custom Matcher to
+	// BuiltinMatchers to route on more than the rules. Set it before the
+	// router serves requests.
+	Matchers []Matcher
+	// Middleware wraps the routing of each request, in order, inside the
+	// router's own connection draining, request IDs, CORS, compression and
+	// authentication, so that it sees the request ID and only requests
+	// that passed AuthTokens. Set it before the router serves requests.
+	Middleware []func(http.Handler) http.Handler
+
+	now func() time.Time // clock rule schedules are checked against; time.Now when nil
+
+	strictConfig bool // reject unknown fields when reloading the config
+
+	defaultTimeout  time.Duration // set by WithTimeout
+	defaultStrategy string        // set by WithStrategy
+
+	sessions   *SessionManager // sessions of ServeHTTP
+	routedOnce sync.Once
+	routed     http.Handler // the handler chain of ServeHTTP
+}
+
+// NewRouter creates a new Router from a JSON or YAML config file, or from a
+// directory of them
+func NewRouter(filename string) (*Router, error) {
+	config, err := loadConfig(filename, false)
+	if err != nil {
+		return nil, err
+	}
+	return newRouter(config), nil
+}
+
+// LoadRouterFromDir creates a router from every .json and .yaml file in dir,
+// merged in lexical order. Defining the same rule in two files is an error.
+func LoadRouterFromDir(dir string) (*Router, error) {
+	config, err := loadConfigDir(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	return newRouter(config), nil
+}
+
+// New creates a Router configured by opts, whose ServeHTTP routes requests
+// as the server of Run does. Background work such as health checks is left
+// to the caller to start, and Close releases the router once it is done
+// with.
+func New(opts ...Option) (*Router, error) {
+	o := options{configFile: DefaultSettings.ConfigFile}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	config := o.config
+	if config == nil {
+		var err error
+		if config, err = loadConfig(o.configFile, o.strictConfig); err != nil {
+			return nil, err
+		}
+	} else {
+		config = &RouterConfig{}
+		*config = *o.config
+		config.Rules = append([]Rule(nil), o.config.Rules...)
+		if err := config.Validate(); err != nil {
+			return nil, err
+		}
+		config.compile()
+	}
+	if o.strategy != "" {
+		if _, err := NewLoadBalancer(Rule{Strategy: o.strategy}); err != nil {
+			return nil, fmt.Errorf("default %w", err)
+		}
+	}
+	router := newRouter(config)
+	router.strictConfig = o.strictConfig
+	router.Logger = o.logger
+	if hc := router.health.Load(); hc != nil {
+		// newRouter created the checker before the logger was known.
+		hc.logger = router.logger()
+	}
+	router.sessions = o.sessions
+	router.defaultTimeout = o.timeout
+	router.defaultStrategy = o.strategy
+	router.Middleware = o.middleware
+	if o.tls != nil {
+		router.client.Transport.(*http.Transport).TLSClientConfig = o.tls.Clone()
+	}
+	return router, nil
+}
+
+// ServeHTTP routes req to its destination. Routers created without
+// WithSessions or WithSessionStore keep sessions in memory.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.routedOnce.Do(func() {
+		if r.sessions == nil {
+			r.sessions = NewSessionManager(NewMemoryStore())
+		}
+		builtin := []func(http.Handler) http.Handler{r.drainOldConnections, WithRequestID, r.cors, r.compress, r.authenticate}
+		r.routed = Chain(append(builtin, r.Middleware...)...)(handler(r, r.sessions))
+	})
+	r.routed.ServeHTTP(w, req)
+}
+
+// newRouter creates a router for a loaded config
+func newRouter(config *RouterConfig) *Router {
+	var dns *dnsCache
+	if config.DNS != nil {
+		dns = newDNSCache(*config.DNS, lookupHost)
+	}
+	router := &Router{
+		RouterConfig: *config,
+		breaker:      NewCircuitBreaker(config.circuitBreakerConfig()),
+		client:       newForwardClient(config.transportConfig(), dns),
+		dns:          dns,
+		budget:       newRetryBudget(config.RetryBudget),
+		stats:        newTrafficStats(),
+		cache:        newResponseCache(config.CacheEntries),
+	}
+	router.closing, router.closeRouter = context.WithCancel(context.Background())
+	if config.HealthCheck != nil {
+		router.health.Store(NewHealthChecker(*config.HealthCheck, router.destinations, router.logger()))
+	}
+	return router
+}
+
+// RouteRequest routes an HTTP request through the router's Matchers, by
+// default matching the rules on the X-Service-Type header, the Host header,
+// the query and the URL path
+func (r *Router) RouteRequest(req *http.Request) (string, bool) {
+	_, destination, err := r.resolve(req, nil)
+	return destination, err == nil
+}
+
+// resolve returns the rule matching req along with the chosen destination,
+// preferring the one pin returns as match does
+func (r *Router) resolve(req *http.Request, pin func(Rule) (string, bool)) (Rule, string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rule, destination, err := r.match(req, pin)
+	if errors.Is(err, errRouteNotFound) {
+		routingMisses.Inc()
+	} else {
+		requestsRouted.WithLabelValues(rule.key()).Inc()
+		r.stats.countService(rule.key())
+	}
+	return rule, destination, err
+}
+
+// timeoutFor returns the total forwarding timeout for rule, or 0 for none
+func (r *Router) timeoutFor(rule Rule) time.Duration {
+	switch {
+	case rule.TotalTimeoutMS > 0:
+		return time.Duration(rule.TotalTimeoutMS) * time.Millisecond
+	case rule.TimeoutMS > 0:
+		return time.Duration(rule.TimeoutMS) * time.Millisecond
+	case rule.DialTimeoutMS > 0 || rule.ResponseHeaderTimeoutMS > 0:
+		return 0
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.TimeoutMS > 0 {
+		return time.Duration(r.TimeoutMS) * time.Millisecond
+	}
+	return r.defaultTimeout
+}
+
+// maxBodyFor returns the request body limit for rule, 0 meaning unlimited
+func (r *Router) maxBodyFor(rule Rule) int64 {
+	if rule.MaxBodyBytes > 0 {
+		return rule.MaxBodyBytes
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.MaxBodyBytes
+}
+
+// SetRules atomically replaces the router's rules
+func (r *Router) SetRules(rules []Rule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Rules = make([]Rule, len(rules))
+	for i, rule := range rules {
+		r.Rules[i] = upgradeRule(rule)
+	}
+	r.rulesVersion++
+	r.compile()
+}
+
+// shutdownTimeout bounds how long in-flight requests may take to drain on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// Run serves the router until ctx is canceled, then stops accepting new
+// connections, waits for in-flight requests to finish and saves the sessions
+func Run(ctx context.Context, settings Settings) error {
+	var logOutput io.Writer = os.Stdout
+	if settings.LogFile != "" {
+		file := settings.LogRotation.file(settings.LogFile)
+		defer file.Close()
+		logOutput = file
+	}
+	logger := slog.New(slog.NewJSONHandler(logOutput, nil))
+	slog.SetDefault(logger)
+
+	config, err := loadConfig(settings.ConfigFile, settings.StrictConfig)
+	if err != nil {
+		return fmt.Errorf("loading config: %w", err)
+	}
+	router := newRouter(config)
+	router.strictConfig = settings.StrictConfig
+
+	router.Logger = logger
+	router.logConfigWarnings()
+	defer router.Close()
+
+	if err := router.Watch(settings.ConfigFile); err != nil {
+		logger.Error("watching config", "error", err)
+	}
+
+	router.ReloadOnSignal(ctx, settings.ConfigFile, syscall.SIGHUP)
+
+	router.StartHealthChecks(ctx)
+	router.StartDNSRefresh(ctx)
+	router.StartLimiterCleanup(ctx, time.Minute)
+	if router.packets, err = newPacketCounter(); err != nil {
+		logger.Warn("packet counting unavailable", "error", err)
+	}
+	router.OnClose(router.packets.Close)
+	shutdownTracing, err := setupTracing(ctx, settings.OTLPEndpoint)
+	if err != nil {
+		return fmt.Errorf("setting up tracing: %w", err)
+	}
+	if settings.AccessLogDir != "" {
+		logs, err := newServiceLogs(settings.AccessLogDir, settings.LogRotation)
+		if err != nil {
+			return fmt.Errorf("opening access logs: %w", err)
+		}
+		router.AccessLoggers = logs.logger
+		router.OnClose(logs.Close)
+	}
+	if settings.GeoIPDB != "" {
+		if router.geo, err = openGeoIP(settings.GeoIPDB); err != nil {
+			logger.Warn("GeoIP routing unavailable", "file", settings.GeoIPDB, "error", err)
+		}
+		router.OnClose(router.geo.Close)
+	}
+
+	var certs *certReloader
+	if settings.TLSCert != "" {
+		if certs, err = newCertReloader(settings.TLSCert, settings.TLSKey, logger); err != nil {
+			return fmt.Errorf("loading TLS certificate: %w", err)
+		}
+	}
+	var adminTLS *tls.Config
+	if settings.AdminClientCA != "" {
+		if adminTLS, err = clientAuthConfig(certs, settings.AdminClientCA); err != nil {
+			return fmt.Errorf("loading admin client CA: %w", err)
+		}
+	}
+
+	store, err := newSessionStore(settings.SessionStore)
+	if err != nil {
+		return fmt.Errorf("opening session store: %w", err)
+	}
+	if closer, ok := store.(io.Closer); ok {
+		router.OnClose(closer.Close)
+	}
+	sessionManager := NewSessionManager(store)
+	cleanupCtx, stopCleanup := context.WithCancel(ctx)
+	cleanupDone := sessionManager.StartCleanup(cleanupCtx, sessionManager.CleanupInterval)
+
+	// Only the in-memory store needs the session file to survive restarts.
+	stopAutoSave := func() {}
+	if _, ok := store.(*MemoryStore); ok {
+		err := sessionManager.LoadSessionsFromFile(settings.SessionsFile)
+		if errors.Is(err, ErrCorruptSessionFile) {
+			logger.Error("ignoring corrupt session file", "error", err)
+		} else if err != nil {
+			logger.Error("loading sessions", "error", err)
+		}
+		stopAutoSave = sessionManager.StartAutoSave(settings.SessionsFile, 5*time.Second)
+	}
+	router.OnClose(func() error {
+		stopCleanup()
+		<-cleanupDone
+		stopAutoSave() // performs the final save
+		return nil
+	})
+
+	// Rule changes made through the admin API cannot be written back to a
+	// directory of config files, so they only last until the next reload.
+	persistFile := settings.ConfigFile
+	if info, err := os.Stat(persistFile); err == nil && info.IsDir() {
+		persistFile = ""
+	}
+	router.sessions = sessionManager
+	server := &http.Server{Addr: settings.Listen, Handler: router, ConnContext: connContext}
+	adminServer := &http.Server{Addr: settings.AdminListen, Handler: adminMux(router, sessionManager, persistFile, certs)}
+	// HTTP/2 setup fills in server.TLSConfig, so decide on TLS up front.
+	serveTLS := certs != nil
+	if serveTLS {
+		server.TLSConfig = &tls.Config{GetCertificate: certs.GetCertificate}
+	}
+	if err := serveHTTP2(server, settings.HTTP2); err != nil {
+		return fmt.Errorf("configuring HTTP/2: %w", err)
+	}
+	adminServer.TLSConfig = adminTLS
+	var redirectServer *http.Server
+	if settings.RedirectListen != "" {
+		redirectServer = &http.Server{Addr: settings.RedirectListen, Handler: redirectHandler(tcpAddr(settings.Listen))}
+	}
+
+	// UDP flows share the session table, so /conntrack and /sessions list
+	// them alongside the HTTP clients.
+	var udpRouter *UDPRouter
+	if settings.UDPListen != "" {
+		udpRouter = NewUDPRouter(settings.UDPListen, router, sessionManager)
+		router.OnClose(udpRouter.Close)
+	}
+
+	// Bind before serving so that an address in use fails startup; the
+	// server closes the listeners, removing Unix socket files, on shutdown.
+	var listeners []net.Listener
+	for _, addr := range listenAddrs(settings.Listen) {
+		ln, err := listen(addr)
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return fmt.Errorf("listening on %s: %w", addr, err)
+		}
+		if settings.ProxyProtocol {
+			ln = router.proxyProtocolListener(ln)
+		}
+		listeners = append(listeners, ln)
+	}
+
+	errs := make(chan error, len(listeners)+3)
+	go func() {
+		logger.Info("admin API is running", "addr", adminServer.Addr, "clientAuth", adminServer.TLSConfig != nil)
+		if adminServer.TLSConfig != nil {
+			errs <- adminServer.ListenAndServeTLS("", "")
+			return
+		}
+		errs <- adminServer.ListenAndServe()
+	}()
+	for _, ln := range listeners {
+		go func() {
+			logger.Info("server is running", "addr", ln.Addr().String(), "tls", serveTLS)
+			if serveTLS {
+				errs <- server.ServeTLS(ln, "", "")
+				return
+			}
+			errs <- server.Serve(ln)
+		}()
+	}
+	if redirectServer != nil {
+		go func() {
+			logger.Info("redirecting HTTP to HTTPS", "addr", redirectServer.Addr)
+			errs <- redirectServer.ListenAndServe()
+		}()
+	}
+
+	if udpRouter != nil {
+		go func() {
+			logger.Info("UDP router is running", "addr", udpRouter.Addr)
+			errs <- udpRouter.ListenAndServe()
+		}()
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		logger.Info("shutting down")
+	case runErr = <-errs:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error("shutting down server", "error", err)
+	}
+	if err := adminServer.Shutdown(shutdownCtx); err != nil {
+		logger.Error("shutting down admin API", "error", err)
+	}
+	if redirectServer != nil {
+		if err := redirectServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("shutting down redirect server", "error", err)
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("flushing traces", "error", err)
+	}
+	if err := router.Close(); err != nil {
+		logger.Error("closing router", "error", err)
+	}
+	return runErr
+}
@@ -0,0 +1,127 @@
+package router
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// newTestRouter creates a router for config that logs nothing, closed when
+// the test ends
+func newTestRouter(t *testing.T, config *RouterConfig, opts ...Option) *Router {
+	t.Helper()
+	quiet := slog.New(slog.NewTextHandler(io.Discard, nil))
+	router, err := New(append([]Option{WithConfig(config), WithLogger(quiet)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { router.Close() })
+	return router
+}
+
+// newBackend starts a backend answering every request with name
+func newBackend(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, name)
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+// serve routes req through router and returns the response with its body read
+func serve(router http.Handler, req *http.Request) (*httptest.ResponseRecorder, string) {
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec, rec.Body.String()
+}
+
+// serviceRequest returns a GET request for service from the client at remoteAddr
+func serviceRequest(service, remoteAddr string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Service-Type", service)
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+	return req
+}
+
+func TestSetRulesConcurrentWithRouting(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: "http://a:1"}}})
+	swaps := [][]Rule{
+		{{Service: "api", Destination: "http://a:1"}},
+		{{Service: "api", Destinations: []string{"http://b:1", "http://c:1"}}, {Service: "web", Destination: "http://w:1"}},
+	}
+	want := map[string]bool{"http://a:1": true, "http://b:1": true, "http://c:1": true}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := serviceRequest("api", "")
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if destination, ok := router.RouteRequest(req); !ok || !want[destination] {
+					t.Errorf("routed to %q, %v", destination, ok)
+					return
+				}
+				if destination, ok := router.routeTraffic("api"); !ok || !want[destination] {
+					t.Errorf("routeTraffic = %q, %v", destination, ok)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		router.SetRules(swaps[i%len(swaps)])
+	}
+	close(stop)
+	wg.Wait()
+
+	if destination, ok := router.RouteRequest(serviceRequest("web", "")); !ok || destination != "http://w:1" {
+		t.Errorf("after the last swap web routed to %q, %v", destination, ok)
+	}
+}
+
+func TestDefaultDestination(t *testing.T) {
+	api, fallback := newBackend(t, "api"), newBackend(t, "fallback")
+	rules := []Rule{{Service: "api", Destination: api.URL}}
+	tests := []struct {
+		name    string
+		def     string
+		service string
+		status  int
+		body    string
+	}{
+		{name: "matched", def: fallback.URL, service: "api", status: http.StatusOK, body: "api"},
+		{name: "unmatched with default", def: fallback.URL, service: "other", status: http.StatusOK, body: "fallback"},
+		{name: "no header with default", def: fallback.URL, status: http.StatusOK, body: "fallback"},
+		{name: "unmatched without default", service: "other", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, &RouterConfig{Default: tt.def, Rules: rules})
+			req := serviceRequest(tt.service, "")
+			if tt.service == "" {
+				req.Header.Del("X-Service-Type")
+			}
+			rec, body := serve(router, req)
+			if rec.Code != tt.status || (tt.body != "" && body != tt.body) {
+				t.Errorf("response = %d %q, want %d %q", rec.Code, body, tt.status, tt.body)
+			}
+			destination, ok := router.RouteRequest(req)
+			if wantOK := tt.status == http.StatusOK; ok != wantOK || (!ok && destination != "") {
+				t.Errorf("RouteRequest = %q, %v, want ok %v", destination, ok, wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// freeAddr returns a local TCP address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+func TestRunGracefulShutdown(t *testing.T) {
+	unblock := make(chan struct{})
+	backend, entered := newBlockingBackend(t, "api", unblock)
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "router.json")
+	config, _ := json.Marshal(RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL}}})
+	if err := os.WriteFile(configFile, config, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Run installs its logger as the default.
+	defer slog.SetDefault(slog.Default())
+	settings := DefaultSettings
+	settings.ConfigFile = configFile
+	settings.Listen, settings.AdminListen = freeAddr(t), freeAddr(t)
+	settings.SessionsFile = filepath.Join(dir, "sessions.json")
+	settings.LogFile = filepath.Join(dir, "router.log")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- Run(ctx, settings) }()
+
+	url := "http://" + settings.Listen + "/"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", settings.Listen)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("router never listened: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A request in flight when shutdown starts is let finish.
+	status := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("X-Service-Type", "api")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request never reached the backend")
+	}
+	cancel()
+	// New connections are refused once the listener closes.
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", settings.Listen)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("router kept accepting connections after shutdown started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Run returned %v with a request in flight", err)
+	default:
+	}
+
+	close(unblock)
+	if code := <-status; code != http.StatusOK {
+		t.Errorf("in-flight request = %d, want 200", code)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run = %v, want nil after cancellation", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after shutdown")
+	}
+
+	// The client's session was saved on the way out.
+	saved := NewSessionManager(nil)
+	if err := saved.LoadSessionsFromFile(settings.SessionsFile); err != nil || saved.Count() != 1 {
+		t.Errorf("saved sessions = %d, %v, want the one client", saved.Count(), err)
+	}
+}
@@ -0,0 +1,160 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule limits a rule to a window of time in the config's TimeZone, so
+// that, listed ahead of the rule it stands in for, it can send a service to
+// a maintenance backend while the window lasts. Start and End bound a
+// one-off window as 2006-01-02T15:04 times; Days and From and To a weekly
+// one, such as from 02:00 to 04:00 on sat and sun. Every field set must
+// hold for the rule to apply. A From later than To crosses midnight and the
+// hours after midnight count towards the day the window started.
+type Schedule struct {
+	Start string   `json:"start,omitempty" yaml:"start,omitempty"`
+	End   string   `json:"end,omitempty" yaml:"end,omitempty"`
+	Days  []string `json:"days,omitempty" yaml:"days,omitempty"`
+	From  string   `json:"from,omitempty" yaml:"from,omitempty"`
+	To    string   `json:"to,omitempty" yaml:"to,omitempty"`
+}
+
+// Layouts of the Schedule fields
+const (
+	scheduleDateTime = "2006-01-02T15:04"
+	scheduleClock    = "15:04"
+)
+
+// String summarizes the schedule, for telling apart the rules of a service
+// that apply at different times
+func (s Schedule) String() string {
+	var parts []string
+	if s.Start != "" || s.End != "" {
+		parts = append(parts, s.Start+".."+s.End)
+	}
+	if len(s.Days) > 0 {
+		parts = append(parts, strings.ToLower(strings.Join(s.Days, ",")))
+	}
+	if s.From != "" || s.To != "" {
+		parts = append(parts, s.From+"-"+s.To)
+	}
+	return strings.Join(parts, " ")
+}
+
+// window is a parsed Schedule. Times are wall clock times in the config's
+// time zone, held as UTC so they compare without converting.
+type window struct {
+	start, end time.Time // zero when unset
+	days       uint8     // bit per time.Weekday, 0 for every day
+	from, to   int       // minutes into the day, or -1 when unset
+}
+
+// parseWeekday parses a day name such as mon or Monday
+func parseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(name)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// parseClock parses an HH:MM time of day into minutes, or -1 when empty
+func parseClock(s string) (int, error) {
+	if s == "" {
+		return -1, nil
+	}
+	t, err := time.Parse(scheduleClock, s)
+	if err != nil {
+		return 0, fmt.Errorf("time of day %q is not HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parseSchedule parses s, returning nil for no schedule
+func parseSchedule(s *Schedule) (*window, error) {
+	if s == nil {
+		return nil, nil
+	}
+	w := &window{}
+	var err error
+	for _, bound := range []struct {
+		value string
+		t     *time.Time
+	}{{s.Start, &w.start}, {s.End, &w.end}} {
+		if bound.value == "" {
+			continue
+		}
+		if *bound.t, err = time.Parse(scheduleDateTime, bound.value); err != nil {
+			return nil, fmt.Errorf("time %q is not %s", bound.value, scheduleDateTime)
+		}
+	}
+	if !w.start.IsZero() && !w.end.IsZero() && !w.end.After(w.start) {
+		return nil, errors.New("end must be after start")
+	}
+	for _, name := range s.Days {
+		day, ok := parseWeekday(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown day %q", name)
+		}
+		w.days |= 1 << day
+	}
+	if w.from, err = parseClock(s.From); err != nil {
+		return nil, err
+	}
+	if w.to, err = parseClock(s.To); err != nil {
+		return nil, err
+	}
+	if (w.from < 0) != (w.to < 0) {
+		return nil, errors.New("from and to must be set together")
+	}
+	return w, nil
+}
+
+// contains reports whether the window includes now, seen in loc. A nil
+// window includes every time.
+func (w *window) contains(now time.Time, loc *time.Location) bool {
+	if w == nil {
+		return true
+	}
+	local := now.In(loc)
+	wall := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute(), local.Second(), local.Nanosecond(), time.UTC)
+	if (!w.start.IsZero() && wall.Before(w.start)) || (!w.end.IsZero() && !wall.Before(w.end)) {
+		return false
+	}
+	day := wall.Weekday()
+	if w.from >= 0 {
+		minute := wall.Hour()*60 + wall.Minute()
+		switch {
+		case w.from <= w.to && (minute < w.from || minute >= w.to):
+			return false
+		case w.from > w.to && minute < w.from && minute >= w.to:
+			return false
+		case w.from > w.to && minute < w.to:
+			day = (day + 6) % 7 // the window began the day before
+		}
+	}
+	return w.days == 0 || w.days&(1<<day) != 0
+}
+
+// inSchedule reports whether the rule's Schedule includes the current time.
+// The caller must hold r.mu.
+func (r *Router) inSchedule(rule Rule) bool {
+	if rule.window == nil {
+		return true
+	}
+	now := time.Now
+	if r.now != nil {
+		now = r.now
+	}
+	loc := r.location
+	if loc == nil {
+		loc = time.Local
+	}
+	return rule.window.contains(now(), loc)
+}
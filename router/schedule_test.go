@@ -0,0 +1,89 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScheduleContains(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	weekly := &Schedule{Days: []string{"sat"}, From: "23:00", To: "02:00"}
+	oneOff := &Schedule{Start: "2024-06-01T10:00", End: "2024-06-01T12:00"}
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		loc      *time.Location
+		at       string // UTC; Berlin is two hours ahead in June
+		want     bool
+	}{
+		{"before the weekly window", weekly, berlin, "2024-06-01T20:30", false},
+		{"in the weekly window", weekly, berlin, "2024-06-01T21:30", true},
+		{"past midnight on the day after", weekly, berlin, "2024-06-01T23:30", true},
+		{"after the weekly window", weekly, berlin, "2024-06-02T00:30", false},
+		{"on another day", weekly, berlin, "2024-06-02T21:30", false},
+		{"past midnight in Berlin but not in UTC", weekly, time.UTC, "2024-06-01T22:30", false},
+		{"before a one-off window", oneOff, time.UTC, "2024-06-01T09:59", false},
+		{"at the start of a one-off window", oneOff, time.UTC, "2024-06-01T10:00", true},
+		{"at its end", oneOff, time.UTC, "2024-06-01T12:00", false},
+		{"one-off window in Berlin", oneOff, berlin, "2024-06-01T09:00", true},
+	}
+	for _, tt := range tests {
+		w, err := parseSchedule(tt.schedule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		at, _ := time.Parse(scheduleDateTime, tt.at)
+		if got := w.contains(at, tt.loc); got != tt.want {
+			t.Errorf("%s: contains(%s) = %v, want %v", tt.name, tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestScheduledRouting(t *testing.T) {
+	api := newBackend(t, "api")
+	maintenance := newBackend(t, "maintenance")
+	router := newTestRouter(t, &RouterConfig{
+		TimeZone: "UTC",
+		Rules: []Rule{
+			{Service: "api", Destination: maintenance.URL, Schedule: &Schedule{Days: []string{"sun"}, From: "02:00", To: "04:00"}},
+			{Service: "api", Destination: api.URL},
+		},
+	})
+	var now time.Time
+	router.now = func() time.Time { return now }
+	tests := []struct {
+		at, want string
+	}{
+		{"2024-06-02T01:59", "api"},
+		{"2024-06-02T02:00", "maintenance"},
+		{"2024-06-02T03:30", "maintenance"},
+		{"2024-06-02T04:00", "api"},
+		{"2024-06-08T02:30", "api"},
+	}
+	for _, tt := range tests {
+		now, _ = time.Parse(scheduleDateTime, tt.at)
+		if rec, body := serve(router, serviceRequest("api", "")); rec.Code != http.StatusOK || body != tt.want {
+			t.Errorf("at %s = %d %q, want 200 from %s", tt.at, rec.Code, body, tt.want)
+		}
+	}
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	tests := map[string]*Schedule{
+		"is not":               {Start: "tomorrow"},
+		"end must be after":    {Start: "2024-06-01T12:00", End: "2024-06-01T10:00"},
+		"unknown day":          {Days: []string{"someday"}},
+		"is not HH:MM":         {From: "2am", To: "04:00"},
+		"must be set together": {From: "02:00"},
+	}
+	for want, schedule := range tests {
+		if _, err := parseSchedule(schedule); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseSchedule(%+v) err = %v, want %q", schedule, err, want)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Session represents an established network session. DestinationIP and
+// DestinationPort are the address actually connected to, with DNS names
+// resolved; Destination is the configured destination they belong to.
+type Session struct {
+	DateTimeStamp   time.Time `json:"DateTimeStamp"`
+	SourceIP        string    `json:"sourceIP"`
+	RequestService  string    `json:"requestService"`
+	SourcePort      string    `json:"sourcePort"`
+	Destination     string    `json:"destination,omitempty"`
+	DestinationIP   string    `json:"DestinationIP"`
+	DestinationPort string    `json:"DestinationPort"`
+}
+
+// destination returns the configured destination of the session. Sessions
+// saved before Destination was recorded kept it in DestinationIP.
+func (s *Session) destination() string {
+	if s.Destination != "" {
+		return s.Destination
+	}
+	return s.DestinationIP
+}
+
+// Key returns the key the session is stored under, sourceIP:sourcePort with
+// IPv6 addresses in brackets so the port stays unambiguous. UDP flows are
+// keyed apart from HTTP clients, under udpSessionKey.
+func (s *Session) Key() string {
+	if sessionProtocol(s.RequestService) == "udp" {
+		return udpSessionPrefix + sessionKey(s.SourceIP, s.SourcePort)
+	}
+	return sessionKey(s.SourceIP, s.SourcePort)
+}
+
+// sessionKey returns the key of the session of a client at ip and port
+func sessionKey(ip, port string) string {
+	return net.JoinHostPort(ip, port)
+}
+
+// splitRemoteAddr splits a request's RemoteAddr into the client IP and port
+// that identify its session, removing the brackets around IPv6 addresses.
+// An address without a port is returned as the IP with an empty port.
+func splitRemoteAddr(remoteAddr string) (ip, port string) {
+	ip, port, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return strings.TrimSuffix(strings.TrimPrefix(remoteAddr, "["), "]"), ""
+	}
+	return ip, port
+}
+
+// ErrCorruptSessionFile is wrapped by the error LoadSessionsFromFile returns for a
+// session file that cannot be parsed, so callers can tell it from a failed read
+var ErrCorruptSessionFile = errors.New("corrupt session file")
+
+// DefaultSessionTTL is how long a session may be inactive before it is removed
+const DefaultSessionTTL = 30 * time.Second
+
+// DefaultCleanupInterval is how often expired sessions are swept
+const DefaultCleanupInterval = 30 * time.Second
+
+// SessionManager manages established sessions
+type SessionManager struct {
+	store  SessionStore
+	saveMu sync.Mutex  // serializes saves to the session file
+	dirty  atomic.Bool // sessions changed since the last save
+
+	// TTL is how long a session may be inactive before CleanupSessions removes it
+	TTL time.Duration
+	// CleanupInterval is how often the background sweep calls CleanupSessions
+	CleanupInterval time.Duration
+}
+
+// SessionOption configures a SessionManager created by NewSessionManager
+type SessionOption func(*SessionManager)
+
+// WithTTL expires sessions after ttl of inactivity instead of DefaultSessionTTL
+func WithTTL(ttl time.Duration) SessionOption {
+	return func(sm *SessionManager) { sm.TTL = ttl }
+}
+
+// WithCleanupInterval sweeps expired sessions every interval instead of
+// DefaultCleanupInterval
+func WithCleanupInterval(interval time.Duration) SessionOption {
+	return func(sm *SessionManager) { sm.CleanupInterval = interval }
+}
+
+// NewSessionManager creates a new SessionManager backed by store, with the
+// default TTL and cleanup interval unless opts set them. A nil store uses a
+// new MemoryStore.
+func NewSessionManager(store SessionStore, opts ...SessionOption) *SessionManager {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	sm := &SessionManager{
+		store:           store,
+		TTL:             DefaultSessionTTL,
+		CleanupInterval: DefaultCleanupInterval,
+	}
+	for _, opt := range opts {
+		opt(sm)
+	}
+	return sm
+}
+
+// NewSessionManagerWithTTL creates a new SessionManager backed by store whose
+// sessions expire after ttl of inactivity. A nil store uses a new MemoryStore.
+func NewSessionManagerWithTTL(store SessionStore, ttl time.Duration) *SessionManager {
+	return NewSessionManager(store, WithTTL(ttl))
+}
+
+// Store returns the SessionStore backing the manager
+func (sm *SessionManager) Store() SessionStore {
+	return sm.store
+}
+
+// updateGauge refreshes the active sessions metric from the store
+func (sm *SessionManager) updateGauge() {
+	if n, err := sm.store.Len(); err == nil {
+		activeSessions.Set(float64(n))
+	}
+}
+
+// AddOrUpdateSession adds a new session or updates an existing one
+func (sm *SessionManager) AddOrUpdateSession(s *Session) {
+	if err := sm.store.Put(s.Key(), s); err != nil {
+		slog.Error("storing session", "key", s.Key(), "error", err)
+		return
+	}
+	sm.dirty.Store(true)
+	sm.updateGauge()
+}
+
+// LookupSession returns the session stored under key
+func (sm *SessionManager) LookupSession(key string) (*Session, bool, error) {
+	return sm.store.Get(key)
+}
+
+// GetSession returns a copy of the session stored under key. Store errors
+// are logged and reported as a missing session.
+func (sm *SessionManager) GetSession(key string) (*Session, bool) {
+	session, ok, err := sm.store.Get(key)
+	if err != nil {
+		slog.Error("looking up session", "key", key, "error", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	c := *session
+	return &c, true
+}
+
+// Count returns the number of sessions, or 0 if the store cannot be read
+func (sm *SessionManager) Count() int {
+	n, err := sm.store.Len()
+	if err != nil {
+		slog.Error("counting sessions", "error", err)
+		return 0
+	}
+	return n
+}
+
+// Snapshot returns copies of all sessions, so callers can iterate over them
+// without holding any lock or racing with updates
+func (sm *SessionManager) Snapshot() []*Session {
+	var sessions []*Session
+	err := sm.store.Range(func(key string, session *Session) bool {
+		c := *session
+		sessions = append(sessions, &c)
+		return true
+	})
+	if err != nil {
+		slog.Error("reading sessions", "error", err)
+	}
+	return sessions
+}
+
+// ListSessions returns up to limit sessions ordered by key, skipping the
+// first offset, along with the total number of sessions
+func (sm *SessionManager) ListSessions(offset, limit int) ([]*Session, int, error) {
+	var keys []string
+	sessions := make(map[string]*Session)
+	err := sm.store.Range(func(key string, session *Session) bool {
+		keys = append(keys, key)
+		sessions[key] = session
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Strings(keys)
+	page := make([]*Session, 0, min(limit, len(keys)))
+	for i := offset; i < len(keys) && len(page) < limit; i++ {
+		page = append(page, sessions[keys[i]])
+	}
+	return page, len(keys), nil
+}
+
+// EvictSession removes the session stored under key, reporting whether it existed
+func (sm *SessionManager) EvictSession(key string) (bool, error) {
+	if _, ok, err := sm.store.Get(key); err != nil || !ok {
+		return false, err
+	}
+	if err := sm.store.Delete(key); err != nil {
+		return false, err
+	}
+	sm.dirty.Store(true)
+	sm.updateGauge()
+	return true, nil
+}
+
+// CleanupSessions removes sessions that have been inactive for longer than the TTL
+func (sm *SessionManager) CleanupSessions() {
+	removed, err := sm.store.ExpireOlderThan(time.Now().Add(-sm.TTL))
+	if err != nil {
+		slog.Error("expiring sessions", "error", err)
+	}
+	if removed > 0 {
+		sm.dirty.Store(true)
+	}
+	sm.updateGauge()
+}
+
+// StartCleanup calls CleanupSessions every interval until ctx is canceled.
+// The returned channel is closed once the loop has exited.
+func (sm *SessionManager) StartCleanup(ctx context.Context, interval time.Duration) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sm.CleanupSessions()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// SaveSessionsToFile saves the current sessions to a file
+func (sm *SessionManager) SaveSessionsToFile(filename string) error {
+	sm.saveMu.Lock()
+	defer sm.saveMu.Unlock()
+	sm.dirty.Store(false)
+	sessions := make([]*Session, 0)
+	err := sm.store.Range(func(key string, session *Session) bool {
+		sessions = append(sessions, session)
+		return true
+	})
+	if err == nil {
+		var data []byte
+		if data, err = json.Marshal(sessions); err == nil {
+			err = writeFileAtomic(filename, data, 0644)
+		}
+	}
+	if err != nil {
+		sm.dirty.Store(true)
+	}
+	return err
+}
+
+// writeFileAtomic writes data to a temporary file in the same directory as
+// filename, syncs it, and renames it into place, so readers and crashes never
+// observe a partially written file
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// FlushSessions saves the sessions to a file only if they changed since the last save
+func (sm *SessionManager) FlushSessions(filename string) error {
+	if !sm.dirty.Load() {
+		return nil
+	}
+	return sm.SaveSessionsToFile(filename)
+}
+
+// StartAutoSave flushes changed sessions to a file every interval in the
+// background. The returned stop function halts the loop and performs a final
+// flush so that no sessions are lost on shutdown.
+func (sm *SessionManager) StartAutoSave(filename string, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := sm.FlushSessions(filename); err != nil {
+					slog.Error("saving sessions", "file", filename, "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-finished
+			if err := sm.FlushSessions(filename); err != nil {
+				slog.Error("saving sessions", "file", filename, "error", err)
+			}
+		})
+	}
+}
+
+// LoadSessionsFromFile loads sessions from a file, skipping those that
+// have already been inactive for longer than the TTL. A missing or empty
+// file is a clean start; a file that cannot be parsed or holds a null
+// session returns an error wrapping ErrCorruptSessionFile.
+func (sm *SessionManager) LoadSessionsFromFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	var sessions []*Session
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return fmt.Errorf("%s: %w: %v", filename, ErrCorruptSessionFile, err)
+	}
+	for i, session := range sessions {
+		if session == nil {
+			return fmt.Errorf("%s: %w: session %d is null", filename, ErrCorruptSessionFile, i)
+		}
+	}
+	cutoff := time.Now().Add(-sm.TTL)
+	skipped := 0
+	for _, session := range sessions {
+		if session.DateTimeStamp.Before(cutoff) {
+			skipped++
+			continue
+		}
+		if err := sm.store.Put(session.Key(), session); err != nil {
+			return err
+		}
+	}
+	if skipped > 0 {
+		slog.Info("skipped expired sessions", "file", filename, "count", skipped)
+		sm.dirty.Store(true)
+	}
+	sm.updateGauge()
+	return nil
+}
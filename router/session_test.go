@@ -0,0 +1,364 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadSessionsFromFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		t.Helper()
+		filename := filepath.Join(dir, name)
+		if err := os.WriteFile(filename, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	tests := []struct {
+		name     string
+		filename string
+		corrupt  bool
+		sessions int
+	}{
+		{name: "missing", filename: filepath.Join(dir, "missing.json")},
+		{name: "empty", filename: write("empty.json", "")},
+		{name: "whitespace", filename: write("blank.json", " \n")},
+		{name: "corrupt", filename: write("corrupt.json", `[{"sourceIP":`), corrupt: true},
+		{name: "null session", filename: write("null.json", `[null]`), corrupt: true},
+		{name: "null after a session", filename: write("valid-null.json", `[{"DateTimeStamp":"`+time.Now().Format(time.RFC3339)+`","sourceIP":"192.0.2.1","sourcePort":"1234"}, null]`), corrupt: true},
+		{name: "valid", filename: write("valid.json", `[{"DateTimeStamp":"`+time.Now().Format(time.RFC3339)+`","sourceIP":"192.0.2.1","sourcePort":"1234"}]`), sessions: 1},
+		{name: "expired", filename: write("expired.json", `[{"DateTimeStamp":"2000-01-01T00:00:00Z","sourceIP":"192.0.2.1","sourcePort":"1234"}]`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := NewSessionManager(nil)
+			err := sm.LoadSessionsFromFile(tt.filename)
+			if tt.corrupt {
+				if !errors.Is(err, ErrCorruptSessionFile) {
+					t.Fatalf("err = %v, want ErrCorruptSessionFile", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sm.Count(); got != tt.sessions {
+				t.Errorf("loaded %d sessions, want %d", got, tt.sessions)
+			}
+		})
+	}
+}
+
+func TestLoadSessionsSkipsExpired(t *testing.T) {
+	now := time.Now()
+	saved := []*Session{
+		{DateTimeStamp: now.Add(-time.Second), SourceIP: "192.0.2.1", SourcePort: "1"},
+		{DateTimeStamp: now.Add(-2 * time.Hour), SourceIP: "192.0.2.2", SourcePort: "2"},
+		{DateTimeStamp: now.Add(-50 * time.Minute), SourceIP: "192.0.2.3", SourcePort: "3"},
+		{DateTimeStamp: now.Add(-61 * time.Minute), SourceIP: "192.0.2.4", SourcePort: "4"},
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "sessions.json")
+	if err := os.WriteFile(filename, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := NewSessionManager(nil, WithTTL(time.Hour))
+	if err := sm.LoadSessionsFromFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, s := range sm.Snapshot() {
+		keys = append(keys, s.Key())
+	}
+	slices.Sort(keys)
+	if want := []string{"192.0.2.1:1", "192.0.2.3:3"}; !slices.Equal(keys, want) {
+		t.Errorf("loaded %q, want only the fresh %q", keys, want)
+	}
+	if !sm.dirty.Load() {
+		t.Error("skipping expired sessions did not mark the file for rewriting")
+	}
+}
+
+func TestLoadSessionsFromUnreadableFile(t *testing.T) {
+	// A directory cannot be read as a file; that is not a corrupt file.
+	err := NewSessionManager(nil).LoadSessionsFromFile(t.TempDir())
+	if err == nil || errors.Is(err, ErrCorruptSessionFile) || errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("err = %v, want a read error", err)
+	}
+}
+
+func TestSaveAndLoadSessions(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "sessions.json")
+	saved := NewSessionManager(nil)
+	saved.AddOrUpdateSession(&Session{DateTimeStamp: time.Now(), SourceIP: "2001:db8::1", SourcePort: "443", Destination: "http://a:1"})
+	if err := saved.SaveSessionsToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	loaded := NewSessionManager(nil)
+	if err := loaded.LoadSessionsFromFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	session, ok := loaded.GetSession("[2001:db8::1]:443")
+	if !ok || session.destination() != "http://a:1" {
+		t.Errorf("loaded session = %+v, %v", session, ok)
+	}
+}
+
+func TestCleanupSessionsAtTTL(t *testing.T) {
+	sm := NewSessionManager(nil, WithTTL(5*time.Minute), WithCleanupInterval(30*time.Second))
+	if sm.TTL != 5*time.Minute || sm.CleanupInterval != 30*time.Second {
+		t.Fatalf("TTL, interval = %v, %v", sm.TTL, sm.CleanupInterval)
+	}
+	now := time.Now()
+	ages := map[string]time.Duration{
+		"1": 0,
+		"2": 4*time.Minute + 59*time.Second,
+		"3": 5*time.Minute + time.Second,
+		"4": time.Hour,
+	}
+	for port, age := range ages {
+		sm.AddOrUpdateSession(&Session{DateTimeStamp: now.Add(-age), SourceIP: "192.0.2.1", SourcePort: port})
+	}
+	sm.CleanupSessions()
+	for port, age := range ages {
+		_, ok := sm.GetSession(sessionKey("192.0.2.1", port))
+		if want := age < sm.TTL; ok != want {
+			t.Errorf("session inactive for %v kept = %v, want %v", age, ok, want)
+		}
+	}
+}
+
+func TestSessionDefaults(t *testing.T) {
+	sm := NewSessionManager(nil)
+	if sm.TTL != DefaultSessionTTL || sm.CleanupInterval != DefaultCleanupInterval {
+		t.Errorf("TTL, interval = %v, %v, want the defaults", sm.TTL, sm.CleanupInterval)
+	}
+	if sm := NewSessionManagerWithTTL(nil, time.Minute); sm.TTL != time.Minute || sm.CleanupInterval != DefaultCleanupInterval {
+		t.Errorf("NewSessionManagerWithTTL TTL, interval = %v, %v", sm.TTL, sm.CleanupInterval)
+	}
+}
+
+func TestStartCleanup(t *testing.T) {
+	sm := NewSessionManager(nil, WithTTL(20*time.Millisecond))
+	sm.AddOrUpdateSession(&Session{DateTimeStamp: time.Now(), SourceIP: "192.0.2.1", SourcePort: "1"})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := sm.StartCleanup(ctx, 5*time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for sm.Count() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if n := sm.Count(); n != 0 {
+		t.Errorf("%d sessions left after the TTL", n)
+	}
+}
+
+func TestStartCleanupStopsOnCancel(t *testing.T) {
+	sm := NewSessionManager(nil, WithTTL(time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := sm.StartCleanup(ctx, time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cleanup loop still running a second after its context was canceled")
+	}
+	// With the loop gone nothing sweeps this expired session.
+	sm.AddOrUpdateSession(&Session{DateTimeStamp: time.Now().Add(-time.Minute), SourceIP: "192.0.2.1", SourcePort: "1"})
+	time.Sleep(20 * time.Millisecond)
+	if n := sm.Count(); n != 1 {
+		t.Errorf("%d sessions after the loop stopped, want 1", n)
+	}
+}
+
+func TestSaveSessionsAtomically(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "sessions.json")
+	sm := NewSessionManager(nil)
+	for i := 0; i < 200; i++ {
+		sm.AddOrUpdateSession(&Session{DateTimeStamp: time.Now(), SourceIP: "192.0.2.1", SourcePort: strconv.Itoa(i), Destination: "http://a:1"})
+	}
+	data, err := json.Marshal(sm.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writing in place, as saves used to, leaves a truncated file behind
+	// when the process dies mid-write.
+	if err := os.WriteFile(filename, data[:len(data)/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewSessionManager(nil).LoadSessionsFromFile(filename); !errors.Is(err, ErrCorruptSessionFile) {
+		t.Fatalf("loading a truncated file: err = %v", err)
+	}
+
+	// Readers racing the saves only ever see a whole file. The first save
+	// replaces the truncated file before they start.
+	if err := sm.SaveSessionsToFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if !json.Valid(data) {
+				t.Errorf("read %d bytes of invalid JSON", len(data))
+				return
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if err := sm.SaveSessionsToFile(filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+	loaded := NewSessionManager(nil)
+	if err := loaded.LoadSessionsFromFile(filename); err != nil || loaded.Count() != 200 {
+		t.Errorf("loaded %d sessions, err %v", loaded.Count(), err)
+	}
+}
+
+func TestSaveSessionsFailureKeepsFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "sessions.json")
+	if err := os.WriteFile(filename, []byte("[]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sm := NewSessionManager(nil)
+	sm.AddOrUpdateSession(&Session{DateTimeStamp: time.Now(), SourceIP: "192.0.2.1", SourcePort: "1"})
+	// The temporary file cannot be created next to a file in a missing dir.
+	if err := sm.SaveSessionsToFile(filepath.Join(dir, "missing", "sessions.json")); err == nil {
+		t.Fatal("saving into a missing directory succeeded")
+	}
+	if err := sm.FlushSessions(filename); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filename); !json.Valid(data) || string(data) == "[]" {
+		t.Errorf("a failed save was not retried by the next flush: %s", data)
+	}
+}
+
+func TestSessionKeyFromRemoteAddr(t *testing.T) {
+	backend := newBackend(t, "a")
+	tests := []struct {
+		remoteAddr    string
+		key, ip, port string
+	}{
+		{remoteAddr: "192.0.2.1:1234", key: "192.0.2.1:1234", ip: "192.0.2.1", port: "1234"},
+		{remoteAddr: "[2001:db8::1]:443", key: "[2001:db8::1]:443", ip: "2001:db8::1", port: "443"},
+		{remoteAddr: "192.0.2.1", key: "192.0.2.1:", ip: "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			sessions := NewSessionManager(nil)
+			router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL}}}, WithSessions(sessions))
+			serve(router, serviceRequest("api", tt.remoteAddr))
+			session, ok := sessions.GetSession(tt.key)
+			if !ok {
+				t.Fatalf("no session under %q; sessions = %v", tt.key, sessions.Snapshot())
+			}
+			if session.SourceIP != tt.ip || session.SourcePort != tt.port {
+				t.Errorf("source = %q, %q, want %q, %q", session.SourceIP, session.SourcePort, tt.ip, tt.port)
+			}
+		})
+	}
+}
+
+func TestSessionsPerSourcePort(t *testing.T) {
+	backend := newBackend(t, "a")
+	sessions := NewSessionManager(nil)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL}}}, WithSessions(sessions))
+	serve(router, serviceRequest("api", "192.0.2.1:1000"))
+	serve(router, serviceRequest("api", "192.0.2.1:2000"))
+	if n := sessions.Count(); n != 2 {
+		t.Errorf("two ports of one client made %d sessions, want 2", n)
+	}
+}
+
+func TestSplitRemoteAddr(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		ip, port   string
+	}{
+		{"192.0.2.1:5555", "192.0.2.1", "5555"},
+		{"[2001:db8::1]:5555", "2001:db8::1", "5555"},
+		{"[::ffff:192.0.2.1]:5555", "::ffff:192.0.2.1", "5555"},
+		{"192.0.2.1", "192.0.2.1", ""},
+		{"[2001:db8::1]", "2001:db8::1", ""},
+	}
+	for _, tt := range tests {
+		if ip, port := splitRemoteAddr(tt.remoteAddr); ip != tt.ip || port != tt.port {
+			t.Errorf("splitRemoteAddr(%q) = %q, %q, want %q, %q", tt.remoteAddr, ip, port, tt.ip, tt.port)
+		}
+	}
+}
+
+// TestSessionReadsConcurrentWithWrites is meant for go test -race
+func TestSessionReadsConcurrentWithWrites(t *testing.T) {
+	sm := NewSessionManager(nil)
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				sm.AddOrUpdateSession(&Session{DateTimeStamp: time.Now(), SourceIP: "192.0.2.1", SourcePort: strconv.Itoa(i)})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				sm.GetSession("192.0.2.1:" + strconv.Itoa(i))
+				sm.Count()
+				for _, s := range sm.Snapshot() {
+					s.Destination = "mutated copy"
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n := sm.Count(); n != 200 {
+		t.Errorf("Count = %d, want 200", n)
+	}
+	for _, s := range sm.Snapshot() {
+		if s.Destination != "" {
+			t.Fatalf("mutating a snapshot changed the stored session %s", s.Key())
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package router
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+)
+
+// Settings are the process-level options of the router binary
+type Settings struct {
+	ConfigFile   string
+	Listen       string // comma-separated TCP addresses and unix:/path sockets
+	AdminListen  string
+	SessionsFile string
+	SessionStore string
+
+	// TLSCert and TLSKey enable HTTPS on Listen; RedirectListen, if set,
+	// serves plain HTTP redirects to it
+	TLSCert        string
+	TLSKey         string
+	RedirectListen string
+
+	// AdminClientCA, if set, serves the admin API over TLS with the same
+	// certificate and requires client certificates signed by this CA bundle
+	AdminClientCA string
+
+	// HTTP2 also accepts plaintext HTTP/2 (h2c) on Listen, as used by gRPC
+	// clients; over TLS, HTTP/2 is always offered
+	HTTP2 bool
+
+	// ProxyProtocol reads a PROXY protocol v1 or v2 header from connections
+	// to Listen, taking the client address relayed by an L4 load balancer
+	ProxyProtocol bool
+
+	// UDPListen, if set, forwards the datagrams received on it by the
+	// config's UDP routes
+	UDPListen string
+
+	// GeoIPDB is a MaxMind country or city database used to route by the
+	// rules' GeoDestinations
+	GeoIPDB string
+
+	// OTLPEndpoint, if set, is the OTLP/HTTP collector URL request traces
+	// are exported to
+	OTLPEndpoint string
+
+	// LogFile, if set, writes the router's logs to this file instead of
+	// stdout. AccessLogDir, if set, writes the access logs of each service
+	// to a file of its own in this directory instead. Both are rotated by
+	// LogRotation.
+	LogFile      string
+	AccessLogDir string
+	LogRotation  LogRotation
+
+	// StrictConfig rejects config files with fields the router does not
+	// know, such as misspelled keys, instead of ignoring them
+	StrictConfig bool
+
+	// Validate checks ConfigFile and exits instead of starting the server
+	Validate bool
+}
+
+// DefaultSettings are used for anything not set by a flag or environment variable
+var DefaultSettings = Settings{
+	ConfigFile:   "go-router.json",
+	Listen:       ":8080",
+	AdminListen:  ":8081",
+	SessionsFile: "go-sessions.json",
+	SessionStore: "memory",
+	LogRotation:  LogRotation{MaxMB: 100, MaxBackups: 5},
+}
+
+// resolveSetting picks a value with flag > environment > default precedence
+func resolveSetting(flagValue string, flagSet bool, envValue, defaultValue string) string {
+	if flagSet {
+		return flagValue
+	}
+	if envValue != "" {
+		return envValue
+	}
+	return defaultValue
+}
+
+// ParseSettings reads Settings from command-line args, falling back to the
+// ROUTER_* environment variables looked up through getenv and then to
+// DefaultSettings
+func ParseSettings(args []string, getenv func(string) string) (Settings, error) {
+	fs := flag.NewFlagSet("go-router", flag.ContinueOnError)
+	configFile := fs.String("config", "", "routing config file, JSON or YAML (env ROUTER_CONFIG)")
+	listen := fs.String("listen", "", "comma-separated addresses to serve routed traffic on, unix:/path for a Unix socket (env ROUTER_LISTEN)")
+	adminListen := fs.String("admin-listen", "", "address to serve the admin API on (env ROUTER_ADMIN_LISTEN)")
+	sessionsFile := fs.String("sessions-file", "", "file sessions are persisted to (env ROUTER_SESSIONS_FILE)")
+	sessionStore := fs.String("session-store", "", "session store: memory, a redis:// URL or sqlite:<path> (env ROUTER_SESSION_STORE)")
+	tlsCert := fs.String("tls-cert", "", "TLS certificate file; enables HTTPS (env ROUTER_TLS_CERT)")
+	tlsKey := fs.String("tls-key", "", "TLS private key file (env ROUTER_TLS_KEY)")
+	redirectListen := fs.String("redirect-listen", "", "address to redirect plain HTTP to HTTPS from (env ROUTER_REDIRECT_LISTEN)")
+	adminClientCA := fs.String("admin-client-ca", "", "CA bundle admin API clients must present a certificate from (env ROUTER_ADMIN_CLIENT_CA)")
+	udpListen := fs.String("udp-listen", "", "UDP address to forward datagrams from by the config's udpRoutes (env ROUTER_UDP_LISTEN)")
+	geoIPDB := fs.String("geoip-db", "", "MaxMind .mmdb database for rules' geoDestinations (env ROUTER_GEOIP_DB)")
+	otlpEndpoint := fs.String("otlp-endpoint", "", "OTLP/HTTP collector URL to export traces to (env ROUTER_OTLP_ENDPOINT)")
+	http2 := fs.Bool("http2", false, "also accept plaintext HTTP/2 (h2c), as gRPC clients use (env ROUTER_HTTP2)")
+	proxyProtocol := fs.Bool("proxy-protocol", false, "read the client address from PROXY protocol headers on -listen (env ROUTER_PROXY_PROTOCOL)")
+	logFile := fs.String("log-file", "", "file to write logs to instead of stdout, rotated by size (env ROUTER_LOG_FILE)")
+	logMaxMB := fs.Int("log-max-mb", DefaultSettings.LogRotation.MaxMB, "size in MB log files are rotated at (env ROUTER_LOG_MAX_MB)")
+	logMaxBackups := fs.Int("log-max-backups", DefaultSettings.LogRotation.MaxBackups, "rotated log files to keep, 0 for all (env ROUTER_LOG_MAX_BACKUPS)")
+	logMaxAge := fs.Int("log-max-age-days", DefaultSettings.LogRotation.MaxAgeDays, "days to keep rotated log files, 0 for no limit (env ROUTER_LOG_MAX_AGE_DAYS)")
+	accessLogDir := fs.String("access-log-dir", "", "directory to write each service's access log to, rotated by size (env ROUTER_ACCESS_LOG_DIR)")
+	strictConfig := fs.Bool("strict-config", false, "reject unknown fields in config files (env ROUTER_STRICT_CONFIG)")
+	validate := fs.Bool("validate", false, "validate the config file, print any problems and exit")
+	if err := fs.Parse(args); err != nil {
+		return Settings{}, err
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	settings := Settings{
+		ConfigFile:     resolveSetting(*configFile, set["config"], getenv("ROUTER_CONFIG"), DefaultSettings.ConfigFile),
+		Listen:         resolveSetting(*listen, set["listen"], getenv("ROUTER_LISTEN"), DefaultSettings.Listen),
+		AdminListen:    resolveSetting(*adminListen, set["admin-listen"], getenv("ROUTER_ADMIN_LISTEN"), DefaultSettings.AdminListen),
+		SessionsFile:   resolveSetting(*sessionsFile, set["sessions-file"], getenv("ROUTER_SESSIONS_FILE"), DefaultSettings.SessionsFile),
+		SessionStore:   resolveSetting(*sessionStore, set["session-store"], getenv("ROUTER_SESSION_STORE"), DefaultSettings.SessionStore),
+		TLSCert:        resolveSetting(*tlsCert, set["tls-cert"], getenv("ROUTER_TLS_CERT"), DefaultSettings.TLSCert),
+		TLSKey:         resolveSetting(*tlsKey, set["tls-key"], getenv("ROUTER_TLS_KEY"), DefaultSettings.TLSKey),
+		RedirectListen: resolveSetting(*redirectListen, set["redirect-listen"], getenv("ROUTER_REDIRECT_LISTEN"), DefaultSettings.RedirectListen),
+		AdminClientCA:  resolveSetting(*adminClientCA, set["admin-client-ca"], getenv("ROUTER_ADMIN_CLIENT_CA"), DefaultSettings.AdminClientCA),
+		UDPListen:      resolveSetting(*udpListen, set["udp-listen"], getenv("ROUTER_UDP_LISTEN"), DefaultSettings.UDPListen),
+		GeoIPDB:        resolveSetting(*geoIPDB, set["geoip-db"], getenv("ROUTER_GEOIP_DB"), DefaultSettings.GeoIPDB),
+		OTLPEndpoint:   resolveSetting(*otlpEndpoint, set["otlp-endpoint"], getenv("ROUTER_OTLP_ENDPOINT"), DefaultSettings.OTLPEndpoint),
+		LogFile:        resolveSetting(*logFile, set["log-file"], getenv("ROUTER_LOG_FILE"), DefaultSettings.LogFile),
+		AccessLogDir:   resolveSetting(*accessLogDir, set["access-log-dir"], getenv("ROUTER_ACCESS_LOG_DIR"), DefaultSettings.AccessLogDir),
+	}
+	// Errors are reported like flag reports its own parse errors.
+	fail := func(err error) (Settings, error) {
+		fmt.Fprintln(fs.Output(), err)
+		fs.Usage()
+		return Settings{}, err
+	}
+	settings.HTTP2 = *http2
+	settings.ProxyProtocol = *proxyProtocol
+	settings.StrictConfig = *strictConfig
+	settings.Validate = *validate
+	settings.LogRotation = LogRotation{MaxMB: *logMaxMB, MaxBackups: *logMaxBackups, MaxAgeDays: *logMaxAge}
+	for _, limit := range []struct {
+		flag, env string
+		value     *int
+	}{
+		{"log-max-mb", "ROUTER_LOG_MAX_MB", &settings.LogRotation.MaxMB},
+		{"log-max-backups", "ROUTER_LOG_MAX_BACKUPS", &settings.LogRotation.MaxBackups},
+		{"log-max-age-days", "ROUTER_LOG_MAX_AGE_DAYS", &settings.LogRotation.MaxAgeDays},
+	} {
+		if value := getenv(limit.env); value != "" && !set[limit.flag] {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fail(fmt.Errorf("invalid %s %q", limit.env, value))
+			}
+			*limit.value = n
+		}
+	}
+	for _, toggle := range []struct {
+		flag, env string
+		value     *bool
+	}{
+		{"http2", "ROUTER_HTTP2", &settings.HTTP2},
+		{"strict-config", "ROUTER_STRICT_CONFIG", &settings.StrictConfig},
+		{"proxy-protocol", "ROUTER_PROXY_PROTOCOL", &settings.ProxyProtocol},
+	} {
+		if value := getenv(toggle.env); value != "" && !set[toggle.flag] {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return fail(fmt.Errorf("invalid %s %q", toggle.env, value))
+			}
+			*toggle.value = enabled
+		}
+	}
+	switch {
+	case settings.LogRotation.MaxMB <= 0:
+		return fail(errors.New("-log-max-mb must be positive"))
+	case settings.LogRotation.MaxBackups < 0 || settings.LogRotation.MaxAgeDays < 0:
+		return fail(errors.New("-log-max-backups and -log-max-age-days must not be negative"))
+	case (settings.TLSCert == "") != (settings.TLSKey == ""):
+		return fail(errors.New("-tls-cert and -tls-key must be set together"))
+	case settings.RedirectListen != "" && settings.TLSCert == "":
+		return fail(errors.New("-redirect-listen requires -tls-cert and -tls-key"))
+	case settings.AdminClientCA != "" && settings.TLSCert == "":
+		return fail(errors.New("-admin-client-ca requires -tls-cert and -tls-key"))
+	}
+	return settings, nil
+}
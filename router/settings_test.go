@@ -0,0 +1,74 @@
+package router
+
+import "testing"
+
+func TestParseSettingsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		err  string
+	}{
+		{name: "bad log limit", env: map[string]string{"ROUTER_LOG_MAX_MB": "big"}, err: `invalid ROUTER_LOG_MAX_MB "big"`},
+		{name: "negative log limit", env: map[string]string{"ROUTER_LOG_MAX_BACKUPS": "-1"}, err: `invalid ROUTER_LOG_MAX_BACKUPS "-1"`},
+		{
+			// A valid toggle parsed after a bad limit must not clear its error.
+			name: "bad log limit then valid toggle",
+			env:  map[string]string{"ROUTER_LOG_MAX_AGE_DAYS": "x", "ROUTER_HTTP2": "true"},
+			err:  `invalid ROUTER_LOG_MAX_AGE_DAYS "x"`,
+		},
+		{name: "bad toggle", env: map[string]string{"ROUTER_HTTP2": "maybe"}, err: `invalid ROUTER_HTTP2 "maybe"`},
+		{name: "bad strict config", env: map[string]string{"ROUTER_STRICT_CONFIG": "2"}, err: `invalid ROUTER_STRICT_CONFIG "2"`},
+		{name: "zero log size", args: []string{"-log-max-mb", "0"}, err: "-log-max-mb must be positive"},
+		{name: "cert without key", args: []string{"-tls-cert", "c.pem"}, err: "-tls-cert and -tls-key must be set together"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parse(tt.args, tt.env)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestResolveSetting(t *testing.T) {
+	tests := []struct {
+		name      string
+		flagValue string
+		flagSet   bool
+		env       string
+		want      string
+	}{
+		{"default", "", false, "", "default"},
+		{"env over default", "", false, "env", "env"},
+		{"flag over env", "flag", true, "env", "flag"},
+		{"flag over default", "flag", true, "", "flag"},
+		{"flag set empty", "", true, "env", ""},
+		{"unset flag value ignored", "flag", false, "env", "env"},
+	}
+	for _, tt := range tests {
+		if got := resolveSetting(tt.flagValue, tt.flagSet, tt.env, "default"); got != tt.want {
+			t.Errorf("%s: resolveSetting = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseSettingsPrecedence(t *testing.T) {
+	env := map[string]string{"ROUTER_LISTEN": ":9000", "ROUTER_ADMIN_LISTEN": ":9001", "ROUTER_HTTP2": "true", "ROUTER_LOG_MAX_MB": "10"}
+	settings, err := parse([]string{"-listen", ":7000", "-http2=false"}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settings.Listen != ":7000" || settings.AdminListen != ":9001" || settings.ConfigFile != DefaultSettings.ConfigFile {
+		t.Errorf("listen, admin, config = %q, %q, %q", settings.Listen, settings.AdminListen, settings.ConfigFile)
+	}
+	if settings.HTTP2 || settings.LogRotation.MaxMB != 10 {
+		t.Errorf("http2, log max MB = %v, %d, want false, 10", settings.HTTP2, settings.LogRotation.MaxMB)
+	}
+}
+
+// parse parses args with env as the environment
+func parse(args []string, env map[string]string) (Settings, error) {
+	return ParseSettings(args, func(key string) string { return env[key] })
+}
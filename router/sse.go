@@ -0,0 +1,32 @@
+package router
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// eventStreamType is the media type of server-sent events
+const eventStreamType = "text/event-stream"
+
+// isEventStream reports whether header describes a stream of server-sent
+// events, which is relayed event by event: flushed as it arrives, and
+// never compressed or cached
+func isEventStream(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && mediaType == eventStreamType
+}
+
+// acceptsEventStream reports whether req asks for server-sent events, as
+// browsers' EventSource does
+func acceptsEventStream(req *http.Request) bool {
+	for _, field := range req.Header.Values("Accept") {
+		for _, part := range strings.Split(field, ",") {
+			mediaType, _, _ := strings.Cut(part, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), eventStreamType) {
+				return true
+			}
+		}
+	}
+	return false
+}
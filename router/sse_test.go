@@ -0,0 +1,95 @@
+package router
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStreamPassthrough(t *testing.T) {
+	next := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for i := 1; i <= 3; i++ {
+			select {
+			case <-next:
+			case <-req.Context().Done():
+				return
+			}
+			fmt.Fprintf(w, "id: %d\ndata: event %d\n\n", i, i)
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(backend.Close)
+	// Neither compression, the cache nor the total timeout may hold the
+	// stream back.
+	router := newTestRouter(t, &RouterConfig{
+		Compression: true,
+		Rules:       []Rule{{Service: "events", Destination: backend.URL, CacheTTLMS: 60000, TotalTimeoutMS: 50}},
+	})
+	front := httptest.NewServer(router)
+	t.Cleanup(front.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, front.URL, nil)
+	req.Header.Set("X-Service-Type", "events")
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Accept-Encoding", "gzip")
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	t.Cleanup(client.CloseIdleConnections)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("stream opened with %d, Content-Encoding %q, want 200 uncompressed", resp.StatusCode, resp.Header.Get("Content-Encoding"))
+	}
+
+	events := make(chan string)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var event []string
+		for scanner.Scan() {
+			if scanner.Text() != "" {
+				event = append(event, scanner.Text())
+				continue
+			}
+			events <- strings.Join(event, "|")
+			event = nil
+		}
+	}()
+	// Each event must arrive before the backend sends the next, after
+	// idling past the total timeout.
+	for i := 1; i <= 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+		next <- struct{}{}
+		select {
+		case event, ok := <-events:
+			if want := fmt.Sprintf("id: %d|data: event %d", i, i); !ok || event != want {
+				t.Fatalf("event %d = %q, want %q", i, event, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("event %d was held back by the router", i)
+		}
+	}
+	if _, ok := <-events; ok {
+		t.Error("stream went on after the backend's last event")
+	}
+
+	// The finished stream was not cached for the next client.
+	again, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again.Body.Close()
+	if cache := again.Header.Get("X-Cache"); cache != "MISS" {
+		t.Errorf("second stream X-Cache = %q, want MISS", cache)
+	}
+}
@@ -0,0 +1,135 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// trafficStats counts routed requests per service and forwarded requests per destination
+type trafficStats struct {
+	started      time.Time
+	services     sync.Map // rule key -> *atomic.Uint64
+	destinations sync.Map // destination -> *atomic.Uint64
+}
+
+// newTrafficStats returns stats whose uptime starts now
+func newTrafficStats() *trafficStats {
+	return &trafficStats{started: time.Now()}
+}
+
+// increment adds one to the counter stored under key in counters
+func increment(counters *sync.Map, key string) {
+	counter, _ := counters.LoadOrStore(key, new(atomic.Uint64))
+	counter.(*atomic.Uint64).Add(1)
+}
+
+// countService records a request routed to the rule with key; nil stats count nothing
+func (ts *trafficStats) countService(key string) {
+	if ts != nil {
+		increment(&ts.services, key)
+	}
+}
+
+// countDestination records a request forwarded to destination; nil stats count nothing
+func (ts *trafficStats) countDestination(destination string) {
+	if ts != nil {
+		increment(&ts.destinations, destination)
+	}
+}
+
+// counts copies the counters out of counters
+func counts(counters *sync.Map) map[string]uint64 {
+	out := make(map[string]uint64)
+	counters.Range(func(key, counter any) bool {
+		out[key.(string)] = counter.(*atomic.Uint64).Load()
+		return true
+	})
+	return out
+}
+
+// Stats summarizes the traffic the router has handled since it started
+type Stats struct {
+	Services          map[string]uint64 `json:"services"`
+	Destinations      map[string]uint64 `json:"destinations"`
+	InFlight          int64             `json:"inFlight"`
+	InFlightByService map[string]int64  `json:"inFlightByService"`
+	QueuedByService   map[string]int64  `json:"queuedByService"`   // requests waiting for a slot
+	Packets           map[string]uint64 `json:"packets,omitempty"` // per destination IP, with eBPF support only
+	RetryBudget       *RetryBudgetStats `json:"retryBudget,omitempty"`
+	ActiveSessions    int               `json:"activeSessions"`
+	UptimeSeconds     float64           `json:"uptimeSeconds"`
+}
+
+// Stats returns the current traffic summary, with active sessions taken from sessions
+func (r *Router) Stats(sessions *SessionManager) Stats {
+	stats := Stats{
+		Services:          map[string]uint64{},
+		Destinations:      map[string]uint64{},
+		InFlight:          r.inFlight.total.Load(),
+		InFlightByService: r.inFlightByService(),
+		QueuedByService:   r.queuedByService(),
+		RetryBudget:       r.budget.stats(),
+	}
+	if r.stats != nil {
+		stats.Services = counts(&r.stats.services)
+		stats.Destinations = counts(&r.stats.destinations)
+		stats.UptimeSeconds = time.Since(r.stats.started).Seconds()
+	}
+	if packets, err := r.packets.Counts(); err != nil {
+		r.logger().Error("reading packet counts", "error", err)
+	} else {
+		stats.Packets = packets
+	}
+	if sessions != nil {
+		stats.ActiveSessions = sessions.Count()
+	}
+	return stats
+}
+
+// writeText writes stats as aligned plain text, sorted by name
+func (stats Stats) writeText(w io.Writer) {
+	fmt.Fprintf(w, "uptime: %s\n", time.Duration(stats.UptimeSeconds*float64(time.Second)).Round(time.Second))
+	fmt.Fprintf(w, "active sessions: %d\n", stats.ActiveSessions)
+	fmt.Fprintf(w, "in flight: %d\n", stats.InFlight)
+	if b := stats.RetryBudget; b != nil {
+		fmt.Fprintf(w, "retry budget: %d available, %d retries, %d refused (ratio %g)\n", b.Available, b.Retries, b.Refused, b.Ratio)
+	}
+	writeSection(w, "requests by service", stats.Services)
+	writeSection(w, "requests by destination", stats.Destinations)
+	writeSection(w, "in flight by service", stats.InFlightByService)
+	writeSection(w, "queued by service", stats.QueuedByService)
+	if stats.Packets != nil {
+		writeSection(w, "packets by destination IP", stats.Packets)
+	}
+}
+
+// writeSection writes the counts under title, sorted by name
+func writeSection[N int64 | uint64](w io.Writer, title string, counts map[string]N) {
+	fmt.Fprintf(w, "\n%s:\n", title)
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-40s %d\n", name, counts[name])
+	}
+}
+
+// statsHandler serves GET /stats as plain text, or JSON with ?format=json
+func statsHandler(router *Router, sessions *SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		stats := router.Stats(sessions)
+		if req.URL.Query().Get("format") == "json" {
+			writeJSON(w, http.StatusOK, stats)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		stats.writeText(w)
+	}
+}
@@ -0,0 +1,63 @@
+package router
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStatsEndpoint(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	sessions := NewSessionManager(nil)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{
+		{Service: "api", Destinations: []string{a.URL, b.URL}},
+		{Service: "web", Destination: a.URL},
+	}}, WithSessions(sessions))
+	mux := adminMux(router, sessions, "", nil)
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	for i, service := range []string{"api", "api", "api", "api", "web", "missing"} {
+		serve(router, serviceRequest(service, "192.0.2.1:"+strconv.Itoa(1000+i)))
+	}
+
+	rec := get("/stats?format=json")
+	var stats Stats
+	if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]uint64{"api": 4, "web": 1}; !maps.Equal(stats.Services, want) {
+		t.Errorf("services = %v, want %v", stats.Services, want)
+	}
+	if want := map[string]uint64{a.URL: 3, b.URL: 2}; !maps.Equal(stats.Destinations, want) {
+		t.Errorf("destinations = %v, want %v", stats.Destinations, want)
+	}
+	if stats.ActiveSessions != 5 || stats.InFlight != 0 || stats.UptimeSeconds <= 0 {
+		t.Errorf("sessions, in flight, uptime = %d, %d, %v", stats.ActiveSessions, stats.InFlight, stats.UptimeSeconds)
+	}
+
+	// A client seen before adds no session.
+	serve(router, serviceRequest("web", "192.0.2.1:1000"))
+	rec = get("/stats")
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("Content-Type = %q, want plain text by default", got)
+	}
+	text := rec.Body.String()
+	for _, want := range []string{"active sessions: 5", "requests by service:", "web", "requests by destination:"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text stats missing %q:\n%s", want, text)
+		}
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "web" && fields[1] != "2" {
+			t.Errorf("web count line %q, want 2", line)
+		}
+	}
+}
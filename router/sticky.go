@@ -0,0 +1,110 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// hasDestination reports whether destination is one of the rule's
+// destinations; for a blue/green rule only the active color counts
+func (rule Rule) hasDestination(destination string) bool {
+	if rule.blueGreen() {
+		return destination == rule.activeDestination()
+	}
+	if slices.Contains(rule.pool(), destination) {
+		return true
+	}
+	for _, geo := range rule.GeoDestinations {
+		if geo == destination {
+			return true
+		}
+	}
+	return slices.ContainsFunc(rule.Weights, func(wd WeightedDestination) bool {
+		return wd.Address == destination
+	})
+}
+
+// pinnedDestination returns destination if it still belongs to rule and can
+// take traffic. A destination it returns has passed the circuit breaker,
+// possibly as its half-open probe, so the request must be sent there.
+func (r *Router) pinnedDestination(rule Rule, destination string) (string, bool) {
+	if destination == "" || !rule.hasDestination(destination) {
+		return "", false
+	}
+	if !r.health.Load().Healthy(destination) || !r.breaker.Allow(destination) {
+		return "", false
+	}
+	return destination, true
+}
+
+// stickyDestination returns the destination recorded in the live session of
+// the client at ip and port, if the rule is Sticky and that destination can
+// still take traffic
+func (r *Router) stickyDestination(rule Rule, sessions *SessionManager, ip, port string) (string, bool) {
+	if !rule.Sticky {
+		return "", false
+	}
+	session, ok := sessions.GetSession(sessionKey(ip, port))
+	if !ok || time.Since(session.DateTimeStamp) > sessions.TTL {
+		return "", false
+	}
+	return r.pinnedDestination(rule, session.destination())
+}
+
+// affinityValue returns the opaque cookie value identifying destination, so
+// backend addresses are not exposed to clients
+func affinityValue(destination string) string {
+	sum := sha256.Sum256([]byte(destination))
+	return hex.EncodeToString(sum[:8])
+}
+
+// destinationForAffinity returns the destination of rule identified by value
+func (rule Rule) destinationForAffinity(value string) string {
+	candidates := rule.pool()
+	for _, wd := range rule.Weights {
+		candidates = append(candidates, wd.Address)
+	}
+	for _, destination := range candidates {
+		if affinityValue(destination) == value {
+			return destination
+		}
+	}
+	return ""
+}
+
+// cookieDestination returns the destination pinned by the affinity cookie
+// of req, if the rule uses one and that destination can still take traffic
+func (r *Router) cookieDestination(rule Rule, req *http.Request) (string, bool) {
+	name := rule.AffinityCookie
+	if name == "" {
+		return "", false
+	}
+	cookie, err := req.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	return r.pinnedDestination(rule, rule.destinationForAffinity(cookie.Value))
+}
+
+// setAffinityCookie pins the client to destination through the rule's
+// affinity cookie, unless req already carries that pin
+func setAffinityCookie(w http.ResponseWriter, req *http.Request, rule Rule, destination string) {
+	name := rule.AffinityCookie
+	if name == "" {
+		return
+	}
+	value := affinityValue(destination)
+	if cookie, err := req.Cookie(name); err == nil && cookie.Value == value {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
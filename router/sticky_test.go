@@ -0,0 +1,125 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStickySessions(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	sessions := NewSessionManager(nil, WithTTL(time.Minute))
+	router := newTestRouter(t, &RouterConfig{
+		Rules: []Rule{{Service: "api", Destinations: []string{a.URL, b.URL}, Sticky: true}},
+	}, WithSessions(sessions))
+
+	const client = "192.0.2.1:1234"
+	_, first := serve(router, serviceRequest("api", client))
+	for i := 0; i < 4; i++ {
+		if _, got := serve(router, serviceRequest("api", client)); got != first {
+			t.Fatalf("request %d went to %s, want %s", i+2, got, first)
+		}
+	}
+	// Another client is balanced as usual, onto the next destination.
+	if _, got := serve(router, serviceRequest("api", "192.0.2.2:1234")); got == first {
+		t.Errorf("a new client went to %s as well", got)
+	}
+
+	session, ok := sessions.GetSession(client)
+	if !ok {
+		t.Fatal("no session recorded for the client")
+	}
+	session.DateTimeStamp = time.Now().Add(-2 * time.Minute)
+	sessions.AddOrUpdateSession(session)
+	// The rotation is back on the first destination, so only an expired
+	// pin lets the client move.
+	serve(router, serviceRequest("api", "192.0.2.3:1234"))
+	if _, got := serve(router, serviceRequest("api", client)); got == first {
+		t.Errorf("client still pinned to %s after its session expired", got)
+	}
+}
+
+// TestPinnedDestinationLeavesProbe checks that a pinned client does not
+// claim the half-open probe of the destination the balancer would have picked
+func TestPinnedDestinationLeavesProbe(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	sessions := NewSessionManager(nil)
+	router := newTestRouter(t, &RouterConfig{
+		CircuitBreaker: &CircuitBreakerConfig{FailureThreshold: 1},
+		Rules:          []Rule{{Service: "api", Destinations: []string{b.URL, a.URL}, Sticky: true}},
+	}, WithSessions(sessions))
+
+	const client = "192.0.2.1:1234"
+	sessions.AddOrUpdateSession(&Session{DateTimeStamp: time.Now(), SourceIP: "192.0.2.1", SourcePort: "1234", Destination: a.URL})
+	// With no cooldown b's circuit is half-open as soon as it opens, and
+	// b is first in the rotation.
+	router.breaker.Failure(b.URL)
+	rec, got := serve(router, serviceRequest("api", client))
+	if rec.Code != http.StatusOK || got != "a" {
+		t.Fatalf("pinned request = %d %q, want 200 from a", rec.Code, got)
+	}
+	if !router.breaker.Allow(b.URL) {
+		t.Error("the pinned request claimed b's half-open probe")
+	}
+}
+
+func TestAffinityCookie(t *testing.T) {
+	a, b := newBackend(t, "a"), newBackend(t, "b")
+	router := newTestRouter(t, &RouterConfig{
+		HealthCheck: &HealthCheckConfig{},
+		Rules:       []Rule{{Service: "api", Destinations: []string{a.URL, b.URL}, AffinityCookie: "ROUTERAFFINITY"}},
+	})
+	affinity := func(rec *httptest.ResponseRecorder) *http.Cookie {
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == "ROUTERAFFINITY" {
+				return cookie
+			}
+		}
+		return nil
+	}
+
+	rec, first := serve(router, serviceRequest("api", ""))
+	cookie := affinity(rec)
+	if cookie == nil || cookie.Value != affinityValue(a.URL) || !cookie.HttpOnly {
+		t.Fatalf("first response from %s set cookie %v, want one pinning a", first, cookie)
+	}
+
+	// Clients behind one NAT share an address but not a cookie.
+	for i := 0; i < 3; i++ {
+		req := serviceRequest("api", "")
+		req.AddCookie(cookie)
+		rec, got := serve(router, req)
+		if got != "a" {
+			t.Fatalf("request %d with the cookie went to %s, want a", i+1, got)
+		}
+		if affinity(rec) != nil {
+			t.Errorf("request %d with the cookie set it again", i+1)
+		}
+	}
+
+	router.health.Load().mu.Lock()
+	router.health.Load().healthy[a.URL] = false
+	router.health.Load().mu.Unlock()
+	req := serviceRequest("api", "")
+	req.AddCookie(cookie)
+	rec, got := serve(router, req)
+	if got != "b" {
+		t.Fatalf("with a unhealthy the pinned request went to %q, want b", got)
+	}
+	if repinned := affinity(rec); repinned == nil || repinned.Value != affinityValue(b.URL) {
+		t.Errorf("fallback response set cookie %v, want one pinning b", repinned)
+	}
+}
+
+func TestAffinityCookieUnknownValue(t *testing.T) {
+	a := newBackend(t, "a")
+	router := newTestRouter(t, &RouterConfig{
+		Rules: []Rule{{Service: "api", Destination: a.URL, AffinityCookie: "ROUTERAFFINITY"}},
+	})
+	req := serviceRequest("api", "")
+	req.AddCookie(&http.Cookie{Name: "ROUTERAFFINITY", Value: "not-a-destination"})
+	if rec, got := serve(router, req); rec.Code != http.StatusOK || got != "a" {
+		t.Errorf("request with a stale cookie = %d %q, want 200 from a", rec.Code, got)
+	}
+}
@@ -0,0 +1,105 @@
+package router
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionStore persists sessions by key. Implementations must be safe for
+// concurrent use.
+type SessionStore interface {
+	// Get returns the session stored under key, if any
+	Get(key string) (*Session, bool, error)
+	// Put adds or replaces the session stored under key
+	Put(key string, s *Session) error
+	// Delete removes the session stored under key; deleting a missing key is not an error
+	Delete(key string) error
+	// Range calls fn for each stored session until fn returns false
+	Range(fn func(key string, s *Session) bool) error
+	// ExpireOlderThan removes every session whose DateTimeStamp is before
+	// cutoff and returns how many were removed
+	ExpireOlderThan(cutoff time.Time) (int, error)
+	// Len returns the number of stored sessions
+	Len() (int, error)
+}
+
+// MemoryStore is a SessionStore backed by an in-process map
+type MemoryStore struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]*Session)}
+}
+
+func (m *MemoryStore) Get(key string) (*Session, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[key]
+	return s, ok, nil
+}
+
+func (m *MemoryStore) Put(key string, s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[key] = s
+	return nil
+}
+
+func (m *MemoryStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, key)
+	return nil
+}
+
+// Range calls fn for each session while holding a read lock, so fn must not
+// modify the store
+func (m *MemoryStore) Range(fn func(key string, s *Session) bool) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for key, s := range m.sessions {
+		if !fn(key, s) {
+			break
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) ExpireOlderThan(cutoff time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := 0
+	for key, s := range m.sessions {
+		if s.DateTimeStamp.Before(cutoff) {
+			delete(m.sessions, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (m *MemoryStore) Len() (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.sessions), nil
+}
+
+// newSessionStore opens the store described by spec: "memory" (or empty) for
+// a MemoryStore, a redis:// or rediss:// URL for a RedisStore, or
+// sqlite:<path> for a SQLiteStore
+func newSessionStore(spec string) (SessionStore, error) {
+	switch {
+	case spec == "" || spec == "memory":
+		return NewMemoryStore(), nil
+	case strings.HasPrefix(spec, "redis://"), strings.HasPrefix(spec, "rediss://"):
+		return NewRedisStoreFromURL(spec)
+	case strings.HasPrefix(spec, "sqlite:"):
+		return NewSQLiteStore(strings.TrimPrefix(spec, "sqlite:"))
+	}
+	return nil, fmt.Errorf("unknown session store %q", spec)
+}
@@ -0,0 +1,175 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// defaultRedisPrefix namespaces the keys a RedisStore writes
+const defaultRedisPrefix = "router:session:"
+
+// redisTimeout bounds every Redis operation made by a RedisStore
+const redisTimeout = 2 * time.Second
+
+// RedisStore is a SessionStore backed by Redis so that several router
+// instances can share session state. Each session is stored as JSON under
+// prefix+key, and a sorted set scored by DateTimeStamp indexes the keys for
+// Range, Len and expiry.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a RedisStore using client. An empty prefix uses
+// "router:session:".
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = defaultRedisPrefix
+	}
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// NewRedisStoreFromURL connects to the Redis server described by a redis:// URL
+func NewRedisStoreFromURL(url string) (*RedisStore, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return NewRedisStore(redis.NewClient(opts), ""), nil
+}
+
+// indexKey is the sorted set of session keys scored by timestamp
+func (rs *RedisStore) indexKey() string {
+	return rs.prefix + "index"
+}
+
+// sessionKey is the Redis key holding the session stored under key
+func (rs *RedisStore) sessionKey(key string) string {
+	return rs.prefix + "s:" + key
+}
+
+func (rs *RedisStore) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), redisTimeout)
+}
+
+func (rs *RedisStore) Get(key string) (*Session, bool, error) {
+	ctx, cancel := rs.context()
+	defer cancel()
+	data, err := rs.client.Get(ctx, rs.sessionKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, false, err
+	}
+	return &s, true, nil
+}
+
+func (rs *RedisStore) Put(key string, s *Session) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := rs.context()
+	defer cancel()
+	_, err = rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, rs.sessionKey(key), data, 0)
+		pipe.ZAdd(ctx, rs.indexKey(), redis.Z{Score: float64(s.DateTimeStamp.UnixNano()), Member: key})
+		return nil
+	})
+	return err
+}
+
+func (rs *RedisStore) Delete(key string) error {
+	ctx, cancel := rs.context()
+	defer cancel()
+	_, err := rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, rs.sessionKey(key))
+		pipe.ZRem(ctx, rs.indexKey(), key)
+		return nil
+	})
+	return err
+}
+
+// rangeBatch is how many sessions Range fetches per round trip
+const rangeBatch = 500
+
+func (rs *RedisStore) Range(fn func(key string, s *Session) bool) error {
+	ctx, cancel := rs.context()
+	defer cancel()
+	keys, err := rs.client.ZRange(ctx, rs.indexKey(), 0, -1).Result()
+	if err != nil {
+		return err
+	}
+	for start := 0; start < len(keys); start += rangeBatch {
+		batch := keys[start:min(start+rangeBatch, len(keys))]
+		redisKeys := make([]string, len(batch))
+		for i, key := range batch {
+			redisKeys[i] = rs.sessionKey(key)
+		}
+		values, err := rs.client.MGet(ctx, redisKeys...).Result()
+		if err != nil {
+			return err
+		}
+		for i, value := range values {
+			data, ok := value.(string)
+			if !ok {
+				continue // expired or deleted since ZRange
+			}
+			var s Session
+			if err := json.Unmarshal([]byte(data), &s); err != nil {
+				return err
+			}
+			if !fn(batch[i], &s) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func (rs *RedisStore) ExpireOlderThan(cutoff time.Time) (int, error) {
+	ctx, cancel := rs.context()
+	defer cancel()
+	max := "(" + strconv.FormatInt(cutoff.UnixNano(), 10)
+	keys, err := rs.client.ZRangeByScore(ctx, rs.indexKey(), &redis.ZRangeBy{Min: "-inf", Max: max}).Result()
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	redisKeys := make([]string, len(keys))
+	members := make([]any, len(keys))
+	for i, key := range keys {
+		redisKeys[i] = rs.sessionKey(key)
+		members[i] = key
+	}
+	_, err = rs.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, redisKeys...)
+		pipe.ZRem(ctx, rs.indexKey(), members...)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+func (rs *RedisStore) Len() (int, error) {
+	ctx, cancel := rs.context()
+	defer cancel()
+	n, err := rs.client.ZCard(ctx, rs.indexKey()).Result()
+	return int(n), err
+}
+
+// Close closes the underlying Redis client
+func (rs *RedisStore) Close() error {
+	return rs.client.Close()
+}
@@ -0,0 +1,157 @@
+package router
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the sessions table and the index used by expiry sweeps
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	key             TEXT PRIMARY KEY,
+	DateTimeStamp   INTEGER NOT NULL,
+	sourceIP        TEXT NOT NULL,
+	requestService  TEXT NOT NULL,
+	sourcePort      TEXT NOT NULL,
+	destination     TEXT NOT NULL DEFAULT '',
+	DestinationIP   TEXT NOT NULL,
+	DestinationPort TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS sessions_DateTimeStamp ON sessions (DateTimeStamp);
+`
+
+// migrateSQLite adds the columns introduced since a database was created
+func migrateSQLite(db *sql.DB) error {
+	var exists int
+	err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('sessions') WHERE name = 'destination'`).Scan(&exists)
+	if err != nil || exists > 0 {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE sessions ADD COLUMN destination TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+// SQLiteStore is a SessionStore backed by a SQLite database, so sessions
+// survive restarts without rewriting a whole file. Timestamps are stored as
+// Unix nanoseconds so that expiry is a single indexed DELETE.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens or creates the SQLite database at path
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; one connection avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// scanSession reads a session row
+func scanSession(row interface{ Scan(...any) error }) (string, *Session, error) {
+	var key string
+	var stamp int64
+	var s Session
+	if err := row.Scan(&key, &stamp, &s.SourceIP, &s.RequestService, &s.SourcePort, &s.Destination, &s.DestinationIP, &s.DestinationPort); err != nil {
+		return "", nil, err
+	}
+	s.DateTimeStamp = time.Unix(0, stamp)
+	return key, &s, nil
+}
+
+const sqliteColumns = `key, DateTimeStamp, sourceIP, requestService, sourcePort, destination, DestinationIP, DestinationPort`
+
+func (st *SQLiteStore) Get(key string) (*Session, bool, error) {
+	_, s, err := scanSession(st.db.QueryRow(`SELECT `+sqliteColumns+` FROM sessions WHERE key = ?`, key))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return s, true, nil
+}
+
+func (st *SQLiteStore) Put(key string, s *Session) error {
+	_, err := st.db.Exec(`INSERT INTO sessions (`+sqliteColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			DateTimeStamp = excluded.DateTimeStamp,
+			sourceIP = excluded.sourceIP,
+			requestService = excluded.requestService,
+			sourcePort = excluded.sourcePort,
+			destination = excluded.destination,
+			DestinationIP = excluded.DestinationIP,
+			DestinationPort = excluded.DestinationPort`,
+		key, s.DateTimeStamp.UnixNano(), s.SourceIP, s.RequestService, s.SourcePort, s.Destination, s.DestinationIP, s.DestinationPort)
+	return err
+}
+
+func (st *SQLiteStore) Delete(key string) error {
+	_, err := st.db.Exec(`DELETE FROM sessions WHERE key = ?`, key)
+	return err
+}
+
+// Range calls fn for each session. The rows are read in full before fn is
+// called so that fn may use the store.
+func (st *SQLiteStore) Range(fn func(key string, s *Session) bool) error {
+	rows, err := st.db.Query(`SELECT ` + sqliteColumns + ` FROM sessions`)
+	if err != nil {
+		return err
+	}
+	var keys []string
+	var sessions []*Session
+	for rows.Next() {
+		key, s, err := scanSession(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		keys = append(keys, key)
+		sessions = append(sessions, s)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for i, s := range sessions {
+		if !fn(keys[i], s) {
+			break
+		}
+	}
+	return nil
+}
+
+func (st *SQLiteStore) ExpireOlderThan(cutoff time.Time) (int, error) {
+	result, err := st.db.Exec(`DELETE FROM sessions WHERE DateTimeStamp < ?`, cutoff.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (st *SQLiteStore) Len() (int, error) {
+	var n int
+	err := st.db.QueryRow(`SELECT COUNT(*) FROM sessions`).Scan(&n)
+	return n, err
+}
+
+// Close closes the database
+func (st *SQLiteStore) Close() error {
+	return st.db.Close()
+}
@@ -0,0 +1,195 @@
+package router
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// testSessionStore runs the behavior every SessionStore must share against store
+func testSessionStore(t *testing.T, store SessionStore) {
+	t.Helper()
+	now := time.Now().Truncate(time.Millisecond)
+	sessions := map[string]*Session{
+		"192.0.2.1:1000": {DateTimeStamp: now.Add(-time.Hour), SourceIP: "192.0.2.1", SourcePort: "1000", Destination: "http://a:1"},
+		"192.0.2.2:2000": {DateTimeStamp: now.Add(-time.Minute), SourceIP: "192.0.2.2", SourcePort: "2000", Destination: "http://b:1"},
+		"192.0.2.3:3000": {DateTimeStamp: now, SourceIP: "192.0.2.3", SourcePort: "3000", Destination: "http://c:1"},
+	}
+	for key, s := range sessions {
+		if err := store.Put(key, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, ok, err := store.Get("192.0.2.2:2000")
+	if err != nil || !ok || got.Destination != "http://b:1" || !got.DateTimeStamp.Equal(now.Add(-time.Minute)) {
+		t.Errorf("Get = %+v, %v, %v", got, ok, err)
+	}
+	if _, ok, err := store.Get("192.0.2.9:9000"); ok || err != nil {
+		t.Errorf("Get of a missing key = %v, %v", ok, err)
+	}
+	if n, err := store.Len(); n != 3 || err != nil {
+		t.Errorf("Len = %d, %v, want 3", n, err)
+	}
+
+	var keys []string
+	if err := store.Range(func(key string, s *Session) bool {
+		keys = append(keys, key)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(keys)
+	if want := []string{"192.0.2.1:1000", "192.0.2.2:2000", "192.0.2.3:3000"}; !slices.Equal(keys, want) {
+		t.Errorf("Range visited %q, want %q", keys, want)
+	}
+	visited := 0
+	store.Range(func(key string, s *Session) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Errorf("Range visited %d sessions after fn returned false, want 1", visited)
+	}
+
+	// Replacing a session moves it in the expiry order.
+	if err := store.Put("192.0.2.1:1000", &Session{DateTimeStamp: now, SourceIP: "192.0.2.1", SourcePort: "1000", Destination: "http://d:1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _, _ := store.Get("192.0.2.1:1000"); got == nil || got.Destination != "http://d:1" {
+		t.Errorf("Get after replacing = %+v", got)
+	}
+	removed, err := store.ExpireOlderThan(now.Add(-time.Second))
+	if removed != 1 || err != nil {
+		t.Errorf("ExpireOlderThan = %d, %v, want 1", removed, err)
+	}
+	if _, ok, _ := store.Get("192.0.2.2:2000"); ok {
+		t.Error("expired session still stored")
+	}
+
+	if err := store.Delete("192.0.2.3:3000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("192.0.2.3:3000"); err != nil {
+		t.Errorf("deleting a missing key: %v", err)
+	}
+	if n, _ := store.Len(); n != 1 {
+		t.Errorf("Len after expiry and delete = %d, want 1", n)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testSessionStore(t, NewMemoryStore())
+}
+
+// newRedisStore returns a RedisStore backed by a miniredis server that stops when the test ends
+func newRedisStore(t *testing.T) (*RedisStore, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	store := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "")
+	t.Cleanup(func() { store.Close() })
+	return store, server
+}
+
+func TestRedisStore(t *testing.T) {
+	store, _ := newRedisStore(t)
+	testSessionStore(t, store)
+}
+
+func TestRedisStoreSharedBetweenRouters(t *testing.T) {
+	store, server := newRedisStore(t)
+	other := NewRedisStore(redis.NewClient(&redis.Options{Addr: server.Addr()}), "")
+	t.Cleanup(func() { other.Close() })
+	first, second := NewSessionManager(store), NewSessionManager(other)
+
+	first.AddOrUpdateSession(&Session{DateTimeStamp: time.Now(), SourceIP: "192.0.2.1", SourcePort: "1234", Destination: "http://a:1"})
+	got, ok := second.GetSession("192.0.2.1:1234")
+	if !ok || got.Destination != "http://a:1" {
+		t.Errorf("second instance sees %+v, %v, want the first instance's session", got, ok)
+	}
+	if !server.Exists(defaultRedisPrefix + "s:192.0.2.1:1234") {
+		t.Errorf("keys = %q, want the session under %q", server.Keys(), defaultRedisPrefix)
+	}
+}
+
+func TestRedisStoreUnavailable(t *testing.T) {
+	store, server := newRedisStore(t)
+	server.Close()
+	if err := store.Put("192.0.2.1:1234", &Session{DateTimeStamp: time.Now()}); err == nil {
+		t.Error("Put with Redis down returned no error")
+	}
+	if _, _, err := store.Get("192.0.2.1:1234"); err == nil {
+		t.Error("Get with Redis down returned no error")
+	}
+}
+
+// newSQLiteStore returns a SQLiteStore in a temporary directory, closed when the test ends
+func newSQLiteStore(t *testing.T, path string) *SQLiteStore {
+	t.Helper()
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testSessionStore(t, newSQLiteStore(t, filepath.Join(t.TempDir(), "sessions.db")))
+}
+
+func TestSQLiteStoreUpsert(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.db")
+	store := newSQLiteStore(t, path)
+	now := time.Now()
+	for i, destination := range []string{"http://a:1", "http://b:1", "http://c:1"} {
+		s := &Session{DateTimeStamp: now.Add(time.Duration(i) * time.Second), SourceIP: "192.0.2.1", SourcePort: "1234", RequestService: "api", Destination: destination}
+		if err := store.Put(s.Key(), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, _ := store.Len(); n != 1 {
+		t.Errorf("Len after three upserts of one key = %d, want 1", n)
+	}
+	store.Close()
+
+	reopened := newSQLiteStore(t, path)
+	got, ok, err := reopened.Get("192.0.2.1:1234")
+	if err != nil || !ok {
+		t.Fatalf("Get after reopening = %v, %v", ok, err)
+	}
+	if got.Destination != "http://c:1" || !got.DateTimeStamp.Equal(now.Add(2*time.Second)) || got.RequestService != "api" {
+		t.Errorf("Get after reopening = %+v, want the last upsert", got)
+	}
+}
+
+func TestSQLiteStoreBulkExpiry(t *testing.T) {
+	store := newSQLiteStore(t, filepath.Join(t.TempDir(), "sessions.db"))
+	now := time.Now()
+	const total, old = 1000, 600
+	for i := 0; i < total; i++ {
+		stamp := now
+		if i < old {
+			stamp = now.Add(-time.Hour)
+		}
+		s := &Session{DateTimeStamp: stamp, SourceIP: "192.0.2.1", SourcePort: strconv.Itoa(i)}
+		if err := store.Put(s.Key(), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed, err := store.ExpireOlderThan(now.Add(-time.Minute))
+	if removed != old || err != nil {
+		t.Errorf("ExpireOlderThan = %d, %v, want %d", removed, err, old)
+	}
+	if n, _ := store.Len(); n != total-old {
+		t.Errorf("Len = %d, want %d", n, total-old)
+	}
+	if removed, _ := store.ExpireOlderThan(now.Add(-time.Minute)); removed != 0 {
+		t.Errorf("second sweep removed %d, want 0", removed)
+	}
+}
@@ -0,0 +1,85 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// dialTimeoutKey is the context key of the connect timeout of a forwarded request
+type dialTimeoutKey struct{}
+
+// withDialTimeout returns ctx carrying timeout as the bound on connecting
+// to the destination, when it is positive
+func withDialTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	if timeout <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, dialTimeoutKey{}, timeout)
+}
+
+// dialTimeout wraps dial to bound each connection by the timeout carried in
+// its context, on top of the transport's own dial timeout
+func dialTimeout(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if timeout, ok := ctx.Value(dialTimeoutKey{}).(time.Duration); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// headerTimer cancels a forwarded request whose response headers have not
+// arrived within a timeout. Unlike a context deadline it stops once they
+// have, leaving the body to stream for as long as it takes. A nil
+// headerTimer imposes no timeout.
+type headerTimer struct {
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+}
+
+// startHeaderTimer returns req under a context the timer cancels once
+// timeout passes, or req and nil when timeout is not positive
+func startHeaderTimer(req *http.Request, timeout time.Duration) (*http.Request, *headerTimer) {
+	if timeout <= 0 {
+		return req, nil
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	return req.WithContext(ctx), &headerTimer{timeout: timeout, timer: time.AfterFunc(timeout, cancel), cancel: cancel}
+}
+
+// stop ends the timer when the response headers or err arrive, reporting a
+// request it canceled as having timed out
+func (t *headerTimer) stop(err error) error {
+	if t == nil {
+		return err
+	}
+	if !t.timer.Stop() && err != nil {
+		return fmt.Errorf("no response headers within %s: %w", t.timeout, context.DeadlineExceeded)
+	}
+	return err
+}
+
+// release frees the request's context once the response is done with
+func (t *headerTimer) release() {
+	if t != nil {
+		t.cancel()
+	}
+}
+
+// dialTimeout returns the rule's bound on connecting to a destination, or 0
+// for the transport's default
+func (rule Rule) dialTimeout() time.Duration {
+	return time.Duration(rule.DialTimeoutMS) * time.Millisecond
+}
+
+// responseHeaderTimeout returns how long the rule waits for a destination's
+// response headers, or 0 for no limit beyond the total timeout
+func (rule Rule) responseHeaderTimeout() time.Duration {
+	return time.Duration(rule.ResponseHeaderTimeoutMS) * time.Millisecond
+}
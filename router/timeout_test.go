@@ -0,0 +1,137 @@
+package router
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newSlowBackend starts a backend that answers after delay, or gives up
+// once the request is canceled
+func newSlowBackend(t *testing.T, delay time.Duration) *httptest.Server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-time.After(delay):
+			w.Write([]byte("slow"))
+		case <-req.Context().Done():
+		}
+	}))
+	t.Cleanup(backend.Close)
+	return backend
+}
+
+func TestForwardTimeout(t *testing.T) {
+	slow := newSlowBackend(t, 2*time.Second)
+	fast := newSlowBackend(t, 0)
+	tests := []struct {
+		name   string
+		config RouterConfig
+		opts   []Option
+		status int
+	}{
+		{name: "rule", config: RouterConfig{Rules: []Rule{{Service: "api", Destination: slow.URL, TotalTimeoutMS: 50}}}, status: http.StatusGatewayTimeout},
+		{name: "global", config: RouterConfig{TimeoutMS: 50, Rules: []Rule{{Service: "api", Destination: slow.URL}}}, status: http.StatusGatewayTimeout},
+		{name: "option", config: RouterConfig{Rules: []Rule{{Service: "api", Destination: slow.URL}}}, opts: []Option{WithTimeout(50 * time.Millisecond)}, status: http.StatusGatewayTimeout},
+		{name: "rule overrides global", config: RouterConfig{TimeoutMS: 5000, Rules: []Rule{{Service: "api", Destination: slow.URL, TotalTimeoutMS: 50}}}, status: http.StatusGatewayTimeout},
+		{name: "within the bound", config: RouterConfig{Rules: []Rule{{Service: "api", Destination: fast.URL, TotalTimeoutMS: 1000}}}, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, &tt.config, tt.opts...)
+			start := time.Now()
+			rec, body := serve(router, serviceRequest("api", ""))
+			elapsed := time.Since(start)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d %s, want %d", rec.Code, body, tt.status)
+			}
+			if tt.status != http.StatusGatewayTimeout {
+				return
+			}
+			if elapsed < 50*time.Millisecond || elapsed > time.Second {
+				t.Errorf("timed out after %v, want about 50ms", elapsed)
+			}
+			if !strings.Contains(body, "gateway_timeout") || !strings.Contains(body, `"reason":"timeout"`) {
+				t.Errorf("body = %s", body)
+			}
+		})
+	}
+}
+
+func TestTimeoutFor(t *testing.T) {
+	router := newTestRouter(t, &RouterConfig{TimeoutMS: 300}, WithTimeout(time.Minute))
+	tests := []struct {
+		rule Rule
+		want time.Duration
+	}{
+		{Rule{TotalTimeoutMS: 100}, 100 * time.Millisecond},
+		{Rule{TimeoutMS: 200}, 200 * time.Millisecond},
+		{Rule{TotalTimeoutMS: 100, TimeoutMS: 200}, 100 * time.Millisecond},
+		// Phase timeouts replace the total one.
+		{Rule{DialTimeoutMS: 10}, 0},
+		{Rule{}, 300 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := router.timeoutFor(tt.rule); got != tt.want {
+			t.Errorf("timeoutFor(%+v) = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+	if got := newTestRouter(t, &RouterConfig{}, WithTimeout(time.Minute)).timeoutFor(Rule{}); got != time.Minute {
+		t.Errorf("timeoutFor without a global timeoutMS = %v, want the WithTimeout default", got)
+	}
+}
+
+func TestPhaseTimeouts(t *testing.T) {
+	// Lookups of the slow host hang, as a connect to an unresponsive
+	// address would, until the dial gives up.
+	hang := func(ctx context.Context, host string) ([]netip.Addr, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	slowResponse := newSlowBackend(t, 200*time.Millisecond)
+	streaming := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 4; i++ {
+			io.WriteString(w, "chunk ")
+			w.(http.Flusher).Flush()
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	t.Cleanup(streaming.Close)
+
+	tests := []struct {
+		name   string
+		rule   Rule
+		status int
+		body   string
+	}{
+		{"slow connect", Rule{Destination: "http://unresponsive.internal:80", DialTimeoutMS: 50}, http.StatusGatewayTimeout, ""},
+		{"slow response within the dial timeout", Rule{Destination: slowResponse.URL, DialTimeoutMS: 50}, http.StatusOK, "slow"},
+		{"slow response headers", Rule{Destination: slowResponse.URL, ResponseHeaderTimeoutMS: 50}, http.StatusGatewayTimeout, ""},
+		{"stream outlasting the header timeout", Rule{Destination: streaming.URL, ResponseHeaderTimeoutMS: 50}, http.StatusOK, "chunk chunk chunk chunk "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Service = "api"
+			router := newTestRouter(t, &RouterConfig{DNS: &DNSConfig{}, Rules: []Rule{tt.rule}})
+			router.dns.lookup = hang
+			start := time.Now()
+			rec, body := serve(router, serviceRequest("api", ""))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d %s, want %d", rec.Code, body, tt.status)
+			}
+			if tt.status == http.StatusGatewayTimeout {
+				if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+					t.Errorf("timed out after %v, want about 50ms", elapsed)
+				}
+			} else if body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package router
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloader serves a certificate loaded from disk, reloading it whenever
+// the cert or key file changes so certificates can be rotated without a restart
+type certReloader struct {
+	certFile, keyFile string
+	logger            *slog.Logger
+
+	mu              sync.Mutex
+	cert            *tls.Certificate
+	certMod, keyMod time.Time
+	lastCheck       time.Time
+}
+
+// certCheckInterval bounds how often the cert files are checked for changes
+const certCheckInterval = time.Second
+
+// newCertReloader loads the key pair in certFile and keyFile
+func newCertReloader(certFile, keyFile string, logger *slog.Logger) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile, logger: logger}
+	if err := cr.load(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// modTimes returns the modification times of the cert and key files
+func (cr *certReloader) modTimes() (certMod, keyMod time.Time, err error) {
+	info, err := os.Stat(cr.certFile)
+	if err != nil {
+		return
+	}
+	certMod = info.ModTime()
+	if info, err = os.Stat(cr.keyFile); err != nil {
+		return
+	}
+	keyMod = info.ModTime()
+	return
+}
+
+// load reads the key pair from disk; callers other than the constructor must hold mu
+func (cr *certReloader) load() error {
+	certMod, keyMod, err := cr.modTimes()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+	cr.cert, cr.certMod, cr.keyMod = &cert, certMod, keyMod
+	return nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate. If the files changed
+// but cannot be loaded, the previous certificate keeps being served.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if now := time.Now(); now.Sub(cr.lastCheck) >= certCheckInterval {
+		cr.lastCheck = now
+		certMod, keyMod, err := cr.modTimes()
+		if err == nil && (!certMod.Equal(cr.certMod) || !keyMod.Equal(cr.keyMod)) {
+			err = cr.load()
+			if err == nil {
+				cr.logger.Info("reloaded TLS certificate", "cert", cr.certFile)
+			}
+		}
+		if err != nil {
+			cr.logger.Error("reloading TLS certificate", "cert", cr.certFile, "error", err)
+		}
+	}
+	return cr.cert, nil
+}
+
+// setKeyPair replaces the served certificate with a PEM key pair, as pushed
+// through the admin API, returning its parsed leaf. The pair is served until
+// it is replaced again or the cert files change.
+func (cr *certReloader) setKeyPair(certPEM, keyPEM []byte) (*x509.Certificate, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf = leaf
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.cert = &cert
+	cr.logger.Info("replaced TLS certificate", "subject", leaf.Subject.String(), "notAfter", leaf.NotAfter)
+	return leaf, nil
+}
+
+// clientAuthConfig returns a TLS config serving certs that requires clients
+// to present a certificate signed by a CA in the PEM bundle caFile
+func clientAuthConfig(certs *certReloader, caFile string) (*tls.Config, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no certificates found", caFile)
+	}
+	return &tls.Config{
+		GetCertificate: certs.GetCertificate,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      pool,
+	}, nil
+}
+
+// redirectHandler redirects every request to the same URL over HTTPS on the
+// port of httpsAddr
+func redirectHandler(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if net.ParseIP(host) != nil && net.ParseIP(host).To4() == nil {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
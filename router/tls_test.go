@@ -0,0 +1,297 @@
+package router
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate generated for a test with its PEM encoding
+type testCert struct {
+	cert            *x509.Certificate
+	key             *ecdsa.PrivateKey
+	certPEM, keyPEM []byte
+}
+
+// newTestCert generates a certificate for localhost named cn, signed by
+// parent or, if parent is nil, a self-signed CA
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// write stores the certificate and key as cert.pem and key.pem in dir
+func (c *testCert) write(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, c.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, c.keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// servedCert connects to server and returns the common name of its certificate
+func servedCert(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", server.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := newTestCert(t, "first", nil).write(t, dir)
+	certs, err := newCertReloader(certFile, keyFile, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	// StartTLS would add its own certificate, which takes precedence over
+	// GetCertificate, so the listener is wrapped directly.
+	server.Listener = tls.NewListener(server.Listener, &tls.Config{GetCertificate: certs.GetCertificate})
+	server.Start()
+	t.Cleanup(server.Close)
+
+	if got := servedCert(t, server); got != "first" {
+		t.Fatalf("served %q, want first", got)
+	}
+
+	newTestCert(t, "second", nil).write(t, dir)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	certs.mu.Lock()
+	certs.lastCheck = time.Time{}
+	certs.mu.Unlock()
+	if got := servedCert(t, server); got != "second" {
+		t.Errorf("after rotating the files served %q, want second", got)
+	}
+
+	// A broken pair on disk keeps the last good certificate serving.
+	os.WriteFile(keyFile, []byte("not a key"), 0o600)
+	os.Chtimes(keyFile, later.Add(time.Minute), later.Add(time.Minute))
+	certs.mu.Lock()
+	certs.lastCheck = time.Time{}
+	certs.mu.Unlock()
+	if got := servedCert(t, server); got != "second" {
+		t.Errorf("with a broken key file served %q, want second", got)
+	}
+}
+
+func TestNewCertReloaderMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := newCertReloader(filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), nil); err == nil {
+		t.Error("newCertReloader with missing files returned no error")
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		httpsAddr, host, target string
+		want                    string
+	}{
+		{":443", "example.com", "/a?b=c", "https://example.com/a?b=c"},
+		{":443", "example.com:80", "/", "https://example.com/"},
+		{":8443", "example.com:8080", "/a", "https://example.com:8443/a"},
+		{":443", "[2001:db8::1]:80", "/", "https://[2001:db8::1]/"},
+		{":8443", "[2001:db8::1]:80", "/", "https://[2001:db8::1]:8443/"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		redirectHandler(tt.httpsAddr).ServeHTTP(rec, req)
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != tt.want {
+			t.Errorf("redirect of %s%s to %s = %d %q, want %q", tt.host, tt.target, tt.httpsAddr, rec.Code, rec.Header().Get("Location"), tt.want)
+		}
+	}
+}
+
+func TestAdminClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "admin CA", nil)
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, ca.certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := newTestCert(t, "router", ca).write(t, dir)
+	certs, err := newCertReloader(certFile, keyFile, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := clientAuthConfig(certs, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: "http://a:1"}}})
+	server := httptest.NewUnstartedServer(adminMux(router, NewSessionManager(nil), "", nil))
+	server.Listener = tls.NewListener(server.Listener, config)
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.Start()
+	t.Cleanup(server.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	keyPair := func(c *testCert) []tls.Certificate {
+		pair, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []tls.Certificate{pair}
+	}
+	tests := []struct {
+		name  string
+		certs []tls.Certificate
+		ok    bool
+	}{
+		{name: "signed by the CA", certs: keyPair(newTestCert(t, "operator", ca)), ok: true},
+		{name: "no certificate"},
+		{name: "self-signed", certs: keyPair(newTestCert(t, "intruder", nil))},
+		{name: "signed by another CA", certs: keyPair(newTestCert(t, "intruder", newTestCert(t, "other CA", nil)))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: tt.certs}}}
+			resp, err := client.Get("https://" + server.Listener.Addr().String() + "/rules")
+			if !tt.ok {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("GET /rules = %d, want a handshake failure", resp.StatusCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("GET /rules = %d, want 200", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestClientAuthConfigBadBundle(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, []byte("no certificates here"), 0o600)
+	if _, err := clientAuthConfig(nil, caFile); err == nil {
+		t.Error("clientAuthConfig with an empty bundle returned no error")
+	}
+}
+
+func TestAdminRotateCertificate(t *testing.T) {
+	certFile, keyFile := newTestCert(t, "first", nil).write(t, t.TempDir())
+	certs, err := newCertReloader(certFile, keyFile, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	server.Listener = tls.NewListener(server.Listener, &tls.Config{GetCertificate: certs.GetCertificate})
+	server.Start()
+	t.Cleanup(server.Close)
+	mux := adminMux(newTestRouter(t, &RouterConfig{}), NewSessionManager(nil), "", certs)
+	push := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tls", strings.NewReader(body)))
+		return rec
+	}
+	pair := func(cert, key []byte) string {
+		body, _ := json.Marshal(keyPair{Cert: string(cert), Key: string(key)})
+		return string(body)
+	}
+
+	second := newTestCert(t, "second", nil)
+	rec := push(pair(second.certPEM, second.keyPEM))
+	var info certificateInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); rec.Code != http.StatusOK || err != nil || info.Subject != "CN=second" {
+		t.Fatalf("POST /tls = %d %s, want 200 for CN=second", rec.Code, rec.Body)
+	}
+	if got := servedCert(t, server); got != "second" {
+		t.Errorf("after POST /tls served %q, want second", got)
+	}
+
+	// Pairs that do not load are refused and the last good one stays.
+	third := newTestCert(t, "third", nil)
+	for name, body := range map[string]string{
+		"mismatched key": pair(third.certPEM, second.keyPEM),
+		"not PEM":        pair([]byte("cert"), []byte("key")),
+		"not JSON":       "cert",
+	} {
+		if rec := push(body); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "invalid_key_pair") {
+			t.Errorf("%s: POST /tls = %d %s, want 400 invalid_key_pair", name, rec.Code, rec.Body)
+		}
+	}
+	if got := servedCert(t, server); got != "second" {
+		t.Errorf("after invalid pairs served %q, want second", got)
+	}
+
+	withoutTLS := adminMux(newTestRouter(t, &RouterConfig{}), NewSessionManager(nil), "", nil)
+	rec = httptest.NewRecorder()
+	withoutTLS.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tls", strings.NewReader(pair(second.certPEM, second.keyPEM))))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("POST /tls without TLS = %d, want 409", rec.Code)
+	}
+}
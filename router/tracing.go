@@ -0,0 +1,84 @@
+package router
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies the router's spans
+const tracerName = "go-router"
+
+// setupTracing exports spans over OTLP/HTTP to endpoint, such as
+// http://localhost:4318, and propagates W3C trace context. Without an
+// endpoint the global no-op tracer is left in place, so tracing costs
+// nothing and incoming traceparent headers are forwarded untouched. The
+// returned function flushes and stops the exporter.
+func setupTracing(ctx context.Context, endpoint string) (shutdown func(context.Context) error, err error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(tracerName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// startSpan starts the server span of an inbound request, continuing the
+// trace of the caller, and returns the request carrying it
+func startSpan(req *http.Request) (*http.Request, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "route "+req.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLPath(req.URL.Path),
+			semconv.ServerAddress(req.Host),
+		))
+	return req.WithContext(ctx), span
+}
+
+// finishSpan records how the request went on its server span and ends it
+func finishSpan(span trace.Span, entry *accessLog, status int) {
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if entry.matched {
+		span.SetAttributes(
+			attribute.String("router.service", entry.service),
+			attribute.String("router.destination", entry.destination),
+		)
+	}
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// startForwardSpan starts the client span of one attempt at forwarding req
+// to destination
+func startForwardSpan(req *http.Request, destination string) (*http.Request, trace.Span) {
+	ctx, span := otel.Tracer(tracerName).Start(req.Context(), "forward "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("router.destination", destination)))
+	return req.WithContext(ctx), span
+}
+
+// injectTraceContext adds the trace context of ctx to the headers of a forwarded request
+func injectTraceContext(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
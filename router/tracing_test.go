@@ -0,0 +1,109 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider recording every span, with W3C
+// trace context propagation, until the test ends
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	oldProvider, oldPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(oldProvider)
+		otel.SetTextMapPropagator(oldPropagator)
+		provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+// spanAttributes collects the attributes of span by key
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	out := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		out[kv.Key] = kv.Value
+	}
+	return out
+}
+
+func TestTracingSpans(t *testing.T) {
+	recorder := recordSpans(t)
+	backend, seen := newRecordingBackend(t, nil)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL}}})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := serviceRequest("api", "")
+	req.Header.Set("Traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	if rec, _ := serve(router, req); rec.Code != http.StatusOK {
+		t.Fatalf("traced request = %d", rec.Code)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want a server and a client span", len(spans))
+	}
+	var server, client sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		switch span.SpanKind() {
+		case trace.SpanKindServer:
+			server = span
+		case trace.SpanKindClient:
+			client = span
+		}
+	}
+	if server == nil || client == nil {
+		t.Fatalf("span kinds = %v, %v, want server and client", spans[0].SpanKind(), spans[1].SpanKind())
+	}
+	if got := server.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("server span trace ID = %s, want the caller's %s", got, traceID)
+	}
+	if client.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("the forward span is not a child of the server span")
+	}
+	attrs := spanAttributes(server)
+	if attrs["router.service"].AsString() != "api" || attrs["router.destination"].AsString() != backend.URL {
+		t.Errorf("server span service, destination = %q, %q, want api, %s", attrs["router.service"].AsString(), attrs["router.destination"].AsString(), backend.URL)
+	}
+	if status := attrs["http.response.status_code"].AsInt64(); status != http.StatusOK {
+		t.Errorf("server span status code = %d, want 200", status)
+	}
+
+	forwarded := propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier((<-seen).Header))
+	if sc := trace.SpanContextFromContext(forwarded); sc.TraceID().String() != traceID || sc.SpanID() != client.SpanContext().SpanID() {
+		t.Errorf("forwarded traceparent = %s/%s, want the trace continued from the forward span", sc.TraceID(), sc.SpanID())
+	}
+}
+
+func TestTracingNoop(t *testing.T) {
+	backend, seen := newRecordingBackend(t, nil)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL}}})
+
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := serviceRequest("api", "")
+	req.Header.Set("Traceparent", traceparent)
+	serve(router, req)
+	if got := (<-seen).Header.Get("Traceparent"); got != traceparent {
+		t.Errorf("without tracing the backend got traceparent %q, want %q", got, traceparent)
+	}
+
+	shutdown, err := setupTracing(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutting down no-op tracing: %v", err)
+	}
+}
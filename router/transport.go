@@ -0,0 +1,87 @@
+package router
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportConfig sizes the connection pool used to reach destinations.
+// It is read when the router is created; changes need a restart.
+type TransportConfig struct {
+	// MaxIdleConns caps idle connections across all destinations
+	MaxIdleConns int `json:"maxIdleConns,omitempty" yaml:"maxIdleConns,omitempty"`
+	// MaxIdleConnsPerHost caps idle connections kept per destination
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost,omitempty" yaml:"maxIdleConnsPerHost,omitempty"`
+	// IdleConnTimeoutMS closes connections idle for longer than this
+	IdleConnTimeoutMS int `json:"idleConnTimeoutMS,omitempty" yaml:"idleConnTimeoutMS,omitempty"`
+	// DialTimeoutMS bounds establishing a connection to a destination
+	DialTimeoutMS int `json:"dialTimeoutMS,omitempty" yaml:"dialTimeoutMS,omitempty"`
+}
+
+// Connection pool defaults for fields of TransportConfig left at zero
+const (
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 32
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultDialTimeout         = 5 * time.Second
+)
+
+// orDefault returns n, or def when n is not positive
+func orDefault(n, def int) int {
+	if n > 0 {
+		return n
+	}
+	return def
+}
+
+// msOrDefault returns ms milliseconds, or def when ms is not positive
+func msOrDefault(ms int, def time.Duration) time.Duration {
+	if ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return def
+}
+
+// newForwardClient returns an HTTP client sharing one pooled transport
+// across all destinations, resolving their hostnames through dns if it is
+// not nil and honoring the dial timeout of each request's rule. Redirects are passed back to the caller rather than followed by
+// the router.
+func newForwardClient(config TransportConfig, dns *dnsCache) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   msOrDefault(config.DialTimeoutMS, defaultDialTimeout),
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialTimeout(dns.dialer(dialer.DialContext)),
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          orDefault(config.MaxIdleConns, defaultMaxIdleConns),
+		MaxIdleConnsPerHost:   orDefault(config.MaxIdleConnsPerHost, defaultMaxIdleConnsPerHost),
+		IdleConnTimeout:       msOrDefault(config.IdleConnTimeoutMS, defaultIdleConnTimeout),
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// transportConfig returns the Transport settings, or the defaults when unset
+func (c *RouterConfig) transportConfig() TransportConfig {
+	if c.Transport == nil {
+		return TransportConfig{}
+	}
+	return *c.Transport
+}
+
+// httpClient returns the router's pooled client
+func (r *Router) httpClient() *http.Client {
+	if r.client == nil {
+		return forwardClient
+	}
+	return r.client
+}
@@ -0,0 +1,91 @@
+package router
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewForwardClientDefaults(t *testing.T) {
+	tests := []struct {
+		config         TransportConfig
+		idle, idleHost int
+		idleTimeout    time.Duration
+	}{
+		{TransportConfig{}, defaultMaxIdleConns, defaultMaxIdleConnsPerHost, defaultIdleConnTimeout},
+		{TransportConfig{MaxIdleConns: 10, MaxIdleConnsPerHost: 2, IdleConnTimeoutMS: 500}, 10, 2, 500 * time.Millisecond},
+		{TransportConfig{MaxIdleConns: -1, IdleConnTimeoutMS: -1}, defaultMaxIdleConns, defaultMaxIdleConnsPerHost, defaultIdleConnTimeout},
+	}
+	for _, tt := range tests {
+		transport := newForwardClient(tt.config, nil).Transport.(*http.Transport)
+		if transport.MaxIdleConns != tt.idle || transport.MaxIdleConnsPerHost != tt.idleHost || transport.IdleConnTimeout != tt.idleTimeout {
+			t.Errorf("%+v: pool = %d, %d, %v, want %d, %d, %v", tt.config, transport.MaxIdleConns, transport.MaxIdleConnsPerHost, transport.IdleConnTimeout, tt.idle, tt.idleHost, tt.idleTimeout)
+		}
+	}
+}
+
+// newConnCountingBackend starts a backend counting the connections opened to it
+func newConnCountingBackend(tb testing.TB) (*httptest.Server, *atomic.Int32) {
+	tb.Helper()
+	var conns atomic.Int32
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	backend.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	backend.Start()
+	tb.Cleanup(backend.Close)
+	return backend, &conns
+}
+
+func TestForwardingReusesConnections(t *testing.T) {
+	backend, conns := newConnCountingBackend(t)
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "api", Destination: backend.URL}}})
+	for i := 0; i < 20; i++ {
+		if rec, _ := serve(router, serviceRequest("api", "")); rec.Code != http.StatusOK {
+			t.Fatalf("request %d = %d", i+1, rec.Code)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("20 sequential requests opened %d connections, want 1", n)
+	}
+}
+
+// BenchmarkForwardClient compares a client per request, as the router once
+// used, with the shared pooled client
+func BenchmarkForwardClient(b *testing.B) {
+	backend, conns := newConnCountingBackend(b)
+	get := func(b *testing.B, client *http.Client) {
+		resp, err := client.Get(backend.URL)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	b.Run("per-request", func(b *testing.B) {
+		conns.Store(0)
+		for i := 0; i < b.N; i++ {
+			client := newForwardClient(TransportConfig{}, nil)
+			get(b, client)
+			client.CloseIdleConnections()
+		}
+		b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+	})
+	b.Run("pooled", func(b *testing.B) {
+		conns.Store(0)
+		client := newForwardClient(TransportConfig{}, nil)
+		defer client.CloseIdleConnections()
+		for i := 0; i < b.N; i++ {
+			get(b, client)
+		}
+		b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+	})
+}
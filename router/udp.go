@@ -0,0 +1,304 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxDatagram is the largest UDP payload the router reads
+const maxDatagram = 65535
+
+// UDPRoute sends datagrams to Destination, a host:port. A route matches
+// datagrams whose payload starts with Prefix and that were sent from
+// SourcePort; unset fields match anything. The first matching route wins.
+type UDPRoute struct {
+	Prefix      string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	SourcePort  int    `json:"sourcePort,omitempty" yaml:"sourcePort,omitempty"`
+	Destination string `json:"destination" yaml:"destination"`
+}
+
+// key names the route in sessions and logs
+func (route UDPRoute) key() string {
+	key := "udp"
+	if route.Prefix != "" {
+		key += "~" + strconv.Quote(route.Prefix)
+	}
+	if route.SourcePort != 0 {
+		key += ":" + strconv.Itoa(route.SourcePort)
+	}
+	return key
+}
+
+// matches reports whether a datagram with payload from port falls under the route
+func (route UDPRoute) matches(payload []byte, port int) bool {
+	return bytes.HasPrefix(payload, []byte(route.Prefix)) && (route.SourcePort == 0 || route.SourcePort == port)
+}
+
+// problems returns a description of everything wrong with the route
+func (route UDPRoute) problems() []string {
+	var problems []string
+	if _, _, err := net.SplitHostPort(route.Destination); err != nil {
+		problems = append(problems, fmt.Sprintf("destination %q is not a host:port", route.Destination))
+	}
+	if route.SourcePort < 0 || route.SourcePort > 65535 {
+		problems = append(problems, fmt.Sprintf("sourcePort %d is out of range", route.SourcePort))
+	}
+	return problems
+}
+
+// matchUDP returns the first UDP route matching a datagram with payload from port
+func (r *Router) matchUDP(payload []byte, port int) (UDPRoute, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, route := range r.UDPRoutes {
+		if route.matches(payload, port) {
+			return route, true
+		}
+	}
+	return UDPRoute{}, false
+}
+
+// udpFlow is the NAT binding of one client address: the socket connected to
+// its destination, over which replies come back
+type udpFlow struct {
+	client   netip.AddrPort
+	route    UDPRoute
+	upstream *net.UDPConn
+}
+
+// UDPRouter forwards datagrams received on Addr to the destination of the
+// first matching UDP route of its Router, and relays replies back to the
+// client. Each client address is a session in Sessions, and its binding is
+// dropped once the session expires.
+type UDPRouter struct {
+	Addr     string
+	Sessions *SessionManager
+
+	router *Router
+	mu     sync.Mutex
+	conn   *net.UDPConn
+	flows  map[string]*udpFlow // session key -> binding
+	done   chan struct{}
+	closed bool
+}
+
+// errUDPRouterClosed is returned by Serve after Close
+var errUDPRouterClosed = errors.New("udp router closed")
+
+// NewUDPRouter returns a UDPRouter serving the UDP routes of router on addr.
+// A nil sessions uses a new in-memory SessionManager. Expired sessions are
+// removed by its StartCleanup, which Run starts, not by the UDPRouter.
+func NewUDPRouter(addr string, router *Router, sessions *SessionManager) *UDPRouter {
+	if sessions == nil {
+		sessions = NewSessionManager(nil)
+	}
+	return &UDPRouter{
+		Addr:     addr,
+		Sessions: sessions,
+		router:   router,
+		flows:    make(map[string]*udpFlow),
+		done:     make(chan struct{}),
+	}
+}
+
+// ListenAndServe listens on Addr and calls Serve
+func (u *UDPRouter) ListenAndServe() error {
+	addr, err := net.ResolveUDPAddr("udp", u.Addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	return u.Serve(conn)
+}
+
+// Serve forwards the datagrams received on conn until Close is called, and
+// then returns errUDPRouterClosed
+func (u *UDPRouter) Serve(conn *net.UDPConn) error {
+	u.mu.Lock()
+	if u.closed {
+		u.mu.Unlock()
+		conn.Close()
+		return errUDPRouterClosed
+	}
+	u.conn = conn
+	u.mu.Unlock()
+	go u.expire()
+
+	buf := make([]byte, maxDatagram)
+	for {
+		n, client, err := conn.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			u.mu.Lock()
+			closed := u.closed
+			u.mu.Unlock()
+			if closed {
+				return errUDPRouterClosed
+			}
+			return err
+		}
+		u.forward(buf[:n], client)
+	}
+}
+
+// udpSessionPrefix starts the session keys of UDP flows, so that a flow and
+// an HTTP client on the same address and port keep separate sessions when
+// they share a store. The separator is not "/" so that the keys can be
+// used in the admin API's /sessions/{key} paths.
+const udpSessionPrefix = "udp:"
+
+// udpSessionKey returns the session key of the flow of client
+func udpSessionKey(client netip.AddrPort) string {
+	return udpSessionPrefix + sessionKey(client.Addr().String(), strconv.Itoa(int(client.Port())))
+}
+
+// forward sends payload from client to its destination, binding the client
+// to one on its first datagram
+func (u *UDPRouter) forward(payload []byte, client netip.AddrPort) {
+	client = netip.AddrPortFrom(client.Addr().Unmap(), client.Port())
+	key := udpSessionKey(client)
+	u.mu.Lock()
+	flow, ok := u.flows[key]
+	u.mu.Unlock()
+	if !ok {
+		// Resolving and dialing the destination can be slow, so it is done
+		// without holding up the other flows.
+		bound, err := u.bind(payload, client)
+		if err != nil {
+			u.router.logger().Warn("dropping datagram", "sourceIP", client.Addr().String(), "sourcePort", client.Port(), "error", err)
+			return
+		}
+		u.mu.Lock()
+		switch existing, ok := u.flows[key]; {
+		case u.closed:
+			u.mu.Unlock()
+			bound.upstream.Close()
+			return
+		case ok:
+			flow = existing
+			bound.upstream.Close()
+		default:
+			flow = bound
+			u.flows[key] = flow
+			go u.relay(key, flow)
+		}
+		u.mu.Unlock()
+	}
+
+	if _, err := flow.upstream.Write(payload); err != nil {
+		u.router.logger().Error("forwarding datagram", "destination", flow.route.Destination, "error", err)
+		return
+	}
+	u.touch(flow)
+}
+
+// bind picks the destination for client from the datagram that opened its
+// flow and connects a socket to it
+func (u *UDPRouter) bind(payload []byte, client netip.AddrPort) (*udpFlow, error) {
+	route, ok := u.router.matchUDP(payload, int(client.Port()))
+	if !ok {
+		return nil, errRouteNotFound
+	}
+	addr, err := net.ResolveUDPAddr("udp", route.Destination)
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &udpFlow{client: client, route: route, upstream: upstream}, nil
+}
+
+// touch records traffic on flow in its session, keeping the binding alive
+func (u *UDPRouter) touch(flow *udpFlow) {
+	destIP, destPort, _ := net.SplitHostPort(flow.route.Destination)
+	u.Sessions.AddOrUpdateSession(&Session{
+		DateTimeStamp:   time.Now(),
+		SourceIP:        flow.client.Addr().String(),
+		SourcePort:      strconv.Itoa(int(flow.client.Port())),
+		RequestService:  flow.route.key(),
+		Destination:     flow.route.Destination,
+		DestinationIP:   destIP,
+		DestinationPort: destPort,
+	})
+}
+
+// relay sends the replies arriving on the flow's upstream socket back to its
+// client until the socket is closed
+func (u *UDPRouter) relay(key string, flow *udpFlow) {
+	defer u.unbind(key, flow)
+	buf := make([]byte, maxDatagram)
+	for {
+		n, err := flow.upstream.Read(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				u.router.logger().Warn("reading reply", "destination", flow.route.Destination, "error", err)
+			}
+			return
+		}
+		if _, err := u.conn.WriteToUDPAddrPort(buf[:n], flow.client); err != nil {
+			u.router.logger().Warn("relaying reply", "sourceIP", flow.client.Addr().String(), "error", err)
+			continue
+		}
+		u.touch(flow)
+	}
+}
+
+// unbind closes the flow and removes it if it is still the binding of key
+func (u *UDPRouter) unbind(key string, flow *udpFlow) {
+	flow.upstream.Close()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.flows[key] == flow {
+		delete(u.flows, key)
+	}
+}
+
+// expire closes the bindings of the clients whose sessions are gone or have
+// outlived the TTL every Sessions.CleanupInterval. Removing the expired
+// sessions themselves is left to Sessions.StartCleanup.
+func (u *UDPRouter) expire() {
+	ticker := time.NewTicker(u.Sessions.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			u.mu.Lock()
+			for key, flow := range u.flows {
+				if session, ok := u.Sessions.GetSession(key); !ok || time.Since(session.DateTimeStamp) > u.Sessions.TTL {
+					flow.upstream.Close()
+				}
+			}
+			u.mu.Unlock()
+		case <-u.done:
+			return
+		}
+	}
+}
+
+// Close stops Serve and closes every binding
+func (u *UDPRouter) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		return nil
+	}
+	u.closed = true
+	close(u.done)
+	for _, flow := range u.flows {
+		flow.upstream.Close()
+	}
+	if u.conn != nil {
+		return u.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package router
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newUDPEcho starts a UDP server replying to every datagram with "echo:"
+// and the datagram
+func newUDPEcho(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, maxDatagram)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(append([]byte("echo:"), buf[:n]...), addr)
+		}
+	}()
+	return conn
+}
+
+// startUDPRouter serves the UDP routes of router on a local port with
+// sessions, returning the address to send datagrams to
+func startUDPRouter(t *testing.T, router *Router, sessions *SessionManager) *net.UDPAddr {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	udpRouter := NewUDPRouter("", router, sessions)
+	go udpRouter.Serve(conn)
+	t.Cleanup(func() { udpRouter.Close() })
+	return conn.LocalAddr().(*net.UDPAddr)
+}
+
+// exchange sends payload to addr from client and returns the reply
+func exchange(t *testing.T, client *net.UDPConn, addr *net.UDPAddr, payload string) string {
+	t.Helper()
+	if _, err := client.WriteToUDP([]byte(payload), addr); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, maxDatagram)
+	n, _, err := client.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatalf("no reply to %q: %v", payload, err)
+	}
+	return string(buf[:n])
+}
+
+func TestUDPRoundTrip(t *testing.T) {
+	dns, game := newUDPEcho(t), newUDPEcho(t)
+	router := newTestRouter(t, &RouterConfig{UDPRoutes: []UDPRoute{
+		{Prefix: "GAME", Destination: game.LocalAddr().String()},
+		{Destination: dns.LocalAddr().String()},
+	}})
+	sessions := NewSessionManager(nil)
+	addr := startUDPRouter(t, router, sessions)
+
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if got := exchange(t, client, addr, "GAME hello"); got != "echo:GAME hello" {
+		t.Errorf("reply = %q", got)
+	}
+	// The client stays bound to the route its first datagram matched.
+	if got := exchange(t, client, addr, "query"); got != "echo:query" {
+		t.Errorf("reply = %q", got)
+	}
+
+	entries := sessions.ExportConntrack()
+	if len(entries) != 1 {
+		t.Fatalf("conntrack = %+v, want the client's flow", entries)
+	}
+	entry := entries[0]
+	if entry.Protocol != "udp" || entry.Sport != strconv.Itoa(client.LocalAddr().(*net.UDPAddr).Port) || entry.Service != `udp~"GAME"` {
+		t.Errorf("conntrack entry = %+v", entry)
+	}
+	if _, port, _ := net.SplitHostPort(game.LocalAddr().String()); entry.Dport != port {
+		t.Errorf("conntrack dport = %s, want the game server's %s", entry.Dport, port)
+	}
+}
+
+func TestUDPFlowExpires(t *testing.T) {
+	dns, game := newUDPEcho(t), newUDPEcho(t)
+	router := newTestRouter(t, &RouterConfig{UDPRoutes: []UDPRoute{
+		{Prefix: "GAME", Destination: game.LocalAddr().String()},
+		{Destination: dns.LocalAddr().String()},
+	}})
+	sessions := NewSessionManager(nil, WithTTL(50*time.Millisecond), WithCleanupInterval(10*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sessions.StartCleanup(ctx, sessions.CleanupInterval)
+	addr := startUDPRouter(t, router, sessions)
+
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	exchange(t, client, addr, "GAME hello")
+	time.Sleep(200 * time.Millisecond)
+	if n := sessions.Count(); n != 0 {
+		t.Errorf("%d sessions left after the TTL", n)
+	}
+	// With its binding gone the client is matched afresh.
+	if got := exchange(t, client, addr, "query"); got != "echo:query" {
+		t.Errorf("reply after expiry = %q", got)
+	}
+}
+
+func TestUDPSessionsApartFromHTTP(t *testing.T) {
+	game := newUDPEcho(t)
+	router := newTestRouter(t, &RouterConfig{UDPRoutes: []UDPRoute{{Destination: game.LocalAddr().String()}}})
+	sessions := NewSessionManager(nil)
+	addr := startUDPRouter(t, router, sessions)
+
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	exchange(t, client, addr, "hello")
+	// An HTTP client on the same address and port keeps a session of its own.
+	port := strconv.Itoa(client.LocalAddr().(*net.UDPAddr).Port)
+	sessions.AddOrUpdateSession(&Session{DateTimeStamp: time.Now(), SourceIP: "127.0.0.1", SourcePort: port, RequestService: "api"})
+
+	if n := sessions.Count(); n != 2 {
+		t.Errorf("%d sessions for a UDP flow and an HTTP client, want 2", n)
+	}
+	flow, ok := sessions.GetSession(udpSessionKey(client.LocalAddr().(*net.UDPAddr).AddrPort()))
+	if !ok || flow.RequestService != "udp" {
+		t.Errorf("UDP flow session = %+v, %v, want the udp route's", flow, ok)
+	}
+	if http, ok := sessions.GetSession(sessionKey("127.0.0.1", port)); !ok || http.RequestService != "api" {
+		t.Errorf("HTTP session = %+v, %v, want api's", http, ok)
+	}
+}
+
+func TestUDPRouteMatches(t *testing.T) {
+	tests := []struct {
+		route   UDPRoute
+		payload string
+		port    int
+		want    bool
+	}{
+		{UDPRoute{}, "anything", 1234, true},
+		{UDPRoute{Prefix: "GAME"}, "GAME hello", 1234, true},
+		{UDPRoute{Prefix: "GAME"}, "GAM", 1234, false},
+		{UDPRoute{SourcePort: 53}, "query", 53, true},
+		{UDPRoute{SourcePort: 53}, "query", 54, false},
+		{UDPRoute{Prefix: "Q", SourcePort: 53}, "query", 53, false},
+	}
+	for _, tt := range tests {
+		if got := tt.route.matches([]byte(tt.payload), tt.port); got != tt.want {
+			t.Errorf("%s matches %q from %d = %v, want %v", tt.route.key(), tt.payload, tt.port, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ValidationError lists every problem found while validating a config
+type ValidationError struct {
+	Problems []string
+	// Rules holds, for each problem, the index of the rule it is about, or
+	// -1 for problems with other settings
+	Rules []int
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// validDestination reports whether destination is a URL with a host or a host:port pair
+func validDestination(destination string) error {
+	if strings.Contains(destination, "://") {
+		_, err := parseUpstream(destination)
+		return err
+	}
+	host, port, err := net.SplitHostPort(destination)
+	if err != nil {
+		return fmt.Errorf("destination %q is not a host:port or URL", destination)
+	}
+	if host == "" || port == "" {
+		return fmt.Errorf("destination %q is missing a host or port", destination)
+	}
+	return nil
+}
+
+// validMethod reports whether method is a non-empty HTTP token
+func validMethod(method string) bool {
+	return method != "" && !strings.ContainsFunc(method, func(c rune) bool {
+		return c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c)
+	})
+}
+
+// problems returns a description of everything wrong with the rule
+func (rule Rule) problems() []string {
+	var problems []string
+	if rule.Service == "" && rule.Pattern == "" && rule.PathPrefix == "" && rule.Host == "" {
+		problems = append(problems, "empty service, pattern, host and path prefix")
+	}
+	if rule.QueryParam != "" && rule.Service == "" && rule.Pattern == "" {
+		problems = append(problems, fmt.Sprintf("queryParam %q requires a service or pattern to match its value", rule.QueryParam))
+	}
+	for _, method := range rule.Methods {
+		if !validMethod(method) {
+			problems = append(problems, fmt.Sprintf("method %q is not a valid HTTP method", method))
+		}
+	}
+	if _, err := parseSchedule(rule.Schedule); err != nil {
+		problems = append(problems, "schedule: "+err.Error())
+	}
+	if rule.Pattern != "" {
+		if _, err := regexp.Compile(anchorPattern(rule.Pattern)); err != nil {
+			problems = append(problems, fmt.Sprintf("pattern %q: %v", rule.Pattern, err))
+		}
+	}
+	if strings.Contains(strings.TrimPrefix(rule.Host, "*."), "*") {
+		problems = append(problems, fmt.Sprintf("host %q: wildcard is only allowed as a leading *.", rule.Host))
+	}
+	if rule.PathPrefix != "" && !strings.HasPrefix(rule.PathPrefix, "/") {
+		problems = append(problems, fmt.Sprintf("path prefix %q must start with /", rule.PathPrefix))
+	}
+	destinations := rule.pool()
+	for _, wd := range rule.Weights {
+		destinations = append(destinations, wd.Address)
+	}
+	if rule.blueGreen() {
+		if len(destinations) > 0 {
+			problems = append(problems, "blue and green cannot be combined with other destinations")
+		}
+		destinations = nil
+		for _, destination := range []string{rule.Blue, rule.Green} {
+			if destination != "" {
+				destinations = append(destinations, destination)
+			}
+		}
+		switch {
+		case rule.Active != "" && rule.Active != colorBlue && rule.Active != colorGreen:
+			problems = append(problems, fmt.Sprintf("active %q must be blue or green", rule.Active))
+		case rule.activeDestination() == "":
+			problems = append(problems, fmt.Sprintf("active color %s has no destination", rule.activeColor()))
+		}
+	}
+	if rule.Strategy != "" {
+		if _, err := NewLoadBalancer(rule); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if rule.HashHeader != "" && rule.strategy() != StrategyKeyHash {
+		problems = append(problems, "hashHeader requires strategy keyHash")
+	}
+	if rule.RewritePath != "" && !strings.HasPrefix(rule.RewritePath, "/") {
+		problems = append(problems, fmt.Sprintf("rewritePath %q must start with /", rule.RewritePath))
+	}
+	if rule.TimeoutMS < 0 || rule.TotalTimeoutMS < 0 || rule.DialTimeoutMS < 0 || rule.ResponseHeaderTimeoutMS < 0 {
+		problems = append(problems, "negative timeout")
+	}
+	if rule.Retries < 0 || rule.RetryBackoffMS < 0 || rule.RetryMaxBackoffMS < 0 {
+		problems = append(problems, "negative retry setting")
+	}
+	for code, destination := range rule.GeoDestinations {
+		if err := validDestination(destination); err != nil {
+			problems = append(problems, fmt.Sprintf("geoDestinations[%s]: %v", code, err))
+		}
+	}
+	if rule.Mirror != "" {
+		if err := validDestination(rule.Mirror); err != nil {
+			problems = append(problems, fmt.Sprintf("mirror: %v", err))
+		}
+	}
+	if rule.MirrorPercent < 0 || rule.MirrorPercent > 100 {
+		problems = append(problems, fmt.Sprintf("mirrorPercent %d must be between 0 and 100", rule.MirrorPercent))
+	}
+	if _, err := parseAccessList(rule.Allow, rule.Deny); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if rule.CacheTTLMS < 0 {
+		problems = append(problems, "negative cacheTTLMS")
+	}
+	if rule.MaxConcurrent < 0 {
+		problems = append(problems, "negative maxConcurrent")
+	}
+	if rule.QueueSize < 0 {
+		problems = append(problems, "negative queueSize")
+	}
+	if rule.QueueTimeoutMS < 0 {
+		problems = append(problems, "negative queueTimeoutMS")
+	}
+	if rule.MaxBodyBytes < 0 {
+		problems = append(problems, "negative maxBodyBytes")
+	}
+	if rule.RateLimit < 0 || rule.Burst < 0 {
+		problems = append(problems, "negative rateLimit or burst")
+	}
+	if len(destinations) == 0 {
+		problems = append(problems, "no destination")
+	}
+	for _, destination := range destinations {
+		if err := validDestination(destination); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	for _, destination := range rule.Backup {
+		if err := validDestination(destination); err != nil {
+			problems = append(problems, fmt.Sprintf("backup: %v", err))
+		}
+	}
+	return problems
+}
+
+// validateRule checks a single rule in isolation
+func validateRule(rule Rule) error {
+	if problems := rule.problems(); len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// Validate checks every rule and returns a ValidationError naming each
+// offending rule index, or nil if the config is usable
+func (c *RouterConfig) Validate() error {
+	verr := &ValidationError{}
+	ruleProblem := func(i int, format string, args ...any) {
+		verr.Problems = append(verr.Problems, fmt.Sprintf("rule %d (%q): ", i, c.Rules[i].key())+fmt.Sprintf(format, args...))
+		verr.Rules = append(verr.Rules, i)
+	}
+	var problems []string // problems with settings other than rules
+	seen := make(map[string]int)
+	for i, rule := range c.Rules {
+		for _, problem := range rule.problems() {
+			ruleProblem(i, "%s", problem)
+		}
+		if rule.key() == "" {
+			continue
+		}
+		if first, ok := seen[rule.key()]; ok {
+			ruleProblem(i, "duplicate rule, first defined in rule %d", first)
+			continue
+		}
+		seen[rule.key()] = i
+	}
+	for i, route := range c.UDPRoutes {
+		for _, problem := range route.problems() {
+			problems = append(problems, fmt.Sprintf("udpRoutes[%d]: %s", i, problem))
+		}
+	}
+	if _, err := parsePrefixes("trusted proxy", c.TrustedProxies); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := parseAccessList(c.Allow, c.Deny); err != nil {
+		problems = append(problems, err.Error())
+	}
+	for i, token := range c.AuthTokens {
+		if strings.TrimSpace(token) == "" {
+			problems = append(problems, fmt.Sprintf("authTokens[%d]: empty token", i))
+		}
+	}
+	if c.CORS != nil {
+		for _, problem := range c.CORS.problems() {
+			problems = append(problems, "cors: "+problem)
+		}
+	}
+	if c.ClientRateLimit < 0 || c.ClientBurst < 0 {
+		problems = append(problems, "negative clientRateLimit or clientBurst")
+	}
+	if c.Default != "" {
+		if err := validDestination(c.Default); err != nil {
+			problems = append(problems, fmt.Sprintf("default: %v", err))
+		}
+	}
+	if c.LogSampleRate < 0 || c.LogSampleRate > 1 {
+		problems = append(problems, fmt.Sprintf("logSampleRate %v must be between 0 and 1", c.LogSampleRate))
+	}
+	if c.CacheEntries < 0 {
+		problems = append(problems, "negative cacheEntries")
+	}
+	if c.MaxConcurrent < 0 {
+		problems = append(problems, "negative maxConcurrent")
+	}
+	if c.MaxBodyBytes < 0 {
+		problems = append(problems, "negative maxBodyBytes")
+	}
+	if c.TimeZone != "" {
+		if _, err := time.LoadLocation(c.TimeZone); err != nil {
+			problems = append(problems, fmt.Sprintf("timeZone %q: %v", c.TimeZone, err))
+		}
+	}
+	if c.MaxConnectionAgeMS < 0 {
+		problems = append(problems, "negative maxConnectionAgeMS")
+	}
+	if c.TimeoutMS < 0 {
+		problems = append(problems, "negative timeoutMS")
+	}
+	if hc := c.HealthCheck; hc != nil && (hc.IntervalMS < 0 || hc.TimeoutMS < 0) {
+		problems = append(problems, "healthCheck: negative intervalMS or timeoutMS")
+	}
+	if hc := c.HealthCheck; hc != nil && hc.Path != "" && !strings.HasPrefix(hc.Path, "/") {
+		problems = append(problems, fmt.Sprintf("healthCheck: path %q must start with /", hc.Path))
+	}
+	if t := c.Transport; t != nil && (t.MaxIdleConns < 0 || t.MaxIdleConnsPerHost < 0 || t.IdleConnTimeoutMS < 0 || t.DialTimeoutMS < 0) {
+		problems = append(problems, "transport: negative pool size or timeout")
+	}
+	for status := range c.ErrorPages {
+		if status < 400 || status > 599 {
+			problems = append(problems, fmt.Sprintf("errorPages: status %d is not an error status", status))
+		}
+	}
+	if b := c.RetryBudget; b != nil && (b.Ratio < 0 || b.Ratio > 1 || b.MinPerSecond < 0) {
+		problems = append(problems, fmt.Sprintf("retryBudget: ratio %v must be between 0 and 1 and minPerSecond non-negative", b.Ratio))
+	}
+	if d := c.DNS; d != nil && (d.TTLMS < 0 || d.GraceMS < 0) {
+		problems = append(problems, "dns: negative ttlMS or graceMS")
+	}
+	if cb := c.CircuitBreaker; cb != nil && (cb.FailureThreshold < 0 || cb.CooldownMS < 0) {
+		problems = append(problems, "circuitBreaker: negative failureThreshold or cooldownMS")
+	}
+	for _, problem := range problems {
+		verr.Problems = append(verr.Problems, problem)
+		verr.Rules = append(verr.Rules, -1)
+	}
+	if len(verr.Problems) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// Validate checks the router's current configuration
+func (r *Router) Validate() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.RouterConfig.Validate()
+}
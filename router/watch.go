@@ -0,0 +1,188 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce coalesces the burst of events editors emit when saving a file
+const reloadDebounce = 100 * time.Millisecond
+
+// reloadPollInterval is how often the polling fallback checks the config file
+const reloadPollInterval = time.Second
+
+// setConfig atomically replaces the router's configuration
+func (r *Router) setConfig(config *RouterConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.RouterConfig = *config
+	r.rulesVersion++
+	r.breaker.Configure(config.circuitBreakerConfig())
+	r.configureHealth(config.HealthCheck)
+}
+
+// reload re-reads and validates filename, keeping the current config on
+// error. A failed reload marks the router as not ready until the file is
+// fixed.
+func (r *Router) reload(filename string) error {
+	config, err := loadConfig(filename, r.strictConfig)
+	r.mu.Lock()
+	r.configErr = err
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	r.setConfig(config)
+	r.logConfigWarnings()
+	return nil
+}
+
+// logConfigWarnings logs the deprecated fields found in the loaded config
+func (r *Router) logConfigWarnings() {
+	r.mu.RLock()
+	warnings := r.warnings
+	r.mu.RUnlock()
+	for _, warning := range warnings {
+		r.logger().Warn("deprecated config", "warning", warning)
+	}
+}
+
+// Ready returns nil once a valid config is serving, or the error from the
+// last failed reload
+func (r *Router) Ready() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.configErr
+}
+
+// Watch reloads the routing rules whenever filename changes. It watches the
+// file's directory with fsnotify so that editors which replace the file are
+// handled, and falls back to polling the modification time if fsnotify is
+// unavailable. A config that fails to load is logged and the previous rules
+// keep serving. Watching stops when the router is closed.
+func (r *Router) Watch(filename string) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		r.logger().Warn("fsnotify unavailable, polling config", "error", err)
+		return r.poll(filename)
+	}
+	// A config directory is watched for changes to any config file in it;
+	// a single file is watched through its directory so that editors that
+	// replace the file by renaming over it are noticed.
+	dir, target := filepath.Dir(filename), filepath.Clean(filename)
+	info, err := os.Stat(filename)
+	isDir := err == nil && info.IsDir()
+	if isDir {
+		dir = filename
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return err
+	}
+	relevant := func(event fsnotify.Event) bool {
+		if isDir {
+			return isConfigFile(event.Name) && event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove)
+		}
+		return filepath.Clean(event.Name) == target && event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename)
+	}
+	r.goBackground(context.Background(), func(ctx context.Context) {
+		defer watcher.Close()
+		var pending *time.Timer
+		defer func() {
+			if pending != nil {
+				pending.Stop()
+			}
+		}()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !relevant(event) {
+					continue
+				}
+				if pending != nil {
+					pending.Stop()
+				}
+				pending = time.AfterFunc(reloadDebounce, func() { r.logReload(filename) })
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				r.logger().Error("watching config", "error", err)
+			}
+		}
+	})
+	return nil
+}
+
+// ReloadOnSignal reloads filename whenever the process receives one of
+// signals, such as SIGHUP, until ctx is canceled or the router is closed.
+// It works independently of Watch, so reloads can be triggered where file
+// events are unavailable.
+func (r *Router) ReloadOnSignal(ctx context.Context, filename string, signals ...os.Signal) {
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+	r.goBackground(ctx, func(ctx context.Context) {
+		defer signal.Stop(received)
+		for {
+			select {
+			case sig := <-received:
+				r.logger().Info("reload requested", "signal", sig.String())
+				r.logReload(filename)
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// poll reloads filename whenever its modification time changes
+func (r *Router) poll(filename string) error {
+	modTime, err := configModTime(filename)
+	if err != nil {
+		return err
+	}
+	r.goBackground(context.Background(), func(ctx context.Context) {
+		ticker := time.NewTicker(reloadPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			latest, err := configModTime(filename)
+			if err != nil {
+				if !errors.Is(err, os.ErrNotExist) {
+					r.logger().Error("watching config", "error", err)
+				}
+				continue
+			}
+			if latest.Equal(modTime) {
+				continue
+			}
+			modTime = latest
+			r.logReload(filename)
+		}
+	})
+	return nil
+}
+
+// logReload reloads filename and reports the outcome
+func (r *Router) logReload(filename string) {
+	if err := r.reload(filename); err != nil {
+		r.logger().Error("reloading config, keeping previous rules", "file", filename, "error", err)
+		return
+	}
+	r.logger().Info("reloaded config", "file", filename)
+}
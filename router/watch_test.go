@@ -0,0 +1,65 @@
+package router
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReloadOnSignal(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "router.json")
+	write := func(config string) {
+		if err := os.WriteFile(file, []byte(config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"rules":[{"service":"api","destination":"http://a:1"}]}`)
+	var logs logRecorder
+	router := newTestRouter(t, nil, WithConfigFile(file), WithLogger(slog.New(&logs)))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	router.ReloadOnSignal(ctx, file, syscall.SIGHUP)
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// hangup sends SIGHUP and waits for the reload to log msg at level
+	hangup := func(level slog.Level, msg string) {
+		t.Helper()
+		before := logs.count(level, msg)
+		if err := process.Signal(syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for logs.count(level, msg) == before {
+			if time.Now().After(deadline) {
+				t.Fatalf("no %q logged after SIGHUP", msg)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	routed := func() string {
+		destination, _ := router.RouteRequest(serviceRequest("api", ""))
+		return destination
+	}
+
+	write(`{"rules":[{"service":"api","destination":"http://b:1"}]}`)
+	hangup(slog.LevelInfo, "reloaded config")
+	if got := routed(); got != "http://b:1" {
+		t.Errorf("after SIGHUP routed to %q, want http://b:1", got)
+	}
+
+	write(`{"rules":[{"service":"api"}]}`)
+	hangup(slog.LevelError, "reloading config, keeping previous rules")
+	if got := routed(); got != "http://b:1" {
+		t.Errorf("after a failed reload routed to %q, want the previous http://b:1", got)
+	}
+	if router.Ready() == nil {
+		t.Error("router ready after a failed reload")
+	}
+}
@@ -0,0 +1,138 @@
+package router
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// upgradeDialTimeout bounds connecting to a destination for an upgraded connection
+const upgradeDialTimeout = 10 * time.Second
+
+// isUpgrade reports whether req asks to switch protocols, as WebSocket handshakes do
+func isUpgrade(req *http.Request) bool {
+	if req.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, field := range req.Header.Values("Connection") {
+		for _, token := range strings.Split(field, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "Upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dialDestination opens a connection to the host of a forwarded request
+// the way the router's transport would, through its DNS cache and with its
+// TLS config, giving up after timeout or when the request is canceled
+func (r *Router) dialDestination(outReq *http.Request, timeout time.Duration) (net.Conn, error) {
+	host := outReq.URL.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), defaultPort(outReq.URL.Scheme))
+	}
+	dial := (&net.Dialer{}).DialContext
+	var config *tls.Config
+	if transport, ok := r.httpClient().Transport.(*http.Transport); ok {
+		if transport.DialContext != nil {
+			dial = transport.DialContext
+		}
+		config = transport.TLSClientConfig
+	}
+	ctx, cancel := context.WithTimeout(outReq.Context(), timeout)
+	defer cancel()
+	conn, err := dial(ctx, "tcp", host)
+	if err != nil || outReq.URL.Scheme != "https" {
+		return conn, err
+	}
+	if config = config.Clone(); config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config.ServerName = outReq.URL.Hostname()
+	}
+	// The upgrade is an HTTP/1.1 request, whatever the transport would offer
+	config.NextProtos = nil
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// proxyUpgrade relays a protocol upgrade such as a WebSocket handshake to
+// destination under rule. If the destination switches protocols, the client connection
+// is hijacked and bytes are copied both ways until either side closes;
+// otherwise its response is passed back as usual. No timeout applies to the
+// upgraded connection, so long-lived sockets stay open.
+func (r *Router) proxyUpgrade(w http.ResponseWriter, req *http.Request, rule Rule, destination string) (int, error) {
+	target, err := rule.upstream(destination)
+	if err != nil {
+		return 0, err
+	}
+	outReq, err := newForwardRequest(rule.rewritePath(req), target)
+	if err != nil {
+		return 0, err
+	}
+	rule.rewriteRequest(outReq)
+	outReq.Header.Set("Connection", "Upgrade")
+	outReq.Header.Set("Upgrade", req.Header.Get("Upgrade"))
+
+	backend, err := r.dialDestination(outReq, cmp.Or(rule.dialTimeout(), upgradeDialTimeout))
+	if err != nil {
+		r.breaker.Failure(destination)
+		return 0, err
+	}
+	if err := outReq.Write(backend); err != nil {
+		backend.Close()
+		r.breaker.Failure(destination)
+		return 0, err
+	}
+	backendReader := bufio.NewReader(backend)
+	resp, err := http.ReadResponse(backendReader, outReq)
+	if err != nil {
+		backend.Close()
+		r.breaker.Failure(destination)
+		return 0, err
+	}
+	r.breaker.Success(destination)
+	rule.rewriteResponse(resp)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer backend.Close()
+		return resp.StatusCode, copyResponse(w, resp)
+	}
+
+	client, clientBuf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		backend.Close()
+		return 0, err
+	}
+	defer client.Close()
+	defer backend.Close()
+	if err := resp.Write(client); err != nil {
+		return resp.StatusCode, err
+	}
+
+	errc := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(backend, clientBuf)
+		errc <- err
+	}()
+	go func() {
+		_, err := io.Copy(client, backendReader)
+		errc <- err
+	}()
+	if err := <-errc; err != nil && !errors.Is(err, net.ErrClosed) {
+		return resp.StatusCode, err
+	}
+	return resp.StatusCode, nil
+}
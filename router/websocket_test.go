@@ -0,0 +1,127 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestIsUpgrade(t *testing.T) {
+	tests := []struct {
+		connection, upgrade string
+		want                bool
+	}{
+		{"Upgrade", "websocket", true},
+		{"keep-alive, Upgrade", "websocket", true},
+		{"upgrade", "h2c", true},
+		{"keep-alive", "websocket", false},
+		{"Upgrade", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Connection", tt.connection)
+		req.Header.Set("Upgrade", tt.upgrade)
+		if got := isUpgrade(req); got != tt.want {
+			t.Errorf("isUpgrade(Connection %q, Upgrade %q) = %v, want %v", tt.connection, tt.upgrade, got, tt.want)
+		}
+	}
+}
+
+func TestWebSocketProxy(t *testing.T) {
+	echo := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		io.Copy(ws, ws)
+	}))
+	t.Cleanup(echo.Close)
+	// The request timeout must not cut off the socket once it is upgraded.
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "chat", Destination: echo.URL, TotalTimeoutMS: 50}}})
+	front := httptest.NewServer(router)
+	t.Cleanup(front.Close)
+
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(front.URL, "http")+"/socket", front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Header.Set("X-Service-Type", "chat")
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	for i, message := range []string{"hello", "still there?"} {
+		if i > 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if err := websocket.Message.Send(ws, message); err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if err := websocket.Message.Receive(ws, &got); err != nil {
+			t.Fatalf("message %d: %v", i+1, err)
+		}
+		if got != message {
+			t.Errorf("echo = %q, want %q", got, message)
+		}
+	}
+}
+
+func TestWebSocketProxyTLS(t *testing.T) {
+	echo := httptest.NewTLSServer(websocket.Handler(func(ws *websocket.Conn) {
+		io.Copy(ws, ws)
+	}))
+	t.Cleanup(echo.Close)
+	// The destination's certificate is only trusted through WithTLS.
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "chat", Destination: echo.URL}}},
+		WithTLS(echo.Client().Transport.(*http.Transport).TLSClientConfig))
+	front := httptest.NewServer(router)
+	t.Cleanup(front.Close)
+
+	config, err := websocket.NewConfig("ws"+strings.TrimPrefix(front.URL, "http")+"/socket", front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Header.Set("X-Service-Type", "chat")
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err := websocket.Message.Send(ws, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := websocket.Message.Receive(ws, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != "hello" {
+		t.Errorf("echo = %q, want %q", got, "hello")
+	}
+}
+
+func TestWebSocketUpgradeRefused(t *testing.T) {
+	backend := newBackend(t, "no sockets here")
+	router := newTestRouter(t, &RouterConfig{Rules: []Rule{{Service: "chat", Destination: backend.URL}}})
+	front := httptest.NewServer(router)
+	t.Cleanup(front.Close)
+
+	req, _ := http.NewRequest(http.MethodGet, front.URL, nil)
+	req.Header.Set("X-Service-Type", "chat")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "no sockets here" {
+		t.Errorf("refused upgrade = %d %q, want the backend's 200", resp.StatusCode, body)
+	}
+}